@@ -0,0 +1,386 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/fahmaliyi/atmer/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	atmWhere  []string
+	atmJSON   bool
+	atmName   string
+	atmIP     string
+	atmRegion string
+	atmLinks  []string
+	atmMaint  string
+	atmAll    bool
+	atmYes    bool
+)
+
+var atmCmd = &cobra.Command{
+	Use:   "atm",
+	Short: "List, add, edit, rename or delete ATMs without the interactive manager",
+	Long: `Scriptable commands for the ATM list.
+
+Selectors take field=value pairs (fields: name, ip, modem, region); every
+--where must match, matching is exact and case-insensitive, * and ? are
+wildcards (name=Bole*), and a CIDR such as ip=10.20.0.0/16 matches a
+subnet. Changes go through the same validation
+as 'atmer manage', are logged for 'atmer audit' and can be undone.
+
+Examples:
+
+  atmer atm list --where ip=10.20.0.0/16
+  atmer atm add --name "Bole Branch" --ip 10.20.1.10
+  atmer atm add --name "CMC" --ip 10.20.3.10 --link 4g:backup=10.50.3.10
+  atmer atm edit "Bole Branch" --ip 10.20.1.20
+  atmer atm rename "Bole Branch" "Bole Main"
+  atmer atm rm --where ip=10.20.0.0/16 --all --yes`,
+}
+
+var atmListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List ATMs, optionally filtered by selectors",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		machines := loadMachinesOrExit()
+
+		if len(atmWhere) > 0 {
+			selector, err := parseWhere(service.MachineSchema, atmWhere)
+			if err != nil {
+				out.Printf("❌ %s\n", err)
+				os.Exit(1)
+			}
+			var matched []service.Machine
+			for _, m := range machines {
+				if selector.Match(m) {
+					matched = append(matched, m)
+				}
+			}
+			machines = matched
+		}
+
+		if atmJSON {
+			if machines == nil {
+				machines = []service.Machine{}
+			}
+			data, _ := json.MarshalIndent(machines, "", "  ")
+			fmt.Println(string(data))
+			return
+		}
+
+		out.Printf("📄 Total ATMs: %d\n", len(machines))
+		for i, m := range machines {
+			line := fmt.Sprintf("%d. %s (%s)", i+1, m.Name, m.IP)
+			if m.Region != "" {
+				line += fmt.Sprintf(" [%s]", m.Region)
+			}
+			if m.Maintenance != "" {
+				line += " 🛠️ " + m.Maintenance
+			}
+			out.Println(line)
+		}
+	},
+}
+
+var atmGetCmd = &cobra.Command{
+	Use:   "get <name>",
+	Short: "Show one ATM with its modem IP and circuit",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		machines := loadMachinesOrExit()
+		i := findMachine(machines, args[0])
+		if i < 0 {
+			out.Printf("❌ No ATM named %s\n", args[0])
+			os.Exit(1)
+		}
+
+		if atmJSON {
+			data, _ := json.MarshalIndent(machines[i], "", "  ")
+			fmt.Println(string(data))
+			return
+		}
+
+		records, err := openServices(serviceFile).Load()
+		if err != nil && !os.IsNotExist(err) {
+			printServiceError("Failed to load services", err)
+		}
+		for _, site := range service.LinkSites(machines, records, nil) {
+			if site.Machine != nil && strings.EqualFold(site.Machine.Name, machines[i].Name) {
+				printSite(site)
+			}
+		}
+	},
+}
+
+var atmAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add an ATM",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		machines := loadMachinesOrExit()
+		added := service.Machine{
+			Name:   strings.TrimSpace(atmName),
+			IP:     strings.TrimSpace(atmIP),
+			Region: strings.TrimSpace(atmRegion),
+			Links:  parseLinkFlags(),
+
+			Maintenance: parseMaintenanceFlag(),
+		}
+		if err := validateMachine(added, machines); err != nil {
+			out.Printf("❌ %s\n", err)
+			os.Exit(1)
+		}
+
+		summary := fmt.Sprintf("Added ATM %s (%s)", added.Name, added.IP)
+		if _, err := commitMachines(cmd, applyChanges(summary, []service.MachineChange{{After: &added}})); err != nil {
+			out.Println("❌ Failed to add ATM:", err)
+			os.Exit(1)
+		}
+		out.Println("✅ ATM added")
+	},
+}
+
+var atmEditCmd = &cobra.Command{
+	Use:   "edit <name>",
+	Short: "Change the IP, name or region of an ATM",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		machines := loadMachinesOrExit()
+		i := findMachine(machines, args[0])
+		if i < 0 {
+			out.Printf("❌ No ATM named %s\n", args[0])
+			os.Exit(1)
+		}
+
+		before := machines[i]
+		after := before
+		if cmd.Flags().Changed("name") {
+			after.Name = strings.TrimSpace(atmName)
+		}
+		if cmd.Flags().Changed("ip") {
+			after.IP = strings.TrimSpace(atmIP)
+		}
+		if cmd.Flags().Changed("region") {
+			after.Region = strings.TrimSpace(atmRegion)
+		}
+		if cmd.Flags().Changed("link") {
+			after.Links = parseLinkFlags()
+		}
+		if cmd.Flags().Changed("maintenance") {
+			after.Maintenance = parseMaintenanceFlag()
+		}
+		if after.Equal(before) {
+			out.Println("❌ Nothing to change; give --ip, --name, --region, --link and/or --maintenance")
+			os.Exit(1)
+		}
+
+		editMachine(cmd, machines, i, after)
+	},
+}
+
+var atmRenameCmd = &cobra.Command{
+	Use:   "rename <name> <new-name>",
+	Short: "Rename an ATM",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		machines := loadMachinesOrExit()
+		i := findMachine(machines, args[0])
+		if i < 0 {
+			out.Printf("❌ No ATM named %s\n", args[0])
+			os.Exit(1)
+		}
+
+		after := machines[i]
+		after.Name = strings.TrimSpace(args[1])
+		editMachine(cmd, machines, i, after)
+	},
+}
+
+var atmRmCmd = &cobra.Command{
+	Use:     "rm [name]",
+	Aliases: []string{"remove", "delete"},
+	Short:   "Delete an ATM by name or the ATMs matching selectors",
+	Args:    cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		machines := loadMachinesOrExit()
+
+		var drop []int
+		switch {
+		case len(args) == 1 && len(atmWhere) == 0:
+			if i := findMachine(machines, args[0]); i >= 0 {
+				drop = append(drop, i)
+			}
+		case len(args) == 0 && len(atmWhere) > 0:
+			selector, err := parseWhere(service.MachineSchema, atmWhere)
+			if err != nil {
+				out.Printf("❌ %s\n", err)
+				os.Exit(1)
+			}
+			for i, m := range machines {
+				if selector.Match(m) {
+					drop = append(drop, i)
+				}
+			}
+		default:
+			out.Println("❌ Give either an ATM name or --where selectors")
+			os.Exit(1)
+		}
+
+		if len(drop) == 0 {
+			out.Println("❌ No matching ATMs found")
+			os.Exit(1)
+		}
+
+		out.Println("🔎 Matching ATMs:")
+		for n, i := range drop {
+			out.Printf("%d. %s (%s)\n", n+1, machines[i].Name, machines[i].IP)
+		}
+		if len(drop) > 1 && !atmAll {
+			out.Printf("❌ %d ATMs match; use --all to delete every one of them\n", len(drop))
+			os.Exit(1)
+		}
+		if !atmYes && !confirm("❓ Confirm delete of %d ATM(s) (y/N): ", len(drop)) {
+			out.Println("🚫 Cancelled")
+			return
+		}
+
+		var changes []service.MachineChange
+		var names []string
+		for _, i := range drop {
+			before := machines[i]
+			changes = append(changes, service.MachineChange{Before: &before})
+			names = append(names, before.Name)
+		}
+		summary := fmt.Sprintf("Deleted %d ATM(s): %s", len(names), strings.Join(names, ", "))
+		if _, err := commitMachines(cmd, applyChanges(summary, changes)); err != nil {
+			out.Println("❌ Failed to delete ATM:", err)
+			os.Exit(1)
+		}
+		out.Printf("✅ Deleted %d ATM(s)\n", len(drop))
+	},
+}
+
+// editMachine validates and saves a changed ATM in place of machines[i]
+func editMachine(cmd *cobra.Command, machines []service.Machine, i int, after service.Machine) {
+	before := machines[i]
+	others := append(append([]service.Machine(nil), machines[:i]...), machines[i+1:]...)
+	if err := validateMachine(after, others); err != nil {
+		out.Printf("❌ %s\n", err)
+		os.Exit(1)
+	}
+
+	var parts []string
+	if before.Name != after.Name {
+		parts = append(parts, fmt.Sprintf("name %s → %s", before.Name, after.Name))
+	}
+	if before.IP != after.IP {
+		parts = append(parts, fmt.Sprintf("IP %s → %s", before.IP, after.IP))
+	}
+	if before.Region != after.Region {
+		parts = append(parts, fmt.Sprintf("region %s → %s", before.Region, after.Region))
+	}
+	if old, cur := service.FormatLinks(before.Links), service.FormatLinks(after.Links); old != cur {
+		parts = append(parts, fmt.Sprintf("links %s → %s", quoteEmpty(old), quoteEmpty(cur)))
+	}
+	if before.Maintenance != after.Maintenance {
+		parts = append(parts, fmt.Sprintf("maintenance %s → %s", quoteEmpty(before.Maintenance), quoteEmpty(after.Maintenance)))
+	}
+	summary := fmt.Sprintf("Edited ATM %s: %s", before.Name, strings.Join(parts, ", "))
+
+	if _, err := commitMachines(cmd, applyChanges(summary, []service.MachineChange{{Before: &before, After: &after}})); err != nil {
+		out.Println("❌ Failed to save changes:", err)
+		os.Exit(1)
+	}
+	out.Println("✅ ATM updated")
+}
+
+// parseLinkFlags reads the --link flags; an empty --link "" clears them
+func parseLinkFlags() []service.Link {
+	links, err := service.ParseLinks(strings.Join(atmLinks, ";"))
+	if err != nil {
+		out.Printf("❌ %s\n", err)
+		os.Exit(1)
+	}
+	return links
+}
+
+// parseMaintenanceFlag reads --maintenance; "" takes the ATM out of
+// maintenance
+func parseMaintenanceFlag() string {
+	value := strings.TrimSpace(atmMaint)
+	if value == "" {
+		return ""
+	}
+	if _, err := service.ParseMaintenance(value); err != nil {
+		out.Printf("❌ %s\n", err)
+		os.Exit(1)
+	}
+	return value
+}
+
+// findMachine returns the index of the ATM with this name, or -1
+func findMachine(machines []service.Machine, name string) int {
+	for i, m := range machines {
+		if strings.EqualFold(m.Name, strings.TrimSpace(name)) {
+			return i
+		}
+	}
+	return -1
+}
+
+func loadMachinesOrExit() []service.Machine {
+	machines, err := utils.LoadMachines(excelpath)
+	if err != nil {
+		out.Println("❌ Failed to load ATM list:", err)
+		slog.Error("inventory failed", "path", excelpath, "err", err)
+		os.Exit(1)
+	}
+	return machines
+}
+
+// confirm asks a yes/no question on stdin, defaulting to no; the prompt is
+// a message format
+func confirm(format string, args ...any) bool {
+	out.Printf(format, args...)
+	answer := strings.ToLower(readLine(bufio.NewReader(os.Stdin)))
+	return answer == "y" || answer == "yes"
+}
+
+func init() {
+	rootCmd.AddCommand(atmCmd)
+	atmCmd.AddCommand(atmListCmd, atmGetCmd, atmAddCmd, atmEditCmd, atmRenameCmd, atmRmCmd)
+	atmCmd.PersistentFlags().StringVarP(&excelpath, "path", "p", "atms.xlsx", "Path to Excel file")
+
+	atmListCmd.Flags().StringArrayVarP(&atmWhere, "where", "w", nil, "Selector field=value; repeat to narrow down")
+	atmListCmd.Flags().BoolVar(&atmJSON, "json", false, "Print JSON instead of a list")
+
+	atmGetCmd.Flags().BoolVar(&atmJSON, "json", false, "Print JSON instead of details")
+	atmGetCmd.Flags().StringVarP(&serviceFile, "file", "f", "services.json", "Path to services JSON file")
+
+	atmAddCmd.Flags().StringVar(&atmName, "name", "", "ATM name")
+	atmAddCmd.Flags().StringVar(&atmIP, "ip", "", "ATM address: IPv4, IPv6 or hostname")
+	atmAddCmd.Flags().StringVar(&atmRegion, "region", "", "Region the ATM belongs to")
+	atmAddCmd.Flags().StringArrayVar(&atmLinks, "link", nil, "Extra link name:role=address (roles: primary, backup, modem); repeatable")
+	atmAddCmd.Flags().StringVar(&atmMaint, "maintenance", "", `Put under maintenance: an expiry ("2026-11-01 18:00"), a reason, or "<reason> until <expiry>"`)
+	atmAddCmd.MarkFlagRequired("name")
+	atmAddCmd.MarkFlagRequired("ip")
+
+	atmEditCmd.Flags().StringVar(&atmName, "name", "", "New name")
+	atmEditCmd.Flags().StringVar(&atmIP, "ip", "", "New address: IPv4, IPv6 or hostname")
+	atmEditCmd.Flags().StringVar(&atmRegion, "region", "", "New region")
+	atmEditCmd.Flags().StringArrayVar(&atmLinks, "link", nil, "Replace the extra links with name:role=address; repeatable, --link \"\" clears them")
+	atmEditCmd.Flags().StringVar(&atmMaint, "maintenance", "", `Put under maintenance, as for add; --maintenance "" ends it`)
+
+	atmRmCmd.Flags().StringArrayVarP(&atmWhere, "where", "w", nil, "Selector field=value; repeat to narrow down")
+	atmRmCmd.Flags().BoolVar(&atmAll, "all", false, "Allow deleting more than one ATM")
+	atmRmCmd.Flags().BoolVarP(&atmYes, "yes", "y", false, "Do not ask for confirmation")
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fahmaliyi/atmer/internal/audit"
+	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditFile   string
+	auditEntity string
+	auditKey    string
+	auditUser   string
+	auditSince  string
+	auditUntil  string
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the log of changes to ATMs and service records",
+	Long: `Show who changed which ATM or service record, when, and how.
+
+Every add, edit and delete made through atmer is logged with the time,
+the OS user, the command and the values before and after the change.
+
+Times for --since and --until are either absolute (2006-01-02,
+"2006-01-02 15:04" or RFC 3339) or relative to now (90m, 24h, 7d).
+
+Examples:
+
+  atmer audit --entity atm --key "bole"
+  atmer audit --user alice --since 7d`,
+	Run: func(cmd *cobra.Command, args []string) {
+		filter := audit.Filter{Entity: auditEntity, Key: auditKey, User: auditUser}
+
+		var err error
+		if auditSince != "" {
+			if filter.Since, err = parseTime(auditSince); err != nil {
+				out.Printf("❌ Invalid --since: %s\n", err)
+				return
+			}
+		}
+		if auditUntil != "" {
+			if filter.Until, err = parseTime(auditUntil); err != nil {
+				out.Printf("❌ Invalid --until: %s\n", err)
+				return
+			}
+		}
+
+		entries, err := audit.Open(auditFile).Find(filter)
+		if err != nil {
+			out.Println("❌ Failed to load audit log:", err)
+			return
+		}
+		if len(entries) == 0 {
+			out.Println("❌ No matching changes found.")
+			return
+		}
+
+		cyan := color.New(color.FgCyan, color.Bold).SprintFunc()
+		red := color.New(color.FgRed).SprintFunc()
+		green := color.New(color.FgGreen).SprintFunc()
+
+		out.Printf("📜 %d change(s):\n\n", len(entries))
+		for _, e := range entries {
+			out.Printf("%s %s %s %s %s (%s)\n",
+				cyan(e.Time.Local().Format("2006-01-02 15:04:05")), e.User, e.Action, e.Entity, e.Key, e.Command)
+			for _, c := range e.Changes() {
+				out.Printf("   %s %s → %s\n", cyan(c.Field+":"), red(quoteEmpty(c.Old)), green(quoteEmpty(c.New)))
+			}
+		}
+	},
+}
+
+// recordAudit appends one change to the audit log; a failure to log is
+// reported but does not undo the change
+func recordAudit(cmd *cobra.Command, entity, action, key string, before, after any) {
+	entry := audit.NewEntry(cmd.CommandPath(), entity, action, key, before, after)
+	if err := audit.Open(auditFile).Append(entry); err != nil {
+		out.Println("⚠️ Failed to write audit log:", err)
+	}
+}
+
+// serviceKey identifies a service record in the audit log
+func serviceKey(r service.ServiceRecord) string {
+	ip := r.LANIP
+	if ip == "" {
+		ip = r.WANIP
+	}
+	return fmt.Sprintf("%s (%s)", r.Location, ip)
+}
+
+// parseTime accepts absolute timestamps and durations back from now
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil {
+			return time.Now().AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised time %q", s)
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	rootCmd.PersistentFlags().StringVar(&auditFile, "audit-log", "audit.jsonl", "Path to the audit log (JSON Lines)")
+
+	auditCmd.Flags().StringVar(&auditEntity, "entity", "", "Only changes to this kind of entity (atm, service)")
+	auditCmd.Flags().StringVarP(&auditKey, "key", "k", "", "Only changes to entities whose name contains this")
+	auditCmd.Flags().StringVarP(&auditUser, "user", "u", "", "Only changes made by this user")
+	auditCmd.Flags().StringVar(&auditSince, "since", "", "Only changes at or after this time")
+	auditCmd.Flags().StringVar(&auditUntil, "until", "", "Only changes at or before this time")
+}
@@ -0,0 +1,451 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/fahmaliyi/atmer/internal/storage"
+	"github.com/fahmaliyi/atmer/internal/utils"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bulkWhere        []string
+	bulkMap          []string
+	bulkFind         string
+	bulkReplace      string
+	bulkDryRun       bool
+	bulkYes          bool
+	bulkKeepServices bool
+)
+
+// errNoServiceChanges leaves services.json untouched when only the ATM list
+// changes
+var errNoServiceChanges = errors.New("no service record changes")
+
+var bulkCmd = &cobra.Command{
+	Use:   "bulk",
+	Short: "Re-address, rename or delete many ATMs and their circuits at once",
+	Long: `Change every ATM matching a selector in one go, together with the
+service records linked to them.
+
+Selectors are the same as for 'atmer atm' (--where name=Bole*,
+--where ip=10.20.0.0/16, --where region=South). The changes are shown as
+a diff first; --dry-run stops there, otherwise a confirmation is asked for
+unless --yes is given. The ATM list and services.json are written as one
+change: if either write fails both are put back, and 'atmer undo' reverts
+the whole operation. If the selected ATMs or their service records change
+while the confirmation is pending, nothing is written.
+
+Examples:
+
+  atmer bulk readdress --map 10.20.0.0/16=10.40.0.0/16 --dry-run
+  atmer bulk rename --where region=South --find '^ATM-' --replace 'STH-'
+  atmer bulk rm --where name=Old* --yes`,
+}
+
+var bulkReaddressCmd = &cobra.Command{
+	Use:   "readdress",
+	Short: "Move ATMs and their circuits to new subnets",
+	Long: `Move IPs from one subnet to another of the same size, keeping the host
+part: with --map 10.20.0.0/16=10.40.0.0/16, 10.20.3.7 becomes 10.40.3.7.
+Repeat --map for several subnets. Backup and modem links move along with
+the ATM's IP, and the LAN and WAN IPs of linked service records are moved
+too when they fall in a mapped subnet.
+
+Without --where, every ATM inside one of the old subnets is selected.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(bulkMap) == 0 {
+			out.Println("❌ Give at least one --map OLD=NEW")
+			os.Exit(1)
+		}
+		var maps []service.SubnetMap
+		for _, s := range bulkMap {
+			m, err := service.ParseSubnetMap(s)
+			if err != nil {
+				out.Printf("❌ %s\n", err)
+				os.Exit(1)
+			}
+			maps = append(maps, m)
+		}
+
+		selector := func(m service.Machine) bool {
+			for _, sm := range maps {
+				if sm.Contains(m.IP) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(bulkWhere) > 0 {
+			selector = bulkSelector()
+		}
+
+		runBulk(cmd, "Re-addressed", selector, bulkOp{
+			machine: func(m service.Machine) (*service.Machine, error) {
+				m.IP = service.RemapAddrs(maps, m.IP)
+				m.Links = slices.Clone(m.Links)
+				for i := range m.Links {
+					m.Links[i].Address = service.RemapAddrs(maps, m.Links[i].Address)
+				}
+				return &m, nil
+			},
+			record: func(_ service.Machine, _ *service.Machine, r service.ServiceRecord) *service.ServiceRecord {
+				r.LANIP = service.RemapAddrs(maps, r.LANIP)
+				r.WANIP = service.RemapAddrs(maps, r.WANIP)
+				return &r
+			},
+		})
+	},
+}
+
+var bulkRenameCmd = &cobra.Command{
+	Use:   "rename",
+	Short: "Rename ATMs with a regular expression",
+	Long: `Rename the selected ATMs by replacing --find, a regular expression, with
+--replace in each name. The replacement may refer to groups as $1, $2 or
+${name}. Linked service records whose location is the old name follow
+the rename.
+
+Example:
+
+  atmer bulk rename --where name=ATM-* --find '^ATM-(.*)$' --replace '$1 ATM'`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if bulkFind == "" {
+			out.Println("❌ Give the pattern to replace with --find")
+			os.Exit(1)
+		}
+		re, err := regexp.Compile(bulkFind)
+		if err != nil {
+			out.Printf("❌ Invalid --find: %s\n", err)
+			os.Exit(1)
+		}
+
+		runBulk(cmd, "Renamed", bulkSelector(), bulkOp{
+			machine: func(m service.Machine) (*service.Machine, error) {
+				m.Name = strings.TrimSpace(re.ReplaceAllString(m.Name, bulkReplace))
+				return &m, nil
+			},
+			record: func(before service.Machine, after *service.Machine, r service.ServiceRecord) *service.ServiceRecord {
+				if strings.EqualFold(strings.TrimSpace(r.Location), before.Name) {
+					r.Location = after.Name
+				}
+				return &r
+			},
+		})
+	},
+}
+
+var bulkRmCmd = &cobra.Command{
+	Use:     "rm",
+	Aliases: []string{"remove", "delete"},
+	Short:   "Delete ATMs and their service records",
+	Long: `Delete the selected ATMs together with their linked service records.
+Use --keep-services to leave services.json alone.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runBulk(cmd, "Deleted", bulkSelector(), bulkOp{
+			machine: func(service.Machine) (*service.Machine, error) { return nil, nil },
+			record: func(_ service.Machine, _ *service.Machine, r service.ServiceRecord) *service.ServiceRecord {
+				if bulkKeepServices {
+					return &r
+				}
+				return nil
+			},
+		})
+	},
+}
+
+// bulkOp says what a bulk command does to each selected ATM and to the
+// service record linked to it; a nil result deletes
+type bulkOp struct {
+	machine func(m service.Machine) (*service.Machine, error)
+	record  func(before service.Machine, after *service.Machine, r service.ServiceRecord) *service.ServiceRecord
+}
+
+// bulkEntry is the change to one ATM and its linked service record, if any
+type bulkEntry struct {
+	machine service.MachineChange
+	record  *recordChange
+}
+
+type recordChange struct {
+	Before *service.ServiceRecord
+	After  *service.ServiceRecord
+}
+
+// bulkPlan is the outcome of a bulk command: the new ATM list and service
+// records and what changed between them and the old ones
+type bulkPlan struct {
+	machines []service.Machine
+	records  []service.ServiceRecord
+	entries  []bulkEntry
+}
+
+func (p bulkPlan) counts() (machines, records int) {
+	for _, e := range p.entries {
+		machines++
+		if e.record != nil {
+			records++
+		}
+	}
+	return machines, records
+}
+
+// sameChanges reports whether p makes the same changes as o
+func (p bulkPlan) sameChanges(o bulkPlan) bool {
+	return slices.EqualFunc(p.entries, o.entries, func(a, b bulkEntry) bool {
+		return sameMachine(a.machine.Before, b.machine.Before) && sameMachine(a.machine.After, b.machine.After) &&
+			(a.record == nil) == (b.record == nil) &&
+			(a.record == nil || sameRecord(a.record.Before, b.record.Before) && sameRecord(a.record.After, b.record.After))
+	})
+}
+
+func sameMachine(a, b *service.Machine) bool {
+	return a == nil && b == nil || a != nil && b != nil && a.Equal(*b)
+}
+
+func sameRecord(a, b *service.ServiceRecord) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+// bulkSelector compiles --where, which every bulk command but readdress
+// requires
+func bulkSelector() func(service.Machine) bool {
+	selector, err := parseWhere(service.MachineSchema, bulkWhere)
+	if err != nil {
+		out.Printf("❌ %s\n", err)
+		os.Exit(1)
+	}
+	return selector.Match
+}
+
+// planBulk applies op to the ATMs matching selector and to their linked
+// service records, and validates the resulting ATM list
+func planBulk(machines []service.Machine, records []service.ServiceRecord, selector func(service.Machine) bool, op bulkOp) (bulkPlan, error) {
+	recordIndex := make(map[*service.ServiceRecord]int, len(records))
+	for j := range records {
+		recordIndex[&records[j]] = j
+	}
+	sites := service.LinkSites(machines, records, nil)
+
+	plan := bulkPlan{records: append([]service.ServiceRecord(nil), records...)}
+	dropped := map[int]bool{}
+	var edited []int // positions in plan.machines of changed ATMs
+	for i, m := range machines {
+		if !selector(m) {
+			plan.machines = append(plan.machines, m)
+			continue
+		}
+
+		after, err := op.machine(m)
+		if err != nil {
+			return bulkPlan{}, fmt.Errorf("%s: %w", m.Name, err)
+		}
+		if after != nil {
+			plan.machines = append(plan.machines, *after)
+			if after.Equal(m) {
+				continue
+			}
+			edited = append(edited, len(plan.machines)-1)
+		}
+
+		before := m
+		entry := bulkEntry{machine: service.MachineChange{Before: &before, After: after}}
+		if r := sites[i].Record; r != nil {
+			j := recordIndex[r]
+			next := op.record(m, after, *r)
+			switch {
+			case next == nil:
+				dropped[j] = true
+				entry.record = &recordChange{Before: r}
+			case *next != *r:
+				plan.records[j] = *next
+				entry.record = &recordChange{Before: r, After: next}
+			}
+		}
+		plan.entries = append(plan.entries, entry)
+	}
+
+	if len(dropped) > 0 {
+		kept := plan.records[:0]
+		for j, r := range plan.records {
+			if !dropped[j] {
+				kept = append(kept, r)
+			}
+		}
+		plan.records = kept
+	}
+
+	for _, k := range edited {
+		others := append(append([]service.Machine(nil), plan.machines[:k]...), plan.machines[k+1:]...)
+		if err := validateMachine(plan.machines[k], others); err != nil {
+			return bulkPlan{}, err
+		}
+	}
+	return plan, nil
+}
+
+// runBulk previews a bulk change, asks for confirmation and then writes the
+// ATM list and service records as one transaction
+func runBulk(cmd *cobra.Command, verb string, selector func(service.Machine) bool, op bulkOp) {
+	machines := loadMachinesOrExit()
+	store := openServices(serviceFile)
+	records, err := store.Load()
+	if err != nil && !os.IsNotExist(err) {
+		printServiceError("Failed to load services", err)
+		os.Exit(1)
+	}
+
+	plan, err := planBulk(machines, records, selector, op)
+	if err != nil {
+		out.Printf("❌ %s\n", err)
+		os.Exit(1)
+	}
+	if len(plan.entries) == 0 {
+		out.Println("❌ No ATMs to change")
+		os.Exit(1)
+	}
+
+	printBulkPlan(plan)
+	if bulkDryRun {
+		out.Println("🔍 Dry run, nothing written.")
+		return
+	}
+	nm, nr := plan.counts()
+	if !bulkYes && !confirm("❓ Apply to %d ATM(s) and %d service record(s) (y/N): ", nm, nr) {
+		out.Println("🚫 Cancelled")
+		return
+	}
+
+	summary := fmt.Sprintf("%s %d ATM(s) and %d service record(s)", verb, nm, nr)
+	if err := applyBulk(cmd, summary, plan, selector, op); err != nil {
+		if errors.Is(err, errChanged) {
+			out.Println("❌ The selected ATMs or their records changed while you confirmed; nothing was changed. Re-run the command.")
+		} else {
+			out.Println("❌ Failed to apply changes, nothing was changed:", err)
+		}
+		os.Exit(1)
+	}
+
+	for _, e := range plan.entries {
+		c := e.machine
+		if c.After == nil {
+			recordAudit(cmd, "atm", "delete", c.Before.Name, c.Before, nil)
+		} else {
+			recordAudit(cmd, "atm", "edit", c.Before.Name, c.Before, c.After)
+		}
+		if rc := e.record; rc != nil {
+			if rc.After == nil {
+				recordAudit(cmd, "service", "delete", serviceKey(*rc.Before), rc.Before, nil)
+			} else {
+				recordAudit(cmd, "service", "edit", serviceKey(*rc.Before), rc.Before, rc.After)
+			}
+		}
+	}
+	out.Printf("✅ %s\n", summary)
+}
+
+// applyBulk writes a confirmed plan as one transaction. Both files are
+// locked and read again first, and the plan is made again from them, so
+// changes made by others meanwhile are kept; if the plan no longer makes
+// the changes that were confirmed, nothing is written and errChanged is
+// returned.
+func applyBulk(cmd *cobra.Command, summary string, plan bulkPlan, selector func(service.Machine) bool, op bulkOp) error {
+	unlock, err := storage.LockAll(excelpath, serviceFile)
+	if err != nil {
+		return fmt.Errorf("failed to lock: %w", err)
+	}
+	defer unlock()
+
+	machines, err := utils.LoadMachines(excelpath)
+	if err != nil {
+		return err
+	}
+	done := func(error) {}
+	err = openServices(serviceFile).ModifyLocked(func(records []service.ServiceRecord) ([]service.ServiceRecord, error) {
+		current, err := planBulk(machines, records, selector, op)
+		if err != nil {
+			return nil, err
+		}
+		if !current.sameChanges(plan) {
+			return nil, errChanged
+		}
+
+		rollback, err := beginTransaction(cmd, summary, excelpath, serviceFile)
+		if err != nil {
+			return nil, err
+		}
+		done = rollback
+		if err := utils.SaveMachines(current.machines, excelpath); err != nil {
+			return nil, err
+		}
+		if _, nr := current.counts(); nr == 0 {
+			return nil, errNoServiceChanges
+		}
+		return current.records, nil
+	})
+	if errors.Is(err, errNoServiceChanges) {
+		err = nil
+	}
+	// rolled back under the locks, so nobody sees the half-made change
+	done(err)
+	return err
+}
+
+func printBulkPlan(plan bulkPlan) {
+	cyan := color.New(color.FgCyan, color.Bold).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+
+	printChanges := func(changes []service.Change) {
+		for _, c := range changes {
+			out.Printf("   %s %s → %s\n", cyan(c.Field+":"), red(quoteEmpty(c.Old)), green(quoteEmpty(c.New)))
+		}
+	}
+
+	for _, e := range plan.entries {
+		m := e.machine
+		if m.After == nil {
+			out.Printf("🗑️ %s (%s)\n", m.Before.Name, m.Before.IP)
+		} else {
+			out.Printf("✏️ %s\n", m.Before.Name)
+			printChanges(service.MachineChanges(*m.Before, *m.After))
+		}
+
+		if rc := e.record; rc != nil {
+			if rc.After == nil {
+				out.Printf("   🗑️ service record %s\n", serviceKey(*rc.Before))
+			} else {
+				out.Printf("   📡 service record %s\n", serviceKey(*rc.Before))
+				for _, c := range service.ServiceChanges(*rc.Before, *rc.After) {
+					out.Printf("      %s %s → %s\n", cyan(c.Field+":"), red(quoteEmpty(c.Old)), green(quoteEmpty(c.New)))
+				}
+			}
+		}
+	}
+	out.Println()
+}
+
+func init() {
+	rootCmd.AddCommand(bulkCmd)
+	bulkCmd.AddCommand(bulkReaddressCmd, bulkRenameCmd, bulkRmCmd)
+	bulkCmd.PersistentFlags().StringVarP(&excelpath, "path", "p", "atms.xlsx", "Path to Excel file")
+	bulkCmd.PersistentFlags().StringVarP(&serviceFile, "file", "f", "services.json", "Path to services JSON file")
+	bulkCmd.PersistentFlags().StringArrayVarP(&bulkWhere, "where", "w", nil, "Selector field=value; repeat to narrow down")
+	bulkCmd.PersistentFlags().BoolVar(&bulkDryRun, "dry-run", false, "Show the diff without writing")
+	bulkCmd.PersistentFlags().BoolVarP(&bulkYes, "yes", "y", false, "Do not ask for confirmation")
+
+	bulkReaddressCmd.Flags().StringArrayVar(&bulkMap, "map", nil, "Subnet mapping OLD=NEW, e.g. 10.20.0.0/16=10.40.0.0/16; repeatable")
+	bulkRenameCmd.Flags().StringVar(&bulkFind, "find", "", "Regular expression to replace in each name")
+	bulkRenameCmd.Flags().StringVar(&bulkReplace, "replace", "", "Replacement; $1 refers to the first group")
+	bulkRmCmd.Flags().BoolVar(&bulkKeepServices, "keep-services", false, "Keep the linked service records")
+}
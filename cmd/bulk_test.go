@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/fahmaliyi/atmer/internal/utils"
+)
+
+// useServices points the services file at a temporary file holding records
+func useServices(t *testing.T, records []service.ServiceRecord) {
+	t.Helper()
+	saved := serviceFile
+	t.Cleanup(func() { serviceFile = saved })
+	serviceFile = filepath.Join(t.TempDir(), "services.json")
+	if err := openServices(serviceFile).Save(records); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// renameOp renames ATMs starting with Bole to Bole Main, and their circuits
+var renameOp = bulkOp{
+	machine: func(m service.Machine) (*service.Machine, error) {
+		m.Name = strings.Replace(m.Name, "Bole", "Bole Main", 1)
+		return &m, nil
+	},
+	record: func(before service.Machine, after *service.Machine, r service.ServiceRecord) *service.ServiceRecord {
+		r.Location = after.Name
+		return &r
+	},
+}
+
+func isBole(m service.Machine) bool { return strings.HasPrefix(m.Name, "Bole") }
+
+// planned makes the plan a user confirms, from the files as they are now
+func planned(t *testing.T) bulkPlan {
+	t.Helper()
+	machines, err := utils.LoadMachines(excelpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := openServices(serviceFile).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := planBulk(machines, records, isBole, renameOp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+func serviceLocations(t *testing.T) string {
+	t.Helper()
+	records, err := openServices(serviceFile).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var locations []string
+	for _, r := range records {
+		locations = append(locations, r.Location)
+	}
+	return strings.Join(locations, ", ")
+}
+
+func TestApplyBulkKeepsConcurrentChanges(t *testing.T) {
+	bole := service.Machine{Name: "Bole", IP: "10.20.1.10"}
+	piassa := service.Machine{Name: "Piassa", IP: "10.20.2.10"}
+	useInventory(t, []service.Machine{bole, piassa})
+	useServices(t, []service.ServiceRecord{{Location: "Bole", LANIP: "10.20.1.10"}})
+	plan := planned(t)
+
+	// others add an ATM and a circuit while the diff is on screen
+	if err := utils.SaveMachines([]service.Machine{bole, piassa, {Name: "Kality", IP: "10.20.3.10"}}, excelpath); err != nil {
+		t.Fatal(err)
+	}
+	if err := openServices(serviceFile).Modify(func(records []service.ServiceRecord) ([]service.ServiceRecord, error) {
+		return append(records, service.ServiceRecord{Location: "Kality", LANIP: "10.20.3.10"}), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyBulk(bulkRenameCmd, "Renamed 1 ATM(s)", plan, isBole, renameOp); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := inventoryNames(t), "Bole Main 10.20.1.10, Piassa 10.20.2.10, Kality 10.20.3.10"; got != want {
+		t.Errorf("ATMs = %q, want %q", got, want)
+	}
+	if got, want := serviceLocations(t), "Bole Main, Kality"; got != want {
+		t.Errorf("services = %q, want %q", got, want)
+	}
+}
+
+func TestApplyBulkRefusesChangedSelection(t *testing.T) {
+	useInventory(t, []service.Machine{{Name: "Bole", IP: "10.20.1.10"}})
+	useServices(t, []service.ServiceRecord{{Location: "Bole", LANIP: "10.20.1.10"}})
+	plan := planned(t)
+
+	// another ATM now matches the selector
+	if err := utils.SaveMachines([]service.Machine{{Name: "Bole", IP: "10.20.1.10"}, {Name: "Bole 2", IP: "10.20.9.10"}}, excelpath); err != nil {
+		t.Fatal(err)
+	}
+	before := inventoryNames(t)
+
+	err := applyBulk(bulkRenameCmd, "Renamed 1 ATM(s)", plan, isBole, renameOp)
+	if !errors.Is(err, errChanged) {
+		t.Fatalf("err = %v, want errChanged", err)
+	}
+	if got := inventoryNames(t); got != before {
+		t.Errorf("ATMs changed to %q", got)
+	}
+	if got := serviceLocations(t); got != "Bole" {
+		t.Errorf("services changed to %q", got)
+	}
+}
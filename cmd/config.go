@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/fahmaliyi/atmer/internal/config"
+)
+
+var configFile string
+
+// loadConfig reads --config or exits
+func loadConfig() *config.Config {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		out.Println("❌", err)
+		slog.Error("config failed", "path", configFile, "err", err)
+		os.Exit(1)
+	}
+	return cfg
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", config.DefaultPath, "Path to the atmer config file")
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	logLevel  string
+	logFormat string
+	logFile   string
+)
+
+// setupLogging installs the structured logger. Logs are off unless
+// --log-level or --log-file is given, and go to stderr or the log file so
+// they never mix with the report on stdout.
+func setupLogging(cmd *cobra.Command, args []string) {
+	if logLevel == "" && logFile == "" {
+		slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+		return
+	}
+
+	level, err := parseLogLevel(logLevel)
+	if err != nil {
+		out.Println("❌", err)
+		os.Exit(1)
+	}
+
+	var w io.Writer = os.Stderr
+	if logFile != "" {
+		// left open for the life of the process
+		f, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			out.Println("❌ Failed to open log file:", err)
+			os.Exit(1)
+		}
+		w = f
+	}
+
+	hopts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch strings.ToLower(logFormat) {
+	case "text":
+		h = slog.NewTextHandler(w, hopts)
+	case "json":
+		h = slog.NewJSONHandler(w, hopts)
+	default:
+		out.Printf("❌ Unknown log format %q, expected text or json\n", logFormat)
+		os.Exit(1)
+	}
+	slog.SetDefault(slog.New(h).With("cli", cmd.CommandPath()))
+}
+
+// parseLogLevel reads --log-level; empty means info
+func parseLogLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", s)
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "", "Log level: debug, info, warn or error (default off, info with --log-file)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Log format: text or json")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Append logs to this file instead of stderr")
+}
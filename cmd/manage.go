@@ -3,225 +3,176 @@ package cmd
 import (
 	"bufio"
 	"fmt"
+	"log/slog"
 	"os"
-	"regexp"
-	"strconv"
+	"slices"
 	"strings"
 
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/fahmaliyi/atmer/internal/storage"
+	"github.com/fahmaliyi/atmer/internal/tui"
 	"github.com/fahmaliyi/atmer/internal/utils"
 	"github.com/spf13/cobra"
 )
 
 var manageCmd = &cobra.Command{
 	Use:   "manage",
-	Short: "Interactive menu to view, search, add, edit, or delete ATMs",
+	Short: "Full-screen manager to browse, filter, ping, add, edit, or delete ATMs",
+	Long: `Open a full-screen manager for the ATM list.
+
+Keys:
+  ↑/↓ j/k      move           /        filter by name or IP
+  space        select         a        add an ATM
+  e, enter     edit name/IP   d        delete selected (or current)
+  p            ping current   P        ping selected (or current)
+  esc          clear filter   q        quit
+
+The panel on the right shows the service record linked to the current ATM.
+Every change is saved immediately and can be reverted with 'atmer undo'.
+Changes made meanwhile by other atmer commands are kept and shown after the
+next save; editing or deleting an ATM someone else changed is refused.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		reader := bufio.NewReader(os.Stdin)
-
-		for {
-			machines, err := utils.LoadMachines(excelpath)
-			if err != nil {
-				fmt.Println("❌ Failed to load ATM list:", err)
-				os.Exit(1)
-			}
-
-			fmt.Println("\n🔧 ATM Manager")
-			fmt.Println("1. View all ATMs")
-			fmt.Println("2. Search ATM by name")
-			fmt.Println("3. Add new ATM")
-			fmt.Println("4. Edit ATM IP")
-			fmt.Println("5. Delete ATM")
-			fmt.Println("6. Exit")
-			fmt.Print("👉 Select an option (1-6): ")
-
-			choice := readLine(reader)
-			fmt.Println()
-
-			switch choice {
-			case "1":
-				fmt.Printf("📄 Total ATMs: %d\n", len(machines))
-				for i, m := range machines {
-					fmt.Printf("%d. %s (%s)\n", i+1, m.Name, m.IP)
-				}
-
-			case "2":
-				fmt.Print("🔍 Enter part of the ATM name: ")
-				query := strings.ToLower(readLine(reader))
-				var matches []service.Machine
-				for _, m := range machines {
-					if strings.Contains(strings.ToLower(m.Name), query) {
-						matches = append(matches, m)
-					}
-				}
-				if len(matches) == 0 {
-					fmt.Println("❌ No matching ATMs found")
-					break
-				}
-				fmt.Println("🔎 Matching ATMs:")
-				for i, m := range matches {
-					fmt.Printf("%d. %s (%s)\n", i+1, m.Name, m.IP)
-				}
-
-			case "3":
-				fmt.Print("➕ Enter ATM name: ")
-				name := readLine(reader)
-				for _, m := range machines {
-					if strings.EqualFold(m.Name, name) {
-						fmt.Println("❌ ATM already exists")
-						goto Menu
-					}
-				}
-				var ip string
-				for {
-					fmt.Print("🔌 Enter ATM IP address: ")
-					ip = readLine(reader)
-					if isValidIP(ip) {
-						break
-					}
-					fmt.Println("❌ Invalid IP format. Try again.")
-				}
-				machines = append(machines, service.Machine{Name: name, IP: ip})
-				err := utils.SaveMachines(machines, excelpath)
-				if err != nil {
-					fmt.Println("❌ Failed to add ATM:", err)
-				} else {
-					fmt.Println("✅ ATM added")
-				}
+		machines, err := utils.LoadMachines(excelpath)
+		if err != nil {
+			out.Println("❌ Failed to load ATM list:", err)
+			os.Exit(1)
+		}
 
-			case "4":
-				fmt.Print("✏️ Enter part of ATM name to edit: ")
-				query := strings.ToLower(readLine(reader))
-				var matches []int
-				for i, m := range machines {
-					if strings.Contains(strings.ToLower(m.Name), query) {
-						matches = append(matches, i)
-					}
-				}
-				if len(matches) == 0 {
-					fmt.Println("❌ No matching ATMs found")
-					break
-				}
-				fmt.Println("🔎 Matching ATMs:")
-				for idx, mi := range matches {
-					m := machines[mi]
-					fmt.Printf("%d. %s (%s)\n", idx+1, m.Name, m.IP)
-				}
+		records, err := openServices(serviceFile).Load()
+		if err != nil && !os.IsNotExist(err) {
+			printServiceError("Failed to load services", err)
+		}
 
-				var selected int
-				for {
-					fmt.Print("➡️ Select number to edit (or 'q' to cancel): ")
-					input := readLine(reader)
-					if input == "q" {
-						fmt.Println("🚫 Cancelled")
-						goto Menu
-					}
-					selectedIdx, err := strconv.Atoi(input)
-					if err == nil && selectedIdx > 0 && selectedIdx <= len(matches) {
-						selected = matches[selectedIdx-1]
-						break
-					}
-					fmt.Println("❌ Invalid selection.")
-				}
+		model := tui.New(tui.Options{
+			Machines: machines,
+			Records:  records,
+			Validate: validateMachine,
+			Probe:    service.Probe,
+			Save: func(summary string, changes []service.MachineChange) ([]service.Machine, error) {
+				return commitMachines(cmd, applyChanges(summary, changes))
+			},
+		})
+
+		if _, err := tea.NewProgram(model, tea.WithAltScreen()).Run(); err != nil {
+			out.Println("❌ ATM Manager failed:", err)
+			os.Exit(1)
+		}
+	},
+}
 
-				fmt.Printf("✏️ Current IP: %s\n", machines[selected].IP)
-				var newIP string
-				for {
-					fmt.Print("🔄 Enter new IP address: ")
-					newIP = readLine(reader)
-					if isValidIP(newIP) {
-						break
-					}
-					fmt.Println("❌ Invalid IP format.")
-				}
-				machines[selected].IP = newIP
-				err := utils.SaveMachines(machines, excelpath)
-				if err != nil {
-					fmt.Println("❌ Failed to save changes:", err)
-				} else {
-					fmt.Println("✅ ATM updated")
-				}
+func init() {
+	rootCmd.AddCommand(manageCmd)
+	manageCmd.Flags().StringVarP(&excelpath, "path", "p", "atms.xlsx", "Path to Excel file")
+	manageCmd.Flags().StringVarP(&serviceFile, "file", "f", "services.json", "Path to services JSON file")
+}
 
-			case "5":
-				fmt.Print("🗑️ Enter part of ATM name to delete: ")
-				query := strings.ToLower(readLine(reader))
-				var matches []int
-				for i, m := range machines {
-					if strings.Contains(strings.ToLower(m.Name), query) {
-						matches = append(matches, i)
-					}
-				}
-				if len(matches) == 0 {
-					fmt.Println("❌ No matching ATMs found")
-					break
-				}
-				fmt.Println("🔎 Matching ATMs:")
-				for idx, mi := range matches {
-					m := machines[mi]
-					fmt.Printf("%d. %s (%s)\n", idx+1, m.Name, m.IP)
-				}
+// machineEdit is a change to the ATM list: the list after it, a summary
+// for the version kept for undo, and the changed ATMs for the audit log
+type machineEdit struct {
+	Next    []service.Machine
+	Summary string
+	Changes []service.MachineChange
+}
 
-				var selected int
-				for {
-					fmt.Print("➡️ Select number to delete (or 'q' to cancel): ")
-					input := readLine(reader)
-					if input == "q" {
-						fmt.Println("🚫 Cancelled")
-						goto Menu
-					}
-					selectedIdx, err := strconv.Atoi(input)
-					if err == nil && selectedIdx > 0 && selectedIdx <= len(matches) {
-						selected = matches[selectedIdx-1]
-						break
-					}
-					fmt.Println("❌ Invalid selection.")
-				}
+// commitMachines locks the ATM list, loads it, passes it to edit and saves
+// the result, keeping a version for undo and an audit entry per changed
+// ATM. Changes made by other processes before the lock are seen by edit,
+// so none are lost; if edit fails nothing is written.
+func commitMachines(cmd *cobra.Command, edit func(machines []service.Machine) (machineEdit, error)) ([]service.Machine, error) {
+	unlock, err := storage.Lock(excelpath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	machines, err := utils.LoadMachines(excelpath)
+	if err != nil {
+		return nil, err
+	}
+	e, err := edit(machines)
+	if err != nil {
+		return nil, err
+	}
+
+	// snapshot and save under the lock, so a restore cannot slip in between
+	done := beginChange(cmd, e.Summary, excelpath)
+	err = utils.SaveMachines(e.Next, excelpath)
+	done(err)
+	if err != nil {
+		slog.Error("inventory save failed", "path", excelpath, "err", err)
+		return nil, err
+	}
+	slog.Info("inventory saved", "path", excelpath, "atms", len(e.Next), "changes", len(e.Changes), "summary", e.Summary)
+
+	for _, c := range e.Changes {
+		switch {
+		case c.Before == nil:
+			recordAudit(cmd, "atm", "add", c.After.Name, nil, c.After)
+		case c.After == nil:
+			recordAudit(cmd, "atm", "delete", c.Before.Name, c.Before, nil)
+		default:
+			recordAudit(cmd, "atm", "edit", c.Before.Name, c.Before, c.After)
+		}
+	}
+	return e.Next, nil
+}
 
-				target := machines[selected]
-				fmt.Printf("❓ Confirm delete '%s' (y/N): ", target.Name)
-				confirm := strings.ToLower(readLine(reader))
-				if confirm != "y" && confirm != "yes" {
-					fmt.Println("🚫 Cancelled")
-					break
+// applyChanges returns an edit for commitMachines making changes to the
+// list as it is when saved. ATMs are found by name and must still be as
+// they were before the change; other ATMs are left as they are, whoever
+// changed them.
+func applyChanges(summary string, changes []service.MachineChange) func([]service.Machine) (machineEdit, error) {
+	return func(machines []service.Machine) (machineEdit, error) {
+		next := append([]service.Machine(nil), machines...)
+		for _, c := range changes {
+			i := -1
+			if c.Before != nil {
+				if i = findMachine(next, c.Before.Name); i < 0 {
+					return machineEdit{}, fmt.Errorf("ATM %s was deleted meanwhile", c.Before.Name)
+				}
+				if !next[i].Equal(*c.Before) {
+					return machineEdit{}, fmt.Errorf("ATM %s was changed meanwhile", c.Before.Name)
 				}
+			}
 
-				newList := append(machines[:selected], machines[selected+1:]...)
-				err := utils.SaveMachines(newList, excelpath)
-				if err != nil {
-					fmt.Println("❌ Failed to delete ATM:", err)
-				} else {
-					fmt.Println("✅ ATM deleted")
+			switch {
+			case c.After == nil:
+				next = slices.Delete(next, i, i+1)
+			case i < 0:
+				if err := validateMachine(*c.After, next); err != nil {
+					return machineEdit{}, err
 				}
-
-			case "6":
-				fmt.Println("👋 Exiting ATM Manager.")
-				return
-
+				next = append(next, *c.After)
 			default:
-				fmt.Println("❌ Invalid option")
+				others := slices.Delete(slices.Clone(next), i, i+1)
+				if err := validateMachine(*c.After, others); err != nil {
+					return machineEdit{}, err
+				}
+				next[i] = *c.After
 			}
-
-		Menu:
-			fmt.Print("\n🔁 Press Enter to return to the menu...")
-			readLine(reader)
-			fmt.Println()
 		}
-	},
+		return machineEdit{Next: next, Summary: summary, Changes: changes}, nil
+	}
 }
 
-func init() {
-	rootCmd.AddCommand(manageCmd)
-	manageCmd.Flags().StringVarP(&excelpath, "path", "p", "atms.xlsx", "Path to Excel file")
+// validateMachine checks a new or edited ATM against the rest of the list
+func validateMachine(m service.Machine, others []service.Machine) error {
+	if strings.TrimSpace(m.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if err := service.ValidateAddress(m.IP); err != nil {
+		return err
+	}
+	for _, o := range others {
+		if strings.EqualFold(o.Name, m.Name) {
+			return fmt.Errorf("ATM %s already exists", o.Name)
+		}
+	}
+	return nil
 }
 
 func readLine(reader *bufio.Reader) string {
 	input, _ := reader.ReadString('\n')
 	return strings.TrimSpace(input)
 }
-
-func isValidIP(ip string) bool {
-	regex := `^((25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\.){3}` +
-		`(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)$`
-	match, _ := regexp.MatchString(regex, ip)
-	return match
-}
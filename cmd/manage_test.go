@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/fahmaliyi/atmer/internal/utils"
+)
+
+// useInventory points the ATM list, snapshots and audit log at a temporary
+// directory holding machines
+func useInventory(t *testing.T, machines []service.Machine) {
+	t.Helper()
+	dir := t.TempDir()
+	saved := [3]string{excelpath, snapshotDir, auditFile}
+	t.Cleanup(func() { excelpath, snapshotDir, auditFile = saved[0], saved[1], saved[2] })
+	excelpath = filepath.Join(dir, "atms.xlsx")
+	snapshotDir = filepath.Join(dir, "snapshots")
+	auditFile = filepath.Join(dir, "audit.jsonl")
+
+	if err := utils.SaveMachines(machines, excelpath); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func inventoryNames(t *testing.T) string {
+	t.Helper()
+	machines, err := utils.LoadMachines(excelpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, m := range machines {
+		names = append(names, m.Name+" "+m.IP)
+	}
+	return strings.Join(names, ", ")
+}
+
+func TestCommitMachinesKeepsConcurrentChanges(t *testing.T) {
+	bole := service.Machine{Name: "Bole", IP: "10.20.1.10"}
+	piassa := service.Machine{Name: "Piassa", IP: "10.20.2.10"}
+	useInventory(t, []service.Machine{bole, piassa})
+
+	// another process adds an ATM after this one loaded the list
+	if err := utils.SaveMachines([]service.Machine{bole, piassa, {Name: "Kality", IP: "10.20.3.10"}}, excelpath); err != nil {
+		t.Fatal(err)
+	}
+
+	after := bole
+	after.IP = "10.20.1.20"
+	changes := []service.MachineChange{{Before: &bole, After: &after}, {Before: &piassa}}
+	next, err := commitMachines(atmEditCmd, applyChanges("Edited ATM Bole", changes))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Bole 10.20.1.20, Kality 10.20.3.10"
+	if got := inventoryNames(t); got != want {
+		t.Errorf("saved %q, want %q", got, want)
+	}
+	if len(next) != 2 {
+		t.Errorf("returned %d ATMs, want the 2 saved", len(next))
+	}
+}
+
+func TestCommitMachinesRefusesConflicts(t *testing.T) {
+	bole := service.Machine{Name: "Bole", IP: "10.20.1.10"}
+	edited := service.Machine{Name: "Bole", IP: "10.20.1.20"}
+	piassa := service.Machine{Name: "Piassa", IP: "10.20.2.10"}
+
+	for _, c := range []struct {
+		name    string
+		current []service.Machine // the list when saved
+		change  service.MachineChange
+		want    string
+	}{
+		{"edited meanwhile", []service.Machine{edited}, service.MachineChange{Before: &bole, After: &service.Machine{Name: "Bole", IP: "10.20.1.30"}}, "changed meanwhile"},
+		{"deleted meanwhile", []service.Machine{piassa}, service.MachineChange{Before: &bole}, "deleted meanwhile"},
+		{"added meanwhile", []service.Machine{bole, piassa}, service.MachineChange{After: &service.Machine{Name: "piassa", IP: "10.20.2.20"}}, "already exists"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			useInventory(t, c.current)
+			before := inventoryNames(t)
+
+			_, err := commitMachines(atmEditCmd, applyChanges(c.name, []service.MachineChange{c.change}))
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("err = %v, want %q", err, c.want)
+			}
+			if got := inventoryNames(t); got != before {
+				t.Errorf("the list changed to %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/fahmaliyi/atmer/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateFile   string
+	migrateDryRun bool
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Convert a services file to the current schema version",
+	Long: `Convert a services file written by an older atmer to the current schema.
+
+Legacy files are a bare JSON array whose bandwidth, service and account
+numbers may be either strings or numbers. Migration keeps every digit of
+those identifiers, turns bandwidths into values with units (bare numbers
+are taken as Mbps) and adds a version header. The original file is kept
+next to the new one with a .v<version>.bak suffix.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if migrateDryRun {
+			data, err := openServices(migrateFile).Raw()
+			if err != nil {
+				out.Printf("❌ Failed to read services: %s\n", err)
+				return
+			}
+			version, err := storage.FileVersion(data)
+			if err != nil {
+				out.Printf("❌ Failed to read services: %s\n", err)
+				return
+			}
+			if version == service.ServicesVersion {
+				out.Printf("✅ %s is already at schema version %d\n", migrateFile, version)
+				return
+			}
+
+			records, issues, err := service.MigrateServices(data)
+			if err != nil {
+				out.Printf("❌ Failed to migrate services: %s\n", err)
+				return
+			}
+			out.Printf("🔍 Would migrate %d record(s) from schema version %d to %d\n", len(records), version, service.ServicesVersion)
+			printMigrationIssues(issues)
+			return
+		}
+
+		var migrated []service.ServiceRecord
+		var issues []service.MigrationIssue
+
+		store := openServices(migrateFile)
+		from, err := store.Migrate(func(data []byte, version int) ([]service.ServiceRecord, error) {
+			if version != storage.LegacyVersion {
+				return nil, fmt.Errorf("no migration from schema version %d", version)
+			}
+
+			records, found, err := service.MigrateServices(data)
+			if err != nil {
+				return nil, err
+			}
+
+			backup := fmt.Sprintf("%s.v%d.bak", migrateFile, version)
+			if err := os.WriteFile(backup, data, 0644); err != nil {
+				return nil, fmt.Errorf("failed to write backup: %w", err)
+			}
+
+			migrated, issues = records, found
+			return records, nil
+		})
+		if err != nil {
+			out.Printf("❌ Failed to migrate services: %s\n", err)
+			return
+		}
+
+		if from == service.ServicesVersion {
+			out.Printf("✅ %s is already at schema version %d\n", migrateFile, from)
+			return
+		}
+
+		out.Printf("✅ Migrated %d record(s) from schema version %d to %d (backup: %s.v%d.bak)\n",
+			len(migrated), from, service.ServicesVersion, migrateFile, from)
+		printMigrationIssues(issues)
+	},
+}
+
+func printMigrationIssues(issues []service.MigrationIssue) {
+	if len(issues) == 0 {
+		return
+	}
+
+	out.Printf("\n⚠️ %d value(s) could not be converted as-is:\n", len(issues))
+	for _, issue := range issues {
+		out.Println("  -", issue)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.Flags().StringVarP(&migrateFile, "file", "f", "services.json", "Path to JSON file")
+	migrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "Report what would change without writing")
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/fahmaliyi/atmer/internal/i18n"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	outputLang  string
+	outputPlain bool
+)
+
+// out prints the user-facing messages, translated, and without emoji with
+// --plain
+var out = i18n.NewPrinter(os.Stdout)
+
+// setupOutput applies --lang, or the locale from the environment, and
+// --plain
+func setupOutput(cmd *cobra.Command, args []string) {
+	if outputPlain {
+		i18n.SetPlain(true)
+		color.NoColor = true
+	}
+
+	if outputLang != "" {
+		if err := i18n.SetLang(outputLang); err != nil {
+			out.Println("❌", err)
+			os.Exit(1)
+		}
+	} else if locale := i18n.FromEnv(); i18n.Supported(locale) {
+		i18n.SetLang(locale)
+	}
+}
+
+func init() {
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		setupOutput(cmd, args)
+		setupLogging(cmd, args)
+	}
+	rootCmd.PersistentFlags().StringVar(&outputLang, "lang", "", "Language of the messages, e.g. am or en (default from LANG)")
+	rootCmd.PersistentFlags().BoolVar(&outputPlain, "plain", false, "Plain output without emoji or colors, e.g. for log collectors")
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/fahmaliyi/atmer/internal/i18n"
+	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/fatih/color"
+)
+
+// captureOutput applies the output flags given and returns where out
+// prints; the flags and printer are restored after the test
+func captureOutput(t *testing.T, lang string, plain bool) *bytes.Buffer {
+	t.Helper()
+	savedOut, savedLang, savedPlain, savedColor := out, outputLang, outputPlain, color.NoColor
+	t.Cleanup(func() {
+		out, outputLang, outputPlain, color.NoColor = savedOut, savedLang, savedPlain, savedColor
+		i18n.SetPlain(false)
+		i18n.SetLang("en")
+	})
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "")
+	t.Setenv("LANG", "")
+
+	outputLang, outputPlain = lang, plain
+	setupOutput(rootCmd, nil)
+	var buf bytes.Buffer
+	out = i18n.NewPrinter(&buf)
+	return &buf
+}
+
+func TestOutputPlain(t *testing.T) {
+	buf := captureOutput(t, "", true)
+	printSite(siteFixture())
+
+	if !color.NoColor {
+		t.Error("--plain left colors on")
+	}
+	if got := buf.String(); got != i18n.Strip(got) || !bytes.Contains(buf.Bytes(), []byte("Bole (10.20.1.10)")) {
+		t.Errorf("--plain printed emoji:\n%s", got)
+	}
+}
+
+func TestOutputLang(t *testing.T) {
+	buf := captureOutput(t, "am", false)
+	color.NoColor = true
+	printSite(siteFixture())
+
+	for _, want := range []string{"🏧 Bole", i18n.T("Modem:"), i18n.T("Last status:") + " " + i18n.T("Offline"), i18n.T("No circuit on file")} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("missing %q in:\n%s", want, buf)
+		}
+	}
+	if bytes.Contains(buf.Bytes(), []byte("Last status:")) {
+		t.Errorf("--lang am printed English labels:\n%s", buf)
+	}
+}
+
+func TestOutputLangEnv(t *testing.T) {
+	captureOutput(t, "", false)
+	t.Setenv("LANG", "am_ET.UTF-8")
+	setupOutput(rootCmd, nil)
+	if i18n.Lang() != "am" {
+		t.Errorf("LANG=am_ET.UTF-8 selected %q", i18n.Lang())
+	}
+
+	i18n.SetLang("en")
+	t.Setenv("LANG", "fr_FR.UTF-8")
+	setupOutput(rootCmd, nil)
+	if i18n.Lang() != "en" {
+		t.Errorf("an unsupported LANG selected %q, want English", i18n.Lang())
+	}
+}
+
+// siteFixture is an ATM with a status on file but no circuit
+func siteFixture() service.Site {
+	checked := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	return service.Site{
+		Machine: &service.Machine{Name: "Bole", IP: "10.20.1.10"},
+		Status:  &service.StatusRecord{Name: "Bole", IP: "10.20.1.10", Status: "Offline", Checked: checked, Since: checked.Add(-time.Hour)},
+	}
+}
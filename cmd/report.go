@@ -1,116 +1,444 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
-	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/fahmaliyi/atmer/internal/config"
+	"github.com/fahmaliyi/atmer/internal/i18n"
+	"github.com/fahmaliyi/atmer/internal/query"
 	"github.com/fahmaliyi/atmer/internal/service"
-	"github.com/fahmaliyi/atmer/internal/utils"
+	"github.com/fahmaliyi/atmer/pkg/atmer"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
 var (
-	excelpath string
-	noOffline bool
-	noOnline  bool
+	excelpath   string
+	noOffline   bool
+	noOnline    bool
+	historyFile string
+
+	reportStatus  []string
+	reportExclude []string
+	reportWhere   []string
+
+	sweepNames   []string
+	sweepCIDRs   []string
+	sweepRegions []string
+	sweepSheet   string
+	sweepFrom    string
+
+	groupBy         []string
+	groupMin        int
+	groupSubnetBits int
+
+	reportDiagnose bool
+
+	reportWorkers      int
+	reportRecheck      int
+	reportRecheckDelay time.Duration
+	reportOutputs      []string
+	reportMailTo       []string
 )
 
 var reportCmd = &cobra.Command{
 	Use:   "report",
 	Short: "Generate ATM connectivity report from Excel file",
-	Run: func(cmd *cobra.Command, args []string) {
-		// Define colors
-		red := color.New(color.FgRed).SprintFunc()
-		green := color.New(color.FgGreen).SprintFunc()
-		yellow := color.New(color.FgYellow).SprintFunc()
+	Long: `Ping every ATM in the Excel file, print the results and a summary and
+write them to the outputs.
+
+ATMs under maintenance are left out of the counts and outage grouping
+and listed separately. An ATM's Maintenance column holds an expiry
+("2026-11-01 18:00"), a reason ("decommissioned") or both ("branch
+refit until 2026-11-01"); the config file can add windows for ATMs or
+whole regions:
+
+  {
+    "maintenance": [
+      {"region": "North", "from": "2026-10-20 22:00", "until": "2026-10-21 06:00", "reason": "fibre works"},
+      {"atm": "CMC", "reason": "decommissioned", "probe": true}
+    ]
+  }
+
+ATMs under maintenance get the Maintenance status without being pinged,
+unless the window sets "probe".
+
+Offline and OnlyADSL ATMs are probed up to --recheck more times (once by
+default, 0 disables it), waiting --recheck-delay before each round, and
+count as down only if every attempt failed; each result records its
+number of attempts. A sweep with failures then takes up to --recheck
+times the delay longer. --workers ATMs are probed at once.
 
-		machines, err := utils.LoadMachines(excelpath)
+--status, --exclude-status and --where pick the ATMs listed and
+written; the summary always counts every ATM swept.
+
+--atm (a glob, or a regex between slashes), --cidr, --region, --sheet
+and --from sweep only some of the ATMs; the outputs are then marked as
+a partial sweep. --from takes an earlier JSON report, and with it
+--status picks that report's ATMs by their status then, so the ATMs
+that have since recovered are listed too.
+
+--history keeps each ATM's last status and since when in a file, which
+'atmer search' shows next to the ATM.
+
+Examples:
+
+  atmer report --status offline,onlyadsl -o failing.txt
+  atmer report --exclude-status online --where region=North
+  atmer report --where ip=10.20.0.0/16 -o south.xlsx
+  atmer report --atm 'BR-*' --atm '/^HQ\d+$/' --region North
+  atmer report --from morning.json --status offline -o recheck.json
+  atmer report --history history.json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := loadConfig()
+		group, err := parseGroupBy(groupBy, groupMin, groupSubnetBits)
 		if err != nil {
-			fmt.Println("❌ Failed to load:", err)
+			out.Println("❌", err)
 			os.Exit(1)
 		}
+		group.Upstreams = cfg.Upstreams()
 
-		var results []service.PingResult
-		var onlineCount, adslCount, offlineCount int
+		exclude := reportExclude
+		if noOnline {
+			exclude = append(exclude, "Online")
+		}
+		if noOffline {
+			exclude = append(exclude, "Offline")
+		}
+		filter, err := parseResultFilter(reportStatus, exclude, reportWhere, cfg.StatusRules())
+		if err != nil {
+			out.Println("❌", err)
+			os.Exit(1)
+		}
+		selection, err := parseSweepSelection(sweepNames, sweepCIDRs, sweepRegions, sweepSheet, sweepFrom)
+		if err != nil {
+			out.Println("❌", err)
+			os.Exit(1)
+		}
+		if selection.From != "" {
+			// --status picks from the earlier report instead
+			selection.FromStatus, filter.Status = filter.Status, nil
+		}
 
-		for _, m := range machines {
-			status := "Offline"
-			if service.Ping(m.IP) {
-				status = "Online"
-			} else if service.Ping(service.GetModemIP(m.IP)) {
-				status = "OnlyADSL"
+		opts := reportOptions{Path: excelpath, Filter: filter, Selection: selection}
+		opts.Outputs, opts.History, opts.Group = reportOutputs, historyFile, group
+		opts.Rules, opts.Windows = sweepRules(cfg)
+		if reportDiagnose {
+			opts.Diagnose = traceOptions()
+		}
+		if reportRecheck < 0 {
+			out.Println("❌ --recheck cannot be negative")
+			os.Exit(1)
+		}
+		if reportWorkers < 1 {
+			out.Println("❌ --workers must be at least 1")
+			os.Exit(1)
+		}
+		opts.Recheck, opts.RecheckDelay, opts.Workers = reportRecheck, reportRecheckDelay, reportWorkers
+		if len(reportMailTo) > 0 {
+			if cfg.SMTP == nil {
+				out.Printf("❌ --mail-to needs smtp settings in %s\n", configFile)
+				os.Exit(1)
 			}
+			opts.Mail = &atmer.MailOptions{To: reportMailTo, SMTP: atmer.SMTP(*cfg.SMTP)}
+		}
 
-			if noOnline && status == "Online" {
-				continue
-			}
+		if _, err := runReport(cmd.Context(), opts); err != nil {
+			out.Println("❌", err)
+			slog.Error("report failed", "err", err)
+			os.Exit(1)
+		}
+	},
+}
 
-			var coloredStatus string
-			switch status {
-			case "Online":
-				coloredStatus = green(status)
-				onlineCount++
-			case "OnlyADSL":
-				coloredStatus = yellow(status)
-				adslCount++
-			case "Offline":
-				coloredStatus = red(status)
-				offlineCount++
-			}
+// reportOptions is one report run, from the report flags or a scheduled job
+type reportOptions struct {
+	atmer.ReportOptions
+	Path      string
+	Filter    resultFilter
+	Selection sweepSelection
+	Quiet     bool // print only the summary, not every ATM
+}
 
-			fmt.Printf("- %s (%s) → %s\n", m.Name, m.IP, coloredStatus)
+// resultFilter picks the ATMs a report lists and writes
+type resultFilter struct {
+	Status  []string // only these statuses, when set
+	Exclude []string
+	Where   *query.Query[atmer.Machine] // nil matches every ATM
+}
+
+// Match reports whether the ATM m with result r is listed
+func (f resultFilter) Match(m atmer.Machine, r atmer.PingResult) bool {
+	is := func(s string) bool { return strings.EqualFold(s, r.Status) }
+	if len(f.Status) > 0 && !slices.ContainsFunc(f.Status, is) {
+		return false
+	}
+	if slices.ContainsFunc(f.Exclude, is) {
+		return false
+	}
+	return f.Where == nil || f.Where.Match(m)
+}
 
-			results = append(results, service.PingResult{
-				Name:   m.Name,
-				IP:     m.IP,
-				Status: status,
-			})
+// reportSchema queries report ATMs by the inventory's fields
+var reportSchema = query.Embed(service.MachineSchema, func(m atmer.Machine) (service.Machine, bool) {
+	sm := service.Machine{IP: m.IP, Name: m.Name, Region: m.Region, Maintenance: m.Maintenance}
+	for _, l := range m.Links {
+		sm.Links = append(sm.Links, service.Link{Name: l.Name, Role: service.Role(l.Role), Address: l.Address})
+	}
+	return sm, true
+})
+
+// parseResultFilter reads --status, --exclude-status and --where, checking
+// the statuses against the decision table
+func parseResultFilter(status, exclude, where []string, rules []service.StatusRule) (resultFilter, error) {
+	var known []string
+	for _, r := range rules {
+		known = append(known, r.Status)
+	}
+	known = append(known, service.StatusUnresolved, service.StatusMaintenance)
+	check := func(list []string) ([]string, error) {
+		var out []string
+		for _, s := range list {
+			s = strings.TrimSpace(s)
+			i := slices.IndexFunc(known, func(k string) bool { return strings.EqualFold(k, s) })
+			if i < 0 {
+				return nil, fmt.Errorf("unknown status %q (known: %s)", s, strings.Join(known, ", "))
+			}
+			out = append(out, known[i])
 		}
+		return out, nil
+	}
 
-		// Summary
-		fmt.Println("\nSummary:")
-		fmt.Printf("🟢 Online: %s\n", green(onlineCount))
-		fmt.Printf("🟡 OnlyADSL: %s\n", yellow(adslCount))
-		fmt.Printf("🔴 Offline: %s\n\n", red(offlineCount))
+	var f resultFilter
+	var err error
+	if f.Status, err = check(status); err != nil {
+		return f, err
+	}
+	if f.Exclude, err = check(exclude); err != nil {
+		return f, err
+	}
+	if len(where) > 0 {
+		if f.Where, err = parseWhere(reportSchema, where); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// sweepRules returns the config's decision table and maintenance windows
+// for a sweep
+func sweepRules(cfg *config.Config) ([]atmer.StatusRule, []atmer.Window) {
+	var rules []atmer.StatusRule
+	for _, r := range cfg.StatusRules() {
+		rule := atmer.StatusRule{Status: r.Status}
+		for _, role := range r.Up {
+			rule.Up = append(rule.Up, atmer.Role(role))
+		}
+		for _, role := range r.Down {
+			rule.Down = append(rule.Down, atmer.Role(role))
+		}
+		rules = append(rules, rule)
+	}
+	var windows []atmer.Window
+	for _, w := range cfg.Windows() {
+		windows = append(windows, atmer.Window(w))
+	}
+	return rules, windows
+}
 
-		output, _ := cmd.Flags().GetString("output")
+// runReport loads and sweeps the ATM list, prints the results and summary
+// and has the report written and sent
+func runReport(ctx context.Context, opts reportOptions) (atmer.ReportRun, error) {
+	// Define colors
+	red := color.New(color.FgRed).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
 
-		ext := strings.ToLower(filepath.Ext(output))
-		var format string
+	machines, err := atmer.LoadSheet(opts.Path, opts.Selection.Sheet)
+	if err != nil {
+		return atmer.ReportRun{}, fmt.Errorf("failed to load: %w", err)
+	}
+	opts.Inventory = len(machines)
+	if opts.Selection.Partial() {
+		if machines, err = opts.Selection.Select(machines); err != nil {
+			return atmer.ReportRun{}, err
+		}
+		if len(machines) == 0 {
+			return atmer.ReportRun{}, fmt.Errorf("no ATM matches %s", opts.Selection)
+		}
+		opts.ReportOptions.Selection = opts.Selection.String()
+	}
 
-		switch ext {
-		case ".json":
-			format = "json"
-		case ".csv":
-			format = "csv"
-		case ".xlsx", ".xls":
-			format = "xlsx"
+	colorStatus := func(status string) string {
+		switch status {
+		case "Online":
+			return green(i18n.T(status))
+		case "Offline", service.StatusUnresolved:
+			return red(i18n.T(status))
 		default:
-			format = "txt"
+			return yellow(i18n.T(status))
+		}
+	}
+	printResult := func(m atmer.Machine, r atmer.PingResult) {
+		if opts.Quiet {
+			return
+		}
+		status := colorStatus(r.Status)
+		if r.Attempts > 1 {
+			status += i18n.Sprintf(" (%d attempts)", r.Attempts)
+		}
+		if r.Maintenance != "" {
+			status += " 🛠️ " + r.Maintenance
+		}
+		if addr, err := service.DefaultResolver.Resolve(m.IP); err == nil && addr.String() != m.IP {
+			out.Printf("- %s (%s → %s) → %s\n", m.Name, m.IP, addr, status)
+		} else {
+			out.Printf("- %s (%s) → %s\n", m.Name, m.IP, status)
 		}
+	}
 
-		if format == "" {
-			fmt.Printf("⚠️ Unknown output format for extension '%s'. Defaulting to txt.\n", ext)
-			format = "txt"
+	// with grouping or re-checks the listing waits for the sweep, so
+	// grouped ATMs can be folded into their outage and re-checked ones
+	// show their final status
+	group := opts.Group
+	grouping := group.ByUpstream || group.ByRegion || group.BySubnet
+	deferred := grouping || opts.Recheck > 0
+	if deferred || opts.Quiet {
+		out.Printf("🔄 Checking %d ATMs…\n", len(machines))
+	}
+
+	opts.ReportOptions.Filter = opts.Filter.Match
+	opts.OnRecheck = func(atms, attempt int) {
+		out.Printf("🔁 Re-checking %d ATM(s) in %s (attempt %d of %d)…\n", atms, opts.RecheckDelay, attempt, opts.Recheck+1)
+	}
+	opts.OnResult = func(r atmer.Result) {
+		if !deferred && opts.Filter.Match(r.Machine, r.PingResult) {
+			printResult(r.Machine, r.PingResult)
+		}
+	}
+	opts.OnDiagnose = func(atms int) {
+		out.Printf("🛰️ Tracing %d failing ATM(s)…\n", atms)
+	}
+	opts.OnTrace = func(r atmer.Result, t atmer.Trace) {
+		if t.Err != nil {
+			out.Printf("- %s: trace failed: %s\n", r.Name, t.Err)
+		} else {
+			out.Printf("- %s: %s\n", r.Name, describeTrace(t))
 		}
+	}
 
-		err = utils.WriteResults(results, output, format, noOffline)
-		if err != nil {
-			fmt.Println("❌ Error writing results:", err)
+	run, err := atmer.RunReport(ctx, machines, opts.ReportOptions)
+	if run.Counts == nil {
+		// interrupted before the results were counted
+		return run, err
+	}
+
+	// the summary counts every ATM, the listing and outputs only those
+	// matching the filter
+	if deferred {
+		for _, r := range run.Results {
+			if opts.Filter.Match(r.Machine, r.PingResult) && (r.Cause == "" || r.Maintenance != "") {
+				printResult(r.Machine, r.PingResult)
+			}
+		}
+	}
+
+	if len(run.Outages) > 0 {
+		out.Println("\nSuspected causes:")
+		for _, o := range run.Outages {
+			out.Printf("⚠️ %s\n", red(o.Cause))
+		}
+	}
+
+	// Summary
+	out.Println("\nSummary:")
+	if opts.Selection.Partial() {
+		out.Printf("🎯 Partial sweep: %d of %d ATMs (%s)\n", len(machines), opts.Inventory, opts.Selection)
+	}
+	out.Printf("🟢 Online: %s\n", green(run.Counts["Online"]))
+	out.Printf("🟡 OnlyADSL: %s\n", yellow(run.Counts["OnlyADSL"]))
+	out.Printf("🔴 Offline: %s\n", red(run.Counts["Offline"]))
+	for _, status := range run.Statuses {
+		if status == service.StatusUnresolved {
+			out.Printf("❔ %s: %s\n", i18n.T(status), red(run.Counts[status]))
 		} else {
-			fmt.Println("✅ Results written to", output)
+			out.Printf("🟠 %s: %s\n", i18n.T(status), yellow(run.Counts[status]))
 		}
-	},
+	}
+	if run.Maintenance > 0 {
+		out.Printf("🛠️ Under maintenance (not counted): %d\n", run.Maintenance)
+	}
+	out.Println()
+
+	if run.HistoryErr != nil {
+		out.Println("⚠️ Failed to update status history:", run.HistoryErr)
+	}
+	for _, output := range run.Written {
+		out.Println("✅ Results written to", output)
+	}
+	if run.WriteErr != nil {
+		out.Println("❌ Error writing results:", run.WriteErr)
+	}
+	if opts.Mail != nil {
+		if run.MailErr != nil {
+			out.Println("❌ Failed to send report:", run.MailErr)
+		} else {
+			out.Println("📧 Report sent to", strings.Join(opts.Mail.To, ", "))
+		}
+	}
+	return run, err
+}
+
+// parseGroupBy reads a --group-by list
+func parseGroupBy(kinds []string, minSize, subnetBits int) (atmer.GroupOptions, error) {
+	opts := atmer.GroupOptions{SubnetBits: subnetBits, MinSize: minSize}
+	for _, kind := range kinds {
+		switch strings.ToLower(strings.TrimSpace(kind)) {
+		case "upstream":
+			opts.ByUpstream = true
+		case "region":
+			opts.ByRegion = true
+		case "subnet":
+			opts.BySubnet = true
+		default:
+			return opts, fmt.Errorf("unknown --group-by %q (use upstream, region or subnet)", kind)
+		}
+	}
+	return opts, nil
 }
 
 func init() {
 	rootCmd.AddCommand(reportCmd)
-	reportCmd.Flags().StringP("output", "o", "ping_results.txt", "Output file")
-	reportCmd.Flags().StringP("format", "f", "txt", "Output format: txt, json, csv, xlsx")
+	reportCmd.Flags().StringArrayVarP(&reportOutputs, "output", "o", []string{"ping_results.txt"}, "Output file, format by extension (txt, json, csv, xlsx, html); repeatable")
+	reportCmd.Flags().StringP("format", "f", "txt", "Output format: txt, json, csv, xlsx, html")
 	reportCmd.Flags().StringVarP(&excelpath, "path", "p", "atms.xlsx", "Path to Excel file")
+	reportCmd.Flags().StringSliceVar(&reportStatus, "status", nil, "List and write only ATMs with these statuses, e.g. offline,onlyadsl")
+	reportCmd.Flags().StringSliceVar(&reportExclude, "exclude-status", nil, "Leave ATMs with these statuses out of the listing and outputs")
+	reportCmd.Flags().StringArrayVarP(&reportWhere, "where", "w", nil, "List and write only ATMs matching field=value (name, ip, region; * wildcards, CIDR); repeatable")
+	reportCmd.Flags().StringArrayVar(&sweepNames, "atm", nil, "Sweep only ATMs whose name matches this glob or /regex/; repeatable")
+	reportCmd.Flags().StringArrayVar(&sweepCIDRs, "cidr", nil, "Sweep only ATMs in this subnet, e.g. 10.20.0.0/16; repeatable")
+	reportCmd.Flags().StringArrayVar(&sweepRegions, "region", nil, "Sweep only ATMs in this region; repeatable")
+	reportCmd.Flags().StringVar(&sweepSheet, "sheet", "", "Sweep the ATMs on this sheet instead of the first")
+	reportCmd.Flags().StringVar(&sweepFrom, "from", "", "Sweep again the ATMs of an earlier JSON report, with --status those that had that status")
 	reportCmd.Flags().BoolVar(&noOffline, "no-offline", false, "Exclude offline ATMs from report")
 	reportCmd.Flags().BoolVar(&noOnline, "no-online", false, "Exclude online ATMs from report")
+	reportCmd.Flags().MarkDeprecated("no-offline", "use --exclude-status offline")
+	reportCmd.Flags().MarkDeprecated("no-online", "use --exclude-status online")
+	reportCmd.Flags().StringSliceVar(&groupBy, "group-by", nil, "Group failures by shared cause: upstream, region and/or subnet")
+	reportCmd.Flags().IntVar(&groupMin, "group-min", 3, "Smallest number of failed ATMs reported as one outage")
+	reportCmd.Flags().IntVar(&groupSubnetBits, "subnet-bits", 24, "IPv4 prefix length used by --group-by subnet")
+	reportCmd.Flags().IntVar(&reportWorkers, "workers", 16, "ATMs probed at once")
+	reportCmd.Flags().IntVar(&reportRecheck, "recheck", 1, "Times Offline and OnlyADSL ATMs are probed again before they count as down (0 to disable)")
+	reportCmd.Flags().DurationVar(&reportRecheckDelay, "recheck-delay", 10*time.Second, "Wait before each re-check")
+	reportCmd.Flags().BoolVar(&reportDiagnose, "diagnose", false, "Traceroute Offline and OnlyADSL ATMs and record the last responding hop")
+	reportCmd.Flags().IntVar(&traceConcurrency, "trace-concurrency", 8, "ATMs traced at once by --diagnose")
+	addTraceFlags(reportCmd)
+	reportCmd.Flags().StringArrayVar(&reportMailTo, "mail-to", nil, "Email the summary and outputs to this address (SMTP settings in the config); repeatable")
+	reportCmd.Flags().StringVar(&historyFile, "history", "", "Also keep each ATM's last status in this file, for 'atmer search'")
 }
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/fahmaliyi/atmer/pkg/atmer"
+)
+
+// vsatRules is a decision table with a status of its own
+var vsatRules = append([]service.StatusRule{
+	{Status: "OnVSAT", Up: []service.Role{"vsat"}, Down: []service.Role{service.RolePrimary}},
+}, service.DefaultStatusRules...)
+
+// swept is a sweep with one ATM in each status
+var swept = []struct {
+	m atmer.Machine
+	r atmer.PingResult
+}{
+	{atmer.Machine{Name: "Bole", IP: "10.20.1.10", Region: "North"}, atmer.PingResult{Status: "Online"}},
+	{atmer.Machine{Name: "Piassa", IP: "10.20.2.10", Region: "North"}, atmer.PingResult{Status: "OnlyADSL"}},
+	{atmer.Machine{Name: "Kality", IP: "10.40.1.10", Region: "South"}, atmer.PingResult{Status: "Offline"}},
+	{atmer.Machine{Name: "Akaki", IP: "10.40.2.10", Region: "South"}, atmer.PingResult{Status: "OnVSAT"}},
+	{atmer.Machine{Name: "CMC", IP: "cmc.branch", Region: "East"}, atmer.PingResult{Status: "Unresolved"}},
+	{atmer.Machine{Name: "Ayat", IP: "10.60.1.10", Region: "East", Maintenance: "fibre works"}, atmer.PingResult{Status: "Maintenance"}},
+}
+
+func TestParseResultFilter(t *testing.T) {
+	for _, c := range []struct {
+		name                   string
+		status, exclude, where []string
+		rules                  []service.StatusRule
+		want                   string // names listed, or the error
+	}{
+		{name: "no filter", want: "Bole Piassa Kality Akaki CMC Ayat"},
+		{name: "status", status: []string{"offline", " OnlyADSL "}, want: "Piassa Kality"},
+		{name: "exclude", exclude: []string{"Online", "Maintenance"}, want: "Piassa Kality Akaki CMC"},
+		{name: "status and exclude", status: []string{"Offline", "Online"}, exclude: []string{"online"}, want: "Kality"},
+		{name: "unresolved is always known", status: []string{"unresolved"}, want: "CMC"},
+		{name: "where", where: []string{"region=south"}, want: "Kality Akaki"},
+		{name: "where cidr", where: []string{"ip=10.20.0.0/16"}, want: "Bole Piassa"},
+		{name: "where and status", status: []string{"Offline"}, where: []string{"region=South"}, want: "Kality"},
+		{name: "where ands its selectors", where: []string{"region=East", "maintenance=Fibre Works"}, want: "Ayat"},
+		{name: "rule status", status: []string{"onvsat"}, rules: vsatRules, want: "Akaki"},
+		{name: "rule status excluded", exclude: []string{"ONVSAT", "Online"}, rules: vsatRules, want: "Piassa Kality CMC Ayat"},
+
+		{name: "status not in the rules", status: []string{"OnVSAT"}, want: `unknown status "OnVSAT"`},
+		{name: "unknown exclusion", exclude: []string{"Down"}, want: `unknown status "Down"`},
+		{name: "bad selector", where: []string{"region"}, want: `invalid selector "region"`},
+		{name: "unknown field", where: []string{"colour=red"}, want: "colour"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			rules := c.rules
+			if rules == nil {
+				rules = service.DefaultStatusRules
+			}
+			f, err := parseResultFilter(c.status, c.exclude, c.where, rules)
+			if err != nil {
+				if !strings.Contains(err.Error(), c.want) {
+					t.Errorf("error %q, want it to mention %q", err, c.want)
+				}
+				return
+			}
+
+			var listed []string
+			for _, s := range swept {
+				if f.Match(s.m, s.r) {
+					listed = append(listed, s.m.Name)
+				}
+			}
+			if got := strings.Join(listed, " "); got != c.want {
+				t.Errorf("listed %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseResultFilterCanonicalStatus(t *testing.T) {
+	f, err := parseResultFilter([]string{"onvsat", "OFFLINE"}, []string{"maintenance"}, nil, vsatRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// statuses take the spelling of the decision table
+	if got := fmt.Sprint(f.Status, f.Exclude); got != "[OnVSAT Offline] [Maintenance]" {
+		t.Errorf("statuses = %s", got)
+	}
+	if f.Where != nil {
+		t.Error("no --where compiled a query")
+	}
+}
@@ -16,6 +16,7 @@ Given an Excel file containing ATM names and their primary IP addresses, Atmer:
   - Pings each ATM's primary IP to check if it is online
   - Pings the secondary/modem IP (calculated automatically) to detect 'OnlyADSL' connectivity
   - Classifies ATMs as Online, OnlyADSL, or Offline
+  - Checks backup links too, with the statuses set by a decision table in atmer.json
   - Generates a detailed report saved to a text file, grouping ATMs by status
 
 This tool accelerates troubleshooting and network health monitoring for ATM fleets
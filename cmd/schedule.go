@@ -0,0 +1,281 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fahmaliyi/atmer/internal/config"
+	"github.com/fahmaliyi/atmer/internal/cron"
+	"github.com/fahmaliyi/atmer/pkg/atmer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	scheduleLog  string
+	scheduleList bool
+	scheduleRun  string
+)
+
+// missedGrace is how late a run may start before it counts as missed, e.g.
+// after the machine slept through it
+const missedGrace = time.Minute
+
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Run the report jobs from the config file on their cron schedules",
+	Long: `Stay running and run each job in the config file's "jobs" list on its
+cron schedule, without an external cron.
+
+A job names its schedule, the ATM list, the outputs and the report
+options:
+
+  {
+    "jobs": [
+      {
+        "name": "morning",
+        "schedule": "0 7 * * 1-6",
+        "inventory": "atms.xlsx",
+        "outputs": ["reports/atms-{date}.txt", "reports/atms-{date}.xlsx"],
+        "history": "history.json",
+        "exclude_status": ["online"],
+        "group_by": ["region"],
+        "mail_to": ["noc@example.com"]
+      }
+    ],
+    "smtp": {
+      "host": "smtp.example.com",
+      "port": 587,
+      "from": "atmer@example.com",
+      "username": "atmer",
+      "password_env": "ATMER_SMTP_PASSWORD",
+      "starttls": true
+    }
+  }
+
+Schedules are five-field cron expressions (minute hour day month weekday)
+or @hourly, @daily, @weekly, @monthly. Runs never overlap: jobs that come
+due together run one after the other, and a run that comes due while
+another is still going, or while the machine was asleep, is skipped and
+logged. Each run's outcome is logged to --run-log and the terminal.
+
+Examples:
+
+  atmer schedule
+  atmer schedule --list
+  atmer schedule --run morning`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := loadConfig()
+		if len(cfg.Jobs) == 0 {
+			out.Printf("❌ No jobs in %s\n", configFile)
+			os.Exit(1)
+		}
+
+		jobs := make([]scheduledJob, len(cfg.Jobs))
+		now := time.Now()
+		for i, j := range cfg.Jobs {
+			sched, err := cron.Parse(j.Schedule)
+			if err != nil {
+				out.Printf("❌ Job %s: %s\n", j.Name, err)
+				os.Exit(1)
+			}
+			jobs[i] = scheduledJob{job: j, sched: sched, next: sched.Next(now)}
+		}
+
+		if scheduleList {
+			for _, j := range jobs {
+				out.Printf("🕘 %-16s %-20s next %s\n", j.job.Name, j.sched, formatNext(j.next))
+			}
+			return
+		}
+
+		logger, closeLog, err := openRunLog(scheduleLog)
+		if err != nil {
+			out.Println("❌ Failed to open run log:", err)
+			os.Exit(1)
+		}
+		defer closeLog()
+
+		if scheduleRun != "" {
+			for _, j := range jobs {
+				if strings.EqualFold(j.job.Name, scheduleRun) {
+					if err := runJob(cmd.Context(), logger, cfg, j.job); err != nil {
+						os.Exit(1)
+					}
+					return
+				}
+			}
+			out.Printf("❌ No job named %s\n", scheduleRun)
+			os.Exit(1)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		logger.Printf("scheduler started with %d job(s)", len(jobs))
+		for _, j := range jobs {
+			logger.Printf("job %s: next run %s", j.job.Name, formatNext(j.next))
+		}
+		runSchedule(ctx, logger, cfg, jobs)
+		logger.Printf("scheduler stopped")
+	},
+}
+
+// scheduledJob is a job with its parsed schedule and next run time
+type scheduledJob struct {
+	job   config.Job
+	sched *cron.Schedule
+	next  time.Time // zero if the schedule never fires
+}
+
+// runSchedule runs jobs as they come due until ctx is cancelled. Everything
+// happens in this one loop, so runs cannot overlap.
+func runSchedule(ctx context.Context, logger *log.Logger, cfg *config.Config, jobs []scheduledJob) {
+	for {
+		var wake time.Time
+		for _, j := range jobs {
+			if !j.next.IsZero() && (wake.IsZero() || j.next.Before(wake)) {
+				wake = j.next
+			}
+		}
+		if wake.IsZero() {
+			logger.Printf("no job will run again")
+			return
+		}
+
+		timer := time.NewTimer(time.Until(wake))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		fireDue(ctx, logger, jobs, time.Now, func(job config.Job) { runJob(ctx, logger, cfg, job) })
+	}
+}
+
+// fireDue runs the jobs that are due by now, skipping those more than
+// missedGrace late, and then moves every job that has come due on to its
+// next run
+func fireDue(ctx context.Context, logger *log.Logger, jobs []scheduledJob, now func() time.Time, run func(config.Job)) {
+	woke := now()
+	for i := range jobs {
+		j := &jobs[i]
+		if j.next.IsZero() || j.next.After(woke) {
+			continue
+		}
+		if late := woke.Sub(j.next); late > missedGrace {
+			logger.Printf("job %s: missed run at %s skipped (%s late)", j.job.Name, j.next.Format("2006-01-02 15:04"), late.Round(time.Second))
+		} else if ctx.Err() == nil {
+			run(j.job)
+		}
+		j.next = time.Time{} // settled below
+	}
+
+	// runs that came due while others were running are skipped, not
+	// queued, so a slow run never causes a pile-up
+	done := now()
+	for i := range jobs {
+		j := &jobs[i]
+		if !j.next.IsZero() && !j.next.After(done) {
+			logger.Printf("job %s: run at %s skipped, another run was in progress", j.job.Name, j.next.Format("2006-01-02 15:04"))
+		}
+		if j.next.IsZero() || !j.next.After(done) {
+			j.next = j.sched.Next(done)
+		}
+	}
+}
+
+// runJob runs one job's report and logs the outcome
+func runJob(ctx context.Context, logger *log.Logger, cfg *config.Config, job config.Job) error {
+	logger.Printf("job %s: started", job.Name)
+	slog.Info("job started", "job", job.Name, "inventory", job.InventoryPath())
+	start := time.Now()
+
+	minSize, bits := job.GroupMin, job.SubnetBits
+	if minSize == 0 {
+		minSize = 3
+	}
+	if bits == 0 {
+		bits = 24
+	}
+	group, err := parseGroupBy(job.GroupBy, minSize, bits)
+	if err != nil {
+		logger.Printf("job %s: failed: %s", job.Name, err)
+		return err
+	}
+	group.Upstreams = cfg.Upstreams()
+
+	exclude := slices.Clone(job.ExcludeStatus)
+	if job.NoOnline {
+		exclude = append(exclude, "Online")
+	}
+	if job.NoOffline {
+		exclude = append(exclude, "Offline")
+	}
+	filter, err := parseResultFilter(job.Status, exclude, job.Where, cfg.StatusRules())
+	if err != nil {
+		logger.Printf("job %s: failed: %s", job.Name, err)
+		return err
+	}
+
+	opts := reportOptions{Path: job.InventoryPath(), Filter: filter, Quiet: true}
+	opts.Outputs, opts.History, opts.Group = job.Outputs, job.History, group
+	opts.Rules, opts.Windows = sweepRules(cfg)
+	opts.Recheck, opts.Workers = job.Rechecks(), job.SweepWorkers()
+	opts.RecheckDelay, _ = job.RecheckWait()
+	if job.Diagnose {
+		opts.Diagnose = &atmer.TraceOptions{}
+	}
+	if len(job.MailTo) > 0 {
+		opts.Mail = &atmer.MailOptions{To: job.MailTo, SMTP: atmer.SMTP(*cfg.SMTP)}
+	}
+
+	summary, err := runReport(ctx, opts)
+	took := time.Since(start).Round(time.Second)
+	if err != nil {
+		logger.Printf("job %s: failed after %s: %s", job.Name, took, err)
+		slog.Error("job failed", "job", job.Name, "took", took, "err", err)
+		return err
+	}
+	slog.Info("job done", "job", job.Name, "took", took, "written", summary.Written)
+	logger.Printf("job %s: done in %s: %s; wrote %s", job.Name, took, summary, strings.Join(summary.Written, ", "))
+	return nil
+}
+
+// openRunLog returns a logger writing to the terminal and, unless path is
+// empty, appending to the run log
+func openRunLog(path string) (*log.Logger, func(), error) {
+	if path == "" {
+		return log.New(os.Stdout, "", log.LstdFlags), func() {}, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	return log.New(io.MultiWriter(os.Stdout, f), "", log.LstdFlags), func() { f.Close() }, nil
+}
+
+func formatNext(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format("2006-01-02 15:04 (Mon)")
+}
+
+func init() {
+	rootCmd.AddCommand(scheduleCmd)
+	scheduleCmd.Flags().StringVar(&scheduleLog, "run-log", "schedule.log", "File each run's outcome is appended to (empty for terminal only)")
+	scheduleCmd.Flags().BoolVar(&scheduleList, "list", false, "List the jobs and when they next run, then exit")
+	scheduleCmd.Flags().StringVar(&scheduleRun, "run", "", "Run one job now and exit")
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fahmaliyi/atmer/internal/config"
+	"github.com/fahmaliyi/atmer/internal/cron"
+)
+
+// fakeClock is a clock the test moves; runs take as long as it says
+type fakeClock struct {
+	now     time.Time
+	runTime time.Duration
+	ran     []string
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) run(job config.Job) {
+	c.ran = append(c.ran, job.Name)
+	c.now = c.now.Add(c.runTime)
+}
+
+func scheduled(t *testing.T, name, expr string, next time.Time) scheduledJob {
+	t.Helper()
+	sched, err := cron.Parse(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scheduledJob{job: config.Job{Name: name, Schedule: expr}, sched: sched, next: next}
+}
+
+func at(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestFireDueOnTime(t *testing.T) {
+	var buf bytes.Buffer
+	clock := &fakeClock{now: at("2026-10-19 07:00:20")}
+	jobs := []scheduledJob{
+		scheduled(t, "morning", "0 7 * * *", at("2026-10-19 07:00:00")),
+		scheduled(t, "hourly", "0 * * * *", at("2026-10-19 08:00:00")),
+	}
+
+	fireDue(context.Background(), log.New(&buf, "", 0), jobs, clock.Now, clock.run)
+
+	if strings.Join(clock.ran, ",") != "morning" {
+		t.Errorf("ran %q, want only morning", clock.ran)
+	}
+	if !jobs[0].next.Equal(at("2026-10-20 07:00:00")) {
+		t.Errorf("morning next at %s", jobs[0].next)
+	}
+	if !jobs[1].next.Equal(at("2026-10-19 08:00:00")) {
+		t.Errorf("hourly moved to %s before it was due", jobs[1].next)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("logged %q", buf.String())
+	}
+}
+
+func TestFireDueWithinGrace(t *testing.T) {
+	clock := &fakeClock{now: at("2026-10-19 07:00:00").Add(missedGrace)}
+	jobs := []scheduledJob{scheduled(t, "morning", "0 7 * * *", at("2026-10-19 07:00:00"))}
+
+	fireDue(context.Background(), log.New(&bytes.Buffer{}, "", 0), jobs, clock.Now, clock.run)
+	if len(clock.ran) != 1 {
+		t.Errorf("a run exactly missedGrace late did not run")
+	}
+}
+
+func TestFireDueMissed(t *testing.T) {
+	var buf bytes.Buffer
+	// the machine slept from before 07:00 until 09:30
+	clock := &fakeClock{now: at("2026-10-19 09:30:00")}
+	jobs := []scheduledJob{scheduled(t, "morning", "0 7 * * *", at("2026-10-19 07:00:00"))}
+
+	fireDue(context.Background(), log.New(&buf, "", 0), jobs, clock.Now, clock.run)
+
+	if len(clock.ran) != 0 {
+		t.Errorf("ran %q for a run 2h30m late", clock.ran)
+	}
+	if !strings.Contains(buf.String(), "job morning: missed run at 2026-10-19 07:00 skipped (2h30m0s late)") {
+		t.Errorf("log = %q", buf.String())
+	}
+	if !jobs[0].next.Equal(at("2026-10-20 07:00:00")) {
+		t.Errorf("next at %s, want tomorrow", jobs[0].next)
+	}
+}
+
+func TestFireDueNoPileUp(t *testing.T) {
+	var buf bytes.Buffer
+	// both due at 07:00; the first run takes 20 minutes, past the
+	// quarter-hourly job's 07:15
+	clock := &fakeClock{now: at("2026-10-19 07:00:05"), runTime: 20 * time.Minute}
+	jobs := []scheduledJob{
+		scheduled(t, "morning", "0 7 * * *", at("2026-10-19 07:00:00")),
+		scheduled(t, "quarter", "*/15 * * * *", at("2026-10-19 07:00:00")),
+		scheduled(t, "later", "15 7 * * *", at("2026-10-19 07:15:00")),
+	}
+
+	fireDue(context.Background(), log.New(&buf, "", 0), jobs, clock.Now, clock.run)
+
+	// quarter was due when the loop woke, so it runs after morning even
+	// though that is late by then: the grace counts from waking
+	if strings.Join(clock.ran, ",") != "morning,quarter" {
+		t.Errorf("ran %q, want morning then quarter", clock.ran)
+	}
+	if !strings.Contains(buf.String(), "job later: run at 2026-10-19 07:15 skipped, another run was in progress") {
+		t.Errorf("log = %q", buf.String())
+	}
+	for _, j := range jobs {
+		if !j.next.After(clock.now) {
+			t.Errorf("job %s left due at %s", j.job.Name, j.next)
+		}
+	}
+	if !jobs[1].next.Equal(at("2026-10-19 07:45:00")) {
+		t.Errorf("quarter next at %s, want 07:45", jobs[1].next)
+	}
+}
+
+func TestFireDueCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	clock := &fakeClock{now: at("2026-10-19 07:00:00")}
+	jobs := []scheduledJob{scheduled(t, "morning", "0 7 * * *", at("2026-10-19 07:00:00"))}
+
+	fireDue(ctx, log.New(&bytes.Buffer{}, "", 0), jobs, clock.Now, clock.run)
+	if len(clock.ran) != 0 {
+		t.Error("a job ran after the scheduler was stopped")
+	}
+}
@@ -1,12 +1,11 @@
 package cmd
 
 import (
-	"fmt"
+	"errors"
 	"strings"
 
 	"github.com/fahmaliyi/atmer/internal/service"
 	"github.com/fahmaliyi/atmer/internal/storage"
-	"github.com/fahmaliyi/atmer/internal/utils"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
@@ -15,81 +14,105 @@ var searchTerm string
 var serviceFile string
 
 var serviceCmd = &cobra.Command{
-	Use:   "service",
-	Short: "Search service details by partial match on any field",
+	Use:   "service [query]",
+	Short: "Search service records with a field-aware query",
+	Long: `Search service records.
+
+A query is a list of terms that must all match. A bare word matches any
+field; field:value restricts it to one field. Fields are location (loc),
+wan, lan, conn, bw, line, service (sn) and account (acct).
+
+  field:value      substring match (location also tolerates typos)
+  field:=value     exact match
+  field:bole*      wildcards * and ? match the whole value
+  field:~value     typo-tolerant match
+  bw:>=4           numeric comparison (>, >=, <, <=), bandwidth in Mbps
+  lan:10.20.0.0/16 CIDR match on wan and lan
+  a OR b, NOT a    boolean operators; -a is short for NOT a
+  ( ... )          grouping; quote values with spaces: location:"bole road"
+
+Results are ranked by relevance.
+
+Examples:
+
+  atmer service -s "location:addis line:adsl bw:>=4"
+  atmer service lan:10.20.0.0/16 NOT conn:vpn`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		green := color.New(color.FgGreen, color.Bold).SprintFunc()
 		cyan := color.New(color.FgCyan, color.Bold).SprintFunc()
 		yellow := color.New(color.FgYellow).SprintFunc()
 
-		if searchTerm == "" {
-			fmt.Println("❌ Please provide a search term using -s")
+		input := strings.TrimSpace(strings.Join(append([]string{searchTerm}, args...), " "))
+		if input == "" {
+			out.Println("❌ Please provide a search query using -s")
 			return
 		}
 
-		store := storage.New[service.ServiceRecord](serviceFile)
-		records, err := store.Load()
+		q, err := service.ServiceSchema.Compile(input)
 		if err != nil {
-			fmt.Printf("❌ Failed to load services: %s\n", err)
+			out.Printf("❌ Invalid query: %s\n", err)
 			return
 		}
 
-		query := strings.TrimSpace(strings.ToLower(searchTerm))
-		var matches []service.ServiceRecord
-
-		for _, r := range records {
-			bandwidthStr := fmt.Sprintf("%v", r.Bandwidth)
-
-			fields := []string{
-				strings.ToLower(r.Location),
-				strings.ToLower(r.WANIP),
-				strings.ToLower(r.LANIP),
-				strings.ToLower(r.ConnectionType),
-				strings.ToLower(bandwidthStr),
-				strings.ToLower(r.LineType),
-				utils.ToString(r.ServiceNumber), // numeric - no lowercasing
-				utils.ToString(r.AccountNumber), // numeric - no lowercasing
-			}
-
-			for _, field := range fields {
-				f := strings.TrimSpace(field)
-				if strings.Contains(f, query) {
-					matches = append(matches, r)
-					break
-				}
-			}
+		store := openServices(serviceFile)
+		matches, err := store.Find(q.Match)
+		if err != nil {
+			printServiceError("Failed to load services", err)
+			return
 		}
+		matches = q.Rank(matches)
 
 		if len(matches) == 0 {
-			fmt.Println("❌ No matches found.")
+			out.Println("❌ No matches found.")
 			return
 		}
 
-		fmt.Printf("🔍 Found %d matching service(s):\n\n", len(matches))
+		out.Printf("🔍 Found %d matching service(s):\n\n", len(matches))
 		for _, r := range matches {
-			bandwidthStr := fmt.Sprintf("%v", r.Bandwidth)
-
 			// Header line: location and WAN IP
-			fmt.Printf("%s %s\n", green("- "+r.Location), green("("+r.WANIP+")"))
+			out.Printf("%s %s\n", green("- "+r.Location), green("("+r.WANIP+")"))
 
 			// Details lines with colored labels and values
-			fmt.Printf("  %s %s | %s %s | %s %s | %s %s\n",
+			out.Printf("  %s %s | %s %s | %s %s | %s %s\n",
 				cyan("LAN:"), yellow(r.LANIP),
 				cyan("Conn:"), yellow(r.ConnectionType),
-				cyan("BW:"), yellow(bandwidthStr),
+				cyan("BW:"), yellow(r.Bandwidth.String()),
 				cyan("Line:"), yellow(r.LineType),
 			)
-			fmt.Printf("  %s %s | %s %s\n\n",
-				cyan("Service #:"), yellow(utils.ToString(r.ServiceNumber)),
-				cyan("Account #:"), yellow(utils.ToString(r.AccountNumber)),
+			out.Printf("  %s %s | %s %s\n\n",
+				cyan("Service #:"), yellow(r.ServiceNumber),
+				cyan("Account #:"), yellow(r.AccountNumber),
 			)
 		}
 	},
 }
 
+// openServices returns the service record store with its lookup indexes
+func openServices(path string) *storage.Storage[service.ServiceRecord] {
+	store := storage.New[service.ServiceRecord](path)
+	store.SetVersion(service.ServicesVersion)
+	store.SetKey(func(r service.ServiceRecord) string { return r.ServiceNumber })
+	store.AddIndex("lanip", func(r service.ServiceRecord) string { return r.LANIP })
+	store.AddIndex("wanip", func(r service.ServiceRecord) string { return r.WANIP })
+	store.AddIndex("servicenumber", func(r service.ServiceRecord) string { return r.ServiceNumber })
+	store.AddIndex("accountnumber", func(r service.ServiceRecord) string { return r.AccountNumber })
+	return store
+}
+
+// printServiceError reports a service store failure, pointing at
+// 'atmer migrate' when the file predates the current schema
+func printServiceError(msg string, err error) {
+	out.Printf("❌ %s: %s\n", msg, err)
+
+	var verr *storage.VersionError
+	if errors.As(err, &verr) && verr.Found < verr.Want {
+		out.Printf("💡 Run 'atmer migrate -f %s' to convert it.\n", verr.Path)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(serviceCmd)
-	serviceCmd.Flags().StringVarP(&searchTerm, "search", "s", "", "Search term (partial match)")
-	serviceCmd.Flags().StringVarP(&serviceFile, "file", "f", "services.json", "Path to JSON file")
+	serviceCmd.Flags().StringVarP(&searchTerm, "search", "s", "", "Search query (see help for syntax)")
+	serviceCmd.PersistentFlags().StringVarP(&serviceFile, "file", "f", "services.json", "Path to JSON file")
 }
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fahmaliyi/atmer/internal/i18n"
+	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/fahmaliyi/atmer/internal/storage"
+	"github.com/fahmaliyi/atmer/internal/utils"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// searchHistory is the status history search reads; report writes it only
+// when given --history
+var searchHistory string
+
+var searchCmd = &cobra.Command{
+	Use:   "search [query]",
+	Short: "Search ATMs and service records together",
+	Long: `Search the ATM inventory and the service records in one go.
+
+Each ATM is linked to the circuit serving it (matching LAN IP, modem IP,
+/24 subnet or location name), so a hit shows the ATM, its IPs, derived
+modem IP, circuit details and, when 'atmer report --history' has
+recorded it, its last status. Circuits no ATM points at are listed on their own.
+
+The query syntax is the one of 'atmer service', with the extra fields
+name, ip, modem and status.
+
+Examples:
+
+  atmer search bole
+  atmer search "status:offline lan:10.20.0.0/16"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		input := strings.TrimSpace(strings.Join(append([]string{searchTerm}, args...), " "))
+		if input == "" {
+			out.Println("❌ Please provide a search query")
+			return
+		}
+
+		q, err := service.SiteSchema.Compile(input)
+		if err != nil {
+			out.Printf("❌ Invalid query: %s\n", err)
+			return
+		}
+
+		machines, err := utils.LoadMachines(excelpath)
+		if err != nil {
+			out.Println("❌ Failed to load ATM list:", err)
+			return
+		}
+
+		records, err := openServices(serviceFile).Load()
+		if err != nil && !os.IsNotExist(err) {
+			printServiceError("Failed to load services", err)
+			return
+		}
+
+		var statuses []service.StatusRecord
+		if searchHistory != "" {
+			statuses, err = storage.New[service.StatusRecord](searchHistory).Load()
+			if err != nil && !os.IsNotExist(err) {
+				out.Println("⚠️ Failed to load status history:", err)
+			}
+		}
+
+		matches := q.Rank(service.LinkSites(machines, records, statuses))
+		if len(matches) == 0 {
+			out.Println("❌ No matches found.")
+			return
+		}
+
+		out.Printf("🔍 Found %d match(es):\n\n", len(matches))
+		for _, site := range matches {
+			printSite(site)
+		}
+	},
+}
+
+func printSite(site service.Site) {
+	green := color.New(color.FgGreen, color.Bold).SprintFunc()
+	cyan := color.New(color.FgCyan, color.Bold).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+
+	if m := site.Machine; m != nil {
+		out.Printf("%s %s\n", green("🏧 "+m.Name), green("("+m.IP+")"))
+		out.Printf("  %s %s | %s %s\n", cyan(i18n.T("IP:")), yellow(m.IP), cyan(i18n.T("Modem:")), yellow(m.Modem()))
+		for _, l := range m.Links {
+			if l.Role != service.RoleModem {
+				out.Printf("  %s %s\n", cyan(fmt.Sprintf("%s (%s):", l.Name, l.Role)), yellow(l.Address))
+			}
+		}
+
+		if st := site.Status; st != nil {
+			out.Printf("  %s %s %s\n", cyan(i18n.T("Last status:")), statusColor(st.Status),
+				i18n.Sprintf("(checked %s, since %s)", st.Checked.Format("2006-01-02 15:04"), st.Since.Format("2006-01-02 15:04")))
+		}
+	} else {
+		out.Printf("%s\n", green(i18n.T("📡 Circuit without ATM")))
+	}
+
+	if r := site.Record; r != nil {
+		out.Printf("  %s %s %s\n", cyan(i18n.T("Circuit:")), yellow(r.Location), yellow("("+r.WANIP+")"))
+		out.Printf("  %s %s | %s %s | %s %s | %s %s\n",
+			cyan(i18n.T("LAN:")), yellow(r.LANIP),
+			cyan(i18n.T("Conn:")), yellow(r.ConnectionType),
+			cyan(i18n.T("BW:")), yellow(r.Bandwidth.String()),
+			cyan(i18n.T("Line:")), yellow(r.LineType),
+		)
+		out.Printf("  %s %s | %s %s\n",
+			cyan(i18n.T("Service #:")), yellow(r.ServiceNumber),
+			cyan(i18n.T("Account #:")), yellow(r.AccountNumber),
+		)
+	} else {
+		out.Printf("  %s\n", cyan(i18n.T("No circuit on file")))
+	}
+	out.Println()
+}
+
+// statusColor renders a report status, translated, in its usual color
+func statusColor(status string) string {
+	switch status {
+	case "Online":
+		return color.New(color.FgGreen).Sprint(i18n.T(status))
+	case "OnlyADSL":
+		return color.New(color.FgYellow).Sprint(i18n.T(status))
+	default:
+		return color.New(color.FgRed).Sprint(i18n.T(status))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+	searchCmd.Flags().StringVarP(&searchTerm, "search", "s", "", "Search query (see help for syntax)")
+	searchCmd.Flags().StringVarP(&excelpath, "path", "p", "atms.xlsx", "Path to Excel file")
+	searchCmd.Flags().StringVarP(&serviceFile, "file", "f", "services.json", "Path to JSON file")
+	searchCmd.Flags().StringVar(&searchHistory, "history", "history.json", "File 'atmer report --history' keeps each ATM's last status in")
+}
@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serviceAddFields = map[string]*string{}
+	serviceRmWhere   []string
+	serviceRmAll     bool
+	serviceRmYes     bool
+)
+
+// serviceAddOrder is the order fields are prompted for, with their flags
+var serviceAddOrder = []struct{ field, flag, usage, prompt string }{
+	{"location", "location", "Location", "📍 Location"},
+	{"lan", "lan", "LAN IP", "🔌 LAN IP"},
+	{"wan", "wan", "WAN IP", "🌐 WAN IP"},
+	{"conn", "conn", "Connection type", "🔗 Connection type"},
+	{"bw", "bw", "Bandwidth (e.g. 4M, 512k)", "📶 Bandwidth (e.g. 4M, 512k)"},
+	{"line", "line", "Line type", "☎️ Line type"},
+	{"service", "service-number", "Service number", "🔢 Service number"},
+	{"account", "account", "Account number", "🧾 Account number"},
+}
+
+var serviceAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add a service record, from flags or interactive prompts",
+	Long: `Add a service record.
+
+Fields come from flags; when none are given, each one is prompted for.
+Location and at least one of the LAN and WAN IPs are required. IPs and
+bandwidth are validated, and a record whose LAN IP, WAN IP or service
+number is already on file is refused.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		interactive := true
+		for _, f := range serviceAddOrder {
+			if cmd.Flags().Changed(f.flag) {
+				interactive = false
+			}
+		}
+
+		var r service.ServiceRecord
+		if interactive {
+			reader := bufio.NewReader(os.Stdin)
+			for _, f := range serviceAddOrder {
+				for {
+					out.Printf("%s: ", f.prompt)
+					value := readLine(reader)
+					if value == "" {
+						break
+					}
+					if err := service.SetServiceField(&r, f.field, value); err != nil {
+						out.Printf("❌ %s. Try again.\n", err)
+						continue
+					}
+					break
+				}
+			}
+		} else {
+			for _, f := range serviceAddOrder {
+				if err := service.SetServiceField(&r, f.field, *serviceAddFields[f.flag]); err != nil && f.field != "location" {
+					out.Printf("❌ %s\n", err)
+					return
+				}
+			}
+		}
+
+		if strings.TrimSpace(r.Location) == "" {
+			out.Println("❌ Location is required")
+			return
+		}
+		if r.LANIP == "" && r.WANIP == "" {
+			out.Println("❌ A LAN or WAN IP is required")
+			return
+		}
+
+		// check and add in one critical section, so no other process can
+		// take the addresses in between
+		var dup *duplicateError
+		done := func(error) {}
+		err := openServices(serviceFile).Modify(func(records []service.ServiceRecord) ([]service.ServiceRecord, error) {
+			for _, check := range []struct {
+				label string
+				get   func(service.ServiceRecord) string
+			}{
+				{"LAN IP", func(r service.ServiceRecord) string { return r.LANIP }},
+				{"WAN IP", func(r service.ServiceRecord) string { return r.WANIP }},
+				{"service number", func(r service.ServiceRecord) string { return r.ServiceNumber }},
+			} {
+				value := strings.TrimSpace(check.get(r))
+				if value == "" {
+					continue
+				}
+				for _, x := range records {
+					if strings.EqualFold(strings.TrimSpace(check.get(x)), value) {
+						return nil, &duplicateError{label: check.label, value: value, owner: x.Location}
+					}
+				}
+			}
+
+			done = beginChange(cmd, "Added service record "+serviceKey(r), serviceFile)
+			return append(records, r), nil
+		})
+		done(err)
+		if errors.As(err, &dup) {
+			out.Printf("❌ %s %s is already used by %s\n", dup.label, dup.value, dup.owner)
+			return
+		}
+		if err != nil {
+			printServiceError("Failed to add service", err)
+			return
+		}
+		recordAudit(cmd, "service", "add", serviceKey(r), nil, r)
+		out.Printf("✅ Service record for %s added\n", r.Location)
+	},
+}
+
+var serviceRmCmd = &cobra.Command{
+	Use:     "rm",
+	Aliases: []string{"remove", "delete"},
+	Short:   "Delete the service records matching a selector",
+	Long: `Delete the service records matching every --where field=value.
+
+The matching records are listed and a confirmation is asked for unless
+--yes is given. If more than one record matches, --all is required. If
+the matching records change while the confirmation is pending, nothing is
+deleted.
+
+Example:
+
+  atmer service rm --where lan=10.20.2.1`,
+	Run: func(cmd *cobra.Command, args []string) {
+		selector, err := parseSelector(serviceRmWhere)
+		if err != nil {
+			out.Printf("❌ %s\n", err)
+			return
+		}
+
+		// list and confirm without holding the lock, so a prompt left
+		// unanswered does not block other atmer processes; the delete then
+		// checks the records are still the ones shown
+		store := openServices(serviceFile)
+		matches, err := store.Find(selector.Match)
+		if os.IsNotExist(err) || err == nil && len(matches) == 0 {
+			err = errNoMatch
+		}
+		if err == nil {
+			printServiceList(matches)
+			if len(matches) > 1 && !serviceRmAll {
+				err = errTooMany
+			}
+		}
+		if err == nil && !serviceRmYes {
+			out.Printf("❓ Confirm delete of %d record(s) (y/N): ", len(matches))
+			confirm := strings.ToLower(readLine(bufio.NewReader(os.Stdin)))
+			if confirm != "y" && confirm != "yes" {
+				err = errCancelled
+			}
+		}
+
+		done := func(error) {}
+		if err == nil {
+			err = store.Modify(func(records []service.ServiceRecord) ([]service.ServiceRecord, error) {
+				kept := make([]service.ServiceRecord, 0, len(records))
+				var doomed []service.ServiceRecord
+				for _, r := range records {
+					if selector.Match(r) {
+						doomed = append(doomed, r)
+					} else {
+						kept = append(kept, r)
+					}
+				}
+				if !slices.Equal(doomed, matches) {
+					return nil, errChanged
+				}
+				done = beginChange(cmd, fmt.Sprintf("Deleted %d service record(s): %s", len(matches), serviceKey(matches[0])), serviceFile)
+				return kept, nil
+			})
+			done(err)
+		}
+
+		switch {
+		case errors.Is(err, errNoMatch):
+			out.Printf("❌ No record matches %s.\n", strings.Join(serviceRmWhere, ", "))
+			return
+		case errors.Is(err, errTooMany):
+			out.Printf("❌ %d records match; use --all to delete every one of them\n", len(matches))
+			return
+		case errors.Is(err, errCancelled):
+			out.Println("🚫 Cancelled")
+			return
+		case errors.Is(err, errChanged):
+			out.Println("❌ The matching records changed while you confirmed; nothing was deleted. Re-run the command.")
+			return
+		case err != nil:
+			printServiceError("Failed to delete", err)
+			return
+		}
+		for _, r := range matches {
+			recordAudit(cmd, "service", "delete", serviceKey(r), r, nil)
+		}
+		out.Printf("✅ Deleted %d record(s)\n", len(matches))
+	},
+}
+
+var (
+	errTooMany   = errors.New("too many matching records")
+	errCancelled = errors.New("cancelled")
+	errChanged   = errors.New("records changed, re-run")
+)
+
+// duplicateError reports an address or service number already in use
+type duplicateError struct {
+	label, value, owner string
+}
+
+func (e *duplicateError) Error() string {
+	return fmt.Sprintf("%s %s is already used by %s", e.label, e.value, e.owner)
+}
+
+func init() {
+	serviceCmd.AddCommand(serviceAddCmd)
+	serviceCmd.AddCommand(serviceRmCmd)
+
+	for _, f := range serviceAddOrder {
+		serviceAddFields[f.flag] = serviceAddCmd.Flags().String(f.flag, "", f.usage)
+	}
+
+	serviceRmCmd.Flags().StringArrayVarP(&serviceRmWhere, "where", "w", nil, "Selector field=value; repeat to narrow down")
+	serviceRmCmd.Flags().BoolVar(&serviceRmAll, "all", false, "Allow deleting more than one record")
+	serviceRmCmd.Flags().BoolVarP(&serviceRmYes, "yes", "y", false, "Do not ask for confirmation")
+}
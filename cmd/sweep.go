@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+	"net/netip"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/fahmaliyi/atmer/pkg/atmer"
+)
+
+// sweepSelection narrows a report to some of the ATMs. Different kinds of
+// selector must all match and several of one kind are alternatives; the
+// zero value sweeps every ATM.
+type sweepSelection struct {
+	Names    []string // globs, or regexes between slashes such as /^BR-\d+$/
+	Prefixes []netip.Prefix
+	Regions  []string
+	Sheet    string // sheet to load instead of the first
+
+	From       string   // previous JSON report whose ATMs are swept again
+	FromStatus []string // only those of its ATMs that had these statuses
+
+	names []func(string) bool
+}
+
+// parseSweepSelection checks and compiles the selector flags
+func parseSweepSelection(names, cidrs, regions []string, sheet, from string) (sweepSelection, error) {
+	sel := sweepSelection{Names: names, Regions: regions, Sheet: sheet, From: from}
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if len(n) > 1 && strings.HasPrefix(n, "/") && strings.HasSuffix(n, "/") {
+			re, err := regexp.Compile("(?i)" + n[1:len(n)-1])
+			if err != nil {
+				return sel, fmt.Errorf("invalid name pattern %s: %w", n, err)
+			}
+			sel.names = append(sel.names, re.MatchString)
+			continue
+		}
+
+		glob := strings.ToLower(n)
+		if _, err := path.Match(glob, ""); err != nil {
+			return sel, fmt.Errorf("invalid name pattern %q: %w", n, err)
+		}
+		sel.names = append(sel.names, func(name string) bool {
+			ok, _ := path.Match(glob, strings.ToLower(name))
+			return ok
+		})
+	}
+
+	for _, c := range cidrs {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(c))
+		if err != nil {
+			return sel, fmt.Errorf("invalid CIDR %q", c)
+		}
+		sel.Prefixes = append(sel.Prefixes, prefix.Masked())
+	}
+	return sel, nil
+}
+
+// Partial reports whether the selection leaves ATMs out
+func (s sweepSelection) Partial() bool {
+	return len(s.Names) > 0 || len(s.Prefixes) > 0 || len(s.Regions) > 0 || s.Sheet != "" || s.From != ""
+}
+
+// String describes the selection for the outputs, e.g. "from=morning.json,
+// status=Offline, region=North"
+func (s sweepSelection) String() string {
+	var parts []string
+	if s.Sheet != "" {
+		parts = append(parts, "sheet="+s.Sheet)
+	}
+	if s.From != "" {
+		parts = append(parts, "from="+s.From)
+		if len(s.FromStatus) > 0 {
+			parts = append(parts, "status="+strings.Join(s.FromStatus, "|"))
+		}
+	}
+	if len(s.Names) > 0 {
+		parts = append(parts, "atm="+strings.Join(s.Names, "|"))
+	}
+	if len(s.Prefixes) > 0 {
+		var cidrs []string
+		for _, p := range s.Prefixes {
+			cidrs = append(cidrs, p.String())
+		}
+		parts = append(parts, "cidr="+strings.Join(cidrs, "|"))
+	}
+	if len(s.Regions) > 0 {
+		parts = append(parts, "region="+strings.Join(s.Regions, "|"))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Match reports whether the name, CIDR and region selectors take m
+func (s sweepSelection) Match(m atmer.Machine) bool {
+	if len(s.names) > 0 && !slices.ContainsFunc(s.names, func(match func(string) bool) bool { return match(m.Name) }) {
+		return false
+	}
+	if len(s.Prefixes) > 0 {
+		addr, err := service.ParseAddress(m.IP)
+		if err != nil || !slices.ContainsFunc(s.Prefixes, func(p netip.Prefix) bool { return p.Contains(addr.Unmap().WithZone("")) }) {
+			return false
+		}
+	}
+	if len(s.Regions) > 0 && !slices.ContainsFunc(s.Regions, func(r string) bool { return strings.EqualFold(r, m.Region) }) {
+		return false
+	}
+	return true
+}
+
+// Select returns the selected ATMs. ATMs of a --from report that are no
+// longer in the inventory are swept by the address the report gives.
+func (s sweepSelection) Select(machines []atmer.Machine) ([]atmer.Machine, error) {
+	candidates := machines
+	if s.From != "" {
+		previous, err := atmer.LoadResults(s.From)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", s.From, err)
+		}
+
+		byName := make(map[string]atmer.Machine, len(machines))
+		for _, m := range machines {
+			byName[strings.ToLower(m.Name)] = m
+		}
+		candidates = nil
+		for _, r := range previous {
+			if len(s.FromStatus) > 0 && !slices.ContainsFunc(s.FromStatus, func(st string) bool { return strings.EqualFold(st, r.Status) }) {
+				continue
+			}
+			m, ok := byName[strings.ToLower(r.Name)]
+			if !ok {
+				m = atmer.Machine{Name: r.Name, IP: r.IP}
+			}
+			candidates = append(candidates, m)
+		}
+	}
+
+	var selected []atmer.Machine
+	for _, m := range candidates {
+		if s.Match(m) {
+			selected = append(selected, m)
+		}
+	}
+	return selected, nil
+}
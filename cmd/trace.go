@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/fahmaliyi/atmer/internal/trace"
+	"github.com/fahmaliyi/atmer/internal/utils"
+	"github.com/fahmaliyi/atmer/pkg/atmer"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	traceMaxHops     int
+	traceTimeout     time.Duration
+	traceConcurrency int
+	tracePrivileged  bool
+)
+
+var traceCmd = &cobra.Command{
+	Use:   "trace <name|address>",
+	Short: "Traceroute to an ATM to see where its path breaks",
+	Long: `Trace the path to an ATM, hop by hop, with ICMP echo probes of growing
+TTL. The argument is an ATM name from the list or any address or hostname.
+
+No external traceroute is needed. Probes go over unprivileged ICMP sockets;
+if the system does not allow those (net.ipv4.ping_group_range on Linux),
+raw sockets are used instead, which needs root. --privileged goes straight
+to raw sockets.
+
+Examples:
+
+  atmer trace "Bole Branch"
+  atmer trace 10.20.1.10 --max-hops 15`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		address := args[0]
+		if machines, err := utils.LoadMachines(excelpath); err == nil {
+			if i := findMachine(machines, args[0]); i >= 0 {
+				address = machines[i].IP
+			}
+		}
+
+		dst, err := service.DefaultResolver.Resolve(address)
+		if err != nil {
+			out.Println("❌", err)
+			os.Exit(1)
+		}
+
+		out.Printf("🛰️ Tracing %s (%s), at most %d hops\n", args[0], dst, traceMaxHops)
+		res := newTracer().Trace(cmd.Context(), dst)
+		for _, h := range res.Hops {
+			if h.Addr.IsValid() {
+				out.Printf("%3d  %-40s %s\n", h.TTL, h.Addr, h.RTT.Round(10*time.Microsecond))
+			} else {
+				out.Printf("%3d  *\n", h.TTL)
+			}
+		}
+		if res.Err != nil {
+			out.Println("❌ Trace failed:", res.Err)
+			os.Exit(1)
+		}
+
+		summary := atmer.Trace{Target: res.Target, Reached: res.Reached}
+		if hop, ok := res.LastHop(); ok {
+			summary.LastHop, summary.LastTTL = hop.Addr, hop.TTL
+		}
+		out.Println()
+		out.Println(describeTrace(summary))
+	},
+}
+
+// newTracer builds a tracer from the trace flags
+func newTracer() *trace.Tracer {
+	t := trace.New(trace.ICMP{Privileged: tracePrivileged})
+	t.MaxHops = traceMaxHops
+	t.Timeout = traceTimeout
+	t.Concurrency = traceConcurrency
+	return t
+}
+
+// traceOptions are the trace flags, for a report's diagnosis
+func traceOptions() *atmer.TraceOptions {
+	return &atmer.TraceOptions{MaxHops: traceMaxHops, HopTimeout: traceTimeout, Concurrency: traceConcurrency, Privileged: tracePrivileged}
+}
+
+// describeTrace sums up where a path ends
+func describeTrace(t atmer.Trace) string {
+	if t.Reached {
+		return color.GreenString("✅ Reached %s in %d hops", t.Target, t.LastTTL)
+	}
+	if t.LastHop.IsValid() {
+		return color.YellowString("⚠️ Path breaks after hop %d, %s", t.LastTTL, t.LastHop)
+	}
+	return color.RedString("🔴 No hop answered")
+}
+
+func addTraceFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&traceMaxHops, "max-hops", 30, "Give up after this many hops")
+	cmd.Flags().DurationVar(&traceTimeout, "hop-timeout", time.Second, "Wait for each hop's answer")
+	cmd.Flags().BoolVar(&tracePrivileged, "privileged", false, "Use raw ICMP sockets (needs root)")
+}
+
+func init() {
+	rootCmd.AddCommand(traceCmd)
+	traceCmd.Flags().StringVarP(&excelpath, "path", "p", "atms.xlsx", "Path to Excel file")
+	addTraceFlags(traceCmd)
+}
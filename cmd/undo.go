@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fahmaliyi/atmer/internal/audit"
+	"github.com/fahmaliyi/atmer/internal/snapshot"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	snapshotDir string
+	restoreAt   string
+	restoreYes  bool
+)
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Revert the last change to the ATM list or service records",
+	Run: func(cmd *cobra.Command, args []string) {
+		v, err := snapshot.Open(snapshotDir).Undo()
+		if err != nil {
+			out.Println("❌ Failed to undo:", err)
+			return
+		}
+
+		for _, f := range v.Files {
+			recordAudit(cmd, "file", "undo", f.Path, nil, nil)
+		}
+		out.Printf("↩️ Undid version %d: %s (%s by %s)\n", v.ID, v.Summary, v.Time.Local().Format("2006-01-02 15:04"), v.User)
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore the ATM list and service records as of a version or time",
+	Long: `Restore the data files to how they were right after a version, or at a
+point in time. Use 'atmer versions' to list what can be restored.
+
+--at takes a version number or a time (2006-01-02, "2006-01-02 15:04",
+RFC 3339, or relative such as 2h or 3d). The restore itself is recorded as
+a new version, so 'atmer undo' takes it back.
+
+Examples:
+
+  atmer restore --at 12
+  atmer restore --at "2026-10-19 08:00"`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if restoreAt == "" {
+			out.Println("❌ Please give a version or time with --at")
+			return
+		}
+
+		store := snapshot.Open(snapshotDir)
+		var plan []snapshot.File
+		var label string
+		if id, err := strconv.Atoi(restoreAt); err == nil {
+			plan, err = store.PlanVersion(id)
+			if err != nil {
+				out.Println("❌ Cannot restore:", err)
+				return
+			}
+			label = fmt.Sprintf("version %d", id)
+		} else {
+			at, err := parseTime(restoreAt)
+			if err != nil {
+				out.Printf("❌ Invalid --at: %s\n", err)
+				return
+			}
+			plan, err = store.PlanTime(at)
+			if err != nil {
+				out.Println("❌ Cannot restore:", err)
+				return
+			}
+			label = at.Format("2006-01-02 15:04")
+		}
+		if len(plan) == 0 {
+			out.Printf("✅ Nothing to restore, the files already match %s\n", label)
+			return
+		}
+
+		out.Printf("🕘 Restoring to %s will overwrite:\n", label)
+		paths := make([]string, len(plan))
+		for i, f := range plan {
+			paths[i] = f.Path
+			out.Println("  -", f.Path)
+		}
+
+		if !restoreYes {
+			out.Print("❓ Continue (y/N): ")
+			confirm := strings.ToLower(readLine(bufio.NewReader(os.Stdin)))
+			if confirm != "y" && confirm != "yes" {
+				out.Println("🚫 Cancelled")
+				return
+			}
+		}
+
+		if _, err := store.Restore(plan, audit.CurrentUser(), cmd.CommandPath(), "Restored to "+label); err != nil {
+			out.Println("❌ Failed to restore:", err)
+			return
+		}
+
+		for _, p := range paths {
+			recordAudit(cmd, "file", "restore", p, nil, nil)
+		}
+		out.Printf("✅ Restored to %s\n", label)
+	},
+}
+
+var versionsCmd = &cobra.Command{
+	Use:   "versions",
+	Short: "List the versions available to undo and restore",
+	Run: func(cmd *cobra.Command, args []string) {
+		versions, err := snapshot.Open(snapshotDir).List()
+		if err != nil {
+			out.Println("❌ Failed to read versions:", err)
+			return
+		}
+		if len(versions) == 0 {
+			out.Println("❌ No versions recorded yet.")
+			return
+		}
+
+		cyan := color.New(color.FgCyan, color.Bold).SprintFunc()
+		out.Printf("🕘 %d version(s), newest first:\n\n", len(versions))
+		for i := len(versions) - 1; i >= 0; i-- {
+			v := versions[i]
+			out.Printf("%s %s %s %s\n", cyan(fmt.Sprintf("%4d", v.ID)), v.Time.Local().Format("2006-01-02 15:04:05"), v.User, v.Summary)
+		}
+	},
+}
+
+// beginChange snapshots files before a change so it can be undone. Call the
+// returned function with the outcome; a failed change drops the snapshot.
+func beginChange(cmd *cobra.Command, summary string, files ...string) func(error) {
+	store := snapshot.Open(snapshotDir)
+	v, err := store.Take(audit.CurrentUser(), cmd.CommandPath(), summary, files...)
+	if err != nil {
+		out.Println("⚠️ Failed to snapshot for undo:", err)
+		return func(error) {}
+	}
+
+	return func(err error) {
+		if err != nil {
+			store.Discard(v)
+		}
+	}
+}
+
+// beginTransaction is beginChange for a change spanning several files: if
+// it fails, every file is put back as it was before. Without a snapshot
+// there is nothing to roll back to, so that is an error here.
+func beginTransaction(cmd *cobra.Command, summary string, files ...string) (func(error), error) {
+	store := snapshot.Open(snapshotDir)
+	v, err := store.Take(audit.CurrentUser(), cmd.CommandPath(), summary, files...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot: %w", err)
+	}
+
+	return func(err error) {
+		if err == nil {
+			return
+		}
+		if rerr := store.Rollback(v); rerr != nil {
+			out.Println("⚠️ Failed to roll back:", rerr)
+		}
+	}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+	rootCmd.AddCommand(restoreCmd)
+	rootCmd.AddCommand(versionsCmd)
+	rootCmd.PersistentFlags().StringVar(&snapshotDir, "snapshot-dir", ".atmer/snapshots", "Directory keeping versions for undo and restore")
+
+	restoreCmd.Flags().StringVar(&restoreAt, "at", "", "Version number or time to restore to")
+	restoreCmd.Flags().BoolVarP(&restoreYes, "yes", "y", false, "Do not ask for confirmation")
+}
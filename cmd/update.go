@@ -1,93 +1,311 @@
 package cmd
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 
+	"github.com/fahmaliyi/atmer/internal/query"
 	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
 var (
-	updateFile  string
+	updateFile   string
+	updateWhere  []string
+	updateSet    []string
+	updateAll    bool
+	updateDryRun bool
+	updateYes    bool
+
+	// deprecated single-field flags
 	updateKey   string
 	updateVal   string
 	updateMatch string
 )
 
+var (
+	errNoMatch = errors.New("no matching record found")
+	errDryRun  = errors.New("dry run")
+)
+
 var updateServiceCmd = &cobra.Command{
 	Use:   "update",
-	Short: "Update a service record field by service number",
+	Short: "Update fields of the service records matching a selector",
+	Long: `Update one or more fields of the service records matching a selector.
+
+Every --where must match (field=value, exact and case-insensitive; * and
+? are wildcards, and a CIDR such as lan=10.20.0.0/16 matches a whole
+subnet). Each --set assigns a
+field, validated for its type: IPs must parse and bandwidths need a known
+unit (a bare number is Mbps). A diff is shown for every matching record;
+--dry-run stops there, otherwise a confirmation is asked for unless --yes
+is given. If more than one record matches, --all is required. If the
+matching records change while the confirmation is pending, nothing is
+written.
+
+Examples:
+
+  atmer update --where wanip=196.1.1.2 --set bandwidth=8 --set linetype=fiber
+  atmer update --where lan=10.20.0.0/16 --set conn=MPLS --all --dry-run`,
 	Run: func(cmd *cobra.Command, args []string) {
-		content, err := os.ReadFile(updateFile)
+		if updateMatch != "" {
+			updateWhere = append(updateWhere, "lanip="+updateMatch)
+		}
+		if updateKey != "" {
+			updateSet = append(updateSet, updateKey+"="+updateVal)
+		}
+
+		selector, err := parseSelector(updateWhere)
 		if err != nil {
-			fmt.Printf("❌ Failed to read JSON file: %s\n", err)
+			out.Printf("❌ %s\n", err)
 			return
 		}
 
-		var records []service.ServiceRecord
-		if err := json.Unmarshal(content, &records); err != nil {
-			fmt.Printf("❌ Failed to parse JSON: %s\n", err)
+		sets, err := parseAssignments(updateSet)
+		if err != nil {
+			out.Printf("❌ %s\n", err)
 			return
 		}
 
-		updated := false
+		// diff and confirm without holding the lock, so a prompt left
+		// unanswered does not block other atmer processes; the update then
+		// checks the records are still the ones shown
+		records, err := openServices(updateFile).Load()
+		var plan updatePlan
+		switch {
+		case os.IsNotExist(err):
+			err = errNoMatch
+		case err == nil:
+			plan, err = planUpdate(records, selector, sets, updateAll)
+		}
+		if err == nil {
+			printDiffs(plan.matched, plan.diffs)
+			switch {
+			case updateDryRun:
+				err = errDryRun
+			case !updateYes && !confirm("❓ Update %d record(s) (y/N): ", len(plan.matched)):
+				err = errCancelled
+			default:
+				err = applyUpdate(cmd, selector, plan)
+			}
+		}
+
+		switch {
+		case errors.Is(err, errNoMatch):
+			out.Printf("❌ No record matches %s.\n", strings.Join(updateWhere, ", "))
+			return
+		case errors.Is(err, errTooMany):
+			printServiceList(plan.matched)
+			out.Printf("❌ %d records match; use --all to update every one of them\n", len(plan.matched))
+			return
+		case errors.Is(err, errDryRun):
+			out.Println("🔍 Dry run, nothing written.")
+			return
+		case errors.Is(err, errCancelled):
+			out.Println("🚫 Cancelled")
+			return
+		case errors.Is(err, errChanged):
+			out.Println("❌ The matching records changed while you confirmed; nothing was updated. Re-run the command.")
+			return
+		case err != nil:
+			printServiceError("Failed to update", err)
+			return
+		}
+
+		for i, r := range plan.matched {
+			if len(plan.diffs[i]) > 0 {
+				recordAudit(cmd, "service", "edit", serviceKey(r), r, plan.updated[i])
+			}
+		}
+		out.Printf("✅ Updated %d record(s).\n", len(plan.matched))
+	},
+}
+
+// updatePlan is an update as shown before it is confirmed: the matching
+// records, as they are and with the assignments applied
+type updatePlan struct {
+	matched []service.ServiceRecord
+	updated []service.ServiceRecord
+	diffs   [][]service.Change
+}
+
+// planUpdate applies the assignments to copies of the records the selector
+// matches. More than one match is errTooMany unless all is set; matched is
+// filled in either way.
+func planUpdate(records []service.ServiceRecord, selector *query.Query[service.ServiceRecord], sets [][2]string, all bool) (updatePlan, error) {
+	var plan updatePlan
+	for _, r := range records {
+		if selector.Match(r) {
+			plan.matched = append(plan.matched, r)
+		}
+	}
+	if len(plan.matched) == 0 {
+		return plan, errNoMatch
+	}
+	if len(plan.matched) > 1 && !all {
+		return plan, errTooMany
+	}
+
+	for _, r := range plan.matched {
+		after := r
+		for _, s := range sets {
+			if err := service.SetServiceField(&after, s[0], s[1]); err != nil {
+				return plan, err
+			}
+		}
+		plan.updated = append(plan.updated, after)
+		plan.diffs = append(plan.diffs, service.ServiceChanges(r, after))
+	}
+	return plan, nil
+}
+
+// applyUpdate writes a confirmed plan. If the selector no longer matches
+// exactly the records the plan was made from, nothing is written and
+// errChanged is returned; other records may have changed meanwhile and
+// are kept as they are now.
+func applyUpdate(cmd *cobra.Command, selector *query.Query[service.ServiceRecord], plan updatePlan) error {
+	done := func(error) {}
+	err := openServices(updateFile).Modify(func(records []service.ServiceRecord) ([]service.ServiceRecord, error) {
+		var idx []int
+		var current []service.ServiceRecord
 		for i, r := range records {
-			if strings.EqualFold(strings.TrimSpace(r.LANIP), strings.TrimSpace(updateMatch)) {
-				switch strings.ToLower(updateKey) {
-				case "location":
-					records[i].Location = updateVal
-				case "wanip":
-					records[i].WANIP = updateVal
-				case "lanip":
-					records[i].LANIP = updateVal
-				case "connectiontype":
-					records[i].ConnectionType = updateVal
-				case "bandwidth":
-					records[i].Bandwidth = updateVal
-				case "linetype":
-					records[i].LineType = updateVal
-				case "servicenumber":
-					records[i].ServiceNumber = updateVal
-				case "accountnumber":
-					records[i].AccountNumber = updateVal
-				default:
-					fmt.Printf("❌ Unknown field: %s\n", updateKey)
-					return
-				}
+			if selector.Match(r) {
+				idx = append(idx, i)
+				current = append(current, r)
 			}
+		}
+		if !slices.Equal(current, plan.matched) {
+			return nil, errChanged
+		}
 
-			updated = true
+		for n, i := range idx {
+			records[i] = plan.updated[n]
 		}
+		done = beginChange(cmd, describeUpdate(plan.diffs), updateFile)
+		return records, nil
+	})
+	done(err)
+	return err
+}
 
-		if !updated {
-			fmt.Printf("❌ No record found with WANIP '%s'.\n", updateMatch)
-			return
+// parseSelector turns field=value pairs into a service record query
+// matching all of them
+func parseSelector(where []string) (*query.Query[service.ServiceRecord], error) {
+	return parseWhere(service.ServiceSchema, where)
+}
+
+// parseWhere turns field=value pairs into a query over schema matching all
+// of them; values containing a '/' are CIDR prefixes
+func parseWhere[T any](schema query.Schema[T], where []string) (*query.Query[T], error) {
+	if len(where) == 0 {
+		return nil, fmt.Errorf("specify at least one --where field=value")
+	}
+
+	var terms query.And
+	for _, w := range where {
+		field, value, ok := strings.Cut(w, "=")
+		if !ok || strings.TrimSpace(field) == "" {
+			return nil, fmt.Errorf("invalid selector %q, expected field=value", w)
 		}
 
-		newContent, err := json.MarshalIndent(records, "", "  ")
-		if err != nil {
-			fmt.Printf("❌ Failed to marshal updated JSON: %s\n", err)
-			return
+		term := query.Term{Field: strings.TrimSpace(field), Op: "=", Value: strings.TrimSpace(value)}
+		if strings.Contains(term.Value, "/") {
+			term.Op = "" // CIDR
 		}
+		terms = append(terms, term)
+	}
 
-		if err := os.WriteFile(updateFile, newContent, 0644); err != nil {
-			fmt.Printf("❌ Failed to write JSON file: %s\n", err)
-			return
+	return schema.CompileNode(terms)
+}
+
+// parseAssignments splits field=value pairs and checks each against the
+// field's type before anything is loaded
+func parseAssignments(set []string) ([][2]string, error) {
+	if len(set) == 0 {
+		return nil, fmt.Errorf("specify at least one --set field=value")
+	}
+
+	sets := make([][2]string, 0, len(set))
+	for _, s := range set {
+		field, value, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid assignment %q, expected field=value", s)
 		}
 
-		fmt.Printf("✅ Record with WANIP %s updated successfully.\n", updateMatch)
-	},
+		var scratch service.ServiceRecord
+		if err := service.SetServiceField(&scratch, field, value); err != nil {
+			return nil, err
+		}
+		sets = append(sets, [2]string{field, value})
+	}
+	return sets, nil
+}
+
+// describeUpdate summarises an update for the version list
+func describeUpdate(diffs [][]service.Change) string {
+	var fields []string
+	seen := map[string]bool{}
+	for _, d := range diffs {
+		for _, c := range d {
+			if !seen[c.Field] {
+				seen[c.Field] = true
+				fields = append(fields, c.Field)
+			}
+		}
+	}
+	return fmt.Sprintf("Updated %d service record(s): %s", len(diffs), strings.Join(fields, ", "))
+}
+
+func printDiffs(records []service.ServiceRecord, diffs [][]service.Change) {
+	cyan := color.New(color.FgCyan, color.Bold).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+
+	for i, r := range records {
+		out.Printf("✏️ %s (LAN %s, WAN %s)\n", r.Location, r.LANIP, r.WANIP)
+		if len(diffs[i]) == 0 {
+			out.Println("   no changes")
+		}
+		for _, c := range diffs[i] {
+			out.Printf("   %s %s → %s\n", cyan(c.Field+":"), red(quoteEmpty(c.Old)), green(quoteEmpty(c.New)))
+		}
+	}
+	out.Println()
+}
+
+func printServiceList(records []service.ServiceRecord) {
+	out.Println("🔎 Matching records:")
+	for i, r := range records {
+		out.Printf("%d. %s (LAN %s, WAN %s)\n", i+1, r.Location, r.LANIP, r.WANIP)
+	}
+}
+
+func quoteEmpty(s string) string {
+	if s == "" {
+		return `""`
+	}
+	return s
 }
 
 func init() {
 	// update flags
 	updateServiceCmd.Flags().StringVarP(&updateFile, "file", "f", "services.json", "Path to JSON file")
-	updateServiceCmd.Flags().StringVarP(&updateMatch, "match", "m", "", "Unique field value to identify the record (e.g. WANIP)")
+	updateServiceCmd.Flags().StringArrayVarP(&updateWhere, "where", "w", nil, "Selector field=value; repeat to narrow down")
+	updateServiceCmd.Flags().StringArrayVar(&updateSet, "set", nil, "Assignment field=value; repeat to set several fields")
+	updateServiceCmd.Flags().BoolVar(&updateAll, "all", false, "Allow updating more than one record")
+	updateServiceCmd.Flags().BoolVar(&updateDryRun, "dry-run", false, "Show the diff without writing")
+	updateServiceCmd.Flags().BoolVarP(&updateYes, "yes", "y", false, "Do not ask for confirmation")
+
+	updateServiceCmd.Flags().StringVarP(&updateMatch, "match", "m", "", "LAN IP of the record to update")
 	updateServiceCmd.Flags().StringVarP(&updateKey, "key", "k", "", "Field to update (location, wanip, lanip, etc.)")
 	updateServiceCmd.Flags().StringVarP(&updateVal, "value", "v", "", "New value for the field")
+	updateServiceCmd.Flags().MarkDeprecated("match", "use --where lanip=<ip>")
+	updateServiceCmd.Flags().MarkDeprecated("key", "use --set <field>=<value>")
+	updateServiceCmd.Flags().MarkDeprecated("value", "use --set <field>=<value>")
 
 	rootCmd.AddCommand(updateServiceCmd)
 }
@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fahmaliyi/atmer/internal/service"
+)
+
+var circuits = []service.ServiceRecord{
+	{Location: "Bole", LANIP: "10.20.1.10", WANIP: "196.1.1.2", ConnectionType: "ADSL", ServiceNumber: "S1"},
+	{Location: "Piassa", LANIP: "10.20.2.10", WANIP: "196.1.1.3", ConnectionType: "ADSL", ServiceNumber: "S2"},
+	{Location: "Kality", LANIP: "10.40.1.10", WANIP: "196.1.2.2", ConnectionType: "MPLS", ServiceNumber: "S3"},
+}
+
+func TestPlanUpdate(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		where, set []string
+		all        bool
+		want       string // the diffs, or the error
+	}{
+		{name: "one match", where: []string{"wanip=196.1.1.2"}, set: []string{"bandwidth=8"},
+			want: "Bole: bw  → 8 Mbps"},
+		{name: "several fields", where: []string{"location=kality"}, set: []string{"conn=Fiber", "line=copper"},
+			want: "Kality: conn MPLS → Fiber, line  → copper"},
+		{name: "cidr with --all", where: []string{"lan=10.20.0.0/16"}, set: []string{"conn=MPLS"}, all: true,
+			want: "Bole: conn ADSL → MPLS; Piassa: conn ADSL → MPLS"},
+		{name: "wildcard and a second selector", where: []string{"location=*a*", "conn=mpls"}, set: []string{"sn=S9"},
+			want: "Kality: service S3 → S9"},
+		{name: "unchanged", where: []string{"sn=S1"}, set: []string{"location=Bole"},
+			want: "Bole: "},
+
+		{name: "several without --all", where: []string{"conn=ADSL"}, set: []string{"conn=MPLS"},
+			want: errTooMany.Error()},
+		{name: "no match", where: []string{"location=Ayat"}, set: []string{"conn=MPLS"},
+			want: errNoMatch.Error()},
+		{name: "no --where", set: []string{"conn=MPLS"},
+			want: "specify at least one --where"},
+		{name: "bad selector", where: []string{"location"}, set: []string{"conn=MPLS"},
+			want: `invalid selector "location"`},
+		{name: "no --set", where: []string{"sn=S1"},
+			want: "specify at least one --set"},
+		{name: "bad ip", where: []string{"sn=S1"}, set: []string{"lan=10.20.1"},
+			want: "10.20.1"},
+		{name: "unknown field", where: []string{"sn=S1"}, set: []string{"colour=red"},
+			want: `unknown field "colour"`},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			plan, err := plan(c.where, c.set, c.all)
+			if err != nil {
+				if !strings.Contains(err.Error(), c.want) {
+					t.Errorf("error %q, want it to mention %q", err, c.want)
+				}
+				return
+			}
+			if got := describePlan(plan); got != c.want {
+				t.Errorf("diffs = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func plan(where, set []string, all bool) (updatePlan, error) {
+	selector, err := parseSelector(where)
+	if err != nil {
+		return updatePlan{}, err
+	}
+	sets, err := parseAssignments(set)
+	if err != nil {
+		return updatePlan{}, err
+	}
+	return planUpdate(circuits, selector, sets, all)
+}
+
+// describePlan lists each record's changes as "location: field old → new"
+func describePlan(plan updatePlan) string {
+	var records []string
+	for i, r := range plan.matched {
+		var changes []string
+		for _, c := range plan.diffs[i] {
+			changes = append(changes, c.Field+" "+c.Old+" → "+c.New)
+		}
+		records = append(records, r.Location+": "+strings.Join(changes, ", "))
+	}
+	return strings.Join(records, "; ")
+}
+
+// useUpdate points update at a temporary services file holding circuits
+func useUpdate(t *testing.T) {
+	t.Helper()
+	useInventory(t, nil)
+	useServices(t, circuits)
+	saved := updateFile
+	t.Cleanup(func() { updateFile = saved })
+	updateFile = serviceFile
+}
+
+func TestApplyUpdateKeepsConcurrentChanges(t *testing.T) {
+	useUpdate(t)
+	p, err := plan([]string{"location=Bole"}, []string{"conn=MPLS"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another record changes while the diff is on screen
+	if err := openServices(serviceFile).Modify(func(records []service.ServiceRecord) ([]service.ServiceRecord, error) {
+		records[2].ConnectionType = "VSAT"
+		return records, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	selector, _ := parseSelector([]string{"location=Bole"})
+	if err := applyUpdate(updateServiceCmd, selector, p); err != nil {
+		t.Fatal(err)
+	}
+	if got := serviceConns(t); got != "Bole MPLS, Piassa ADSL, Kality VSAT" {
+		t.Errorf("services = %q", got)
+	}
+}
+
+func TestApplyUpdateRefusesChangedSelection(t *testing.T) {
+	useUpdate(t)
+	p, err := plan([]string{"conn=ADSL"}, []string{"conn=MPLS"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Kality now matches the selector too
+	if err := openServices(serviceFile).Modify(func(records []service.ServiceRecord) ([]service.ServiceRecord, error) {
+		records[2].ConnectionType = "ADSL"
+		return records, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	selector, _ := parseSelector([]string{"conn=ADSL"})
+	if err := applyUpdate(updateServiceCmd, selector, p); !errors.Is(err, errChanged) {
+		t.Fatalf("err = %v, want errChanged", err)
+	}
+	if got := serviceConns(t); got != "Bole ADSL, Piassa ADSL, Kality ADSL" {
+		t.Errorf("services changed to %q", got)
+	}
+}
+
+func serviceConns(t *testing.T) string {
+	t.Helper()
+	records, err := openServices(serviceFile).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conns []string
+	for _, r := range records {
+		conns = append(conns, r.Location+" "+r.ConnectionType)
+	}
+	return strings.Join(conns, ", ")
+}
+
+// runUpdate runs the update command with the flags given, answering its
+// confirmation with answer, and returns what it printed
+func runUpdate(t *testing.T, where, set []string, all, yes bool, answer string) string {
+	t.Helper()
+	buf := captureOutput(t, "", true)
+
+	stdin := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(stdin, []byte(answer), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(stdin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	saved := [2][]string{updateWhere, updateSet}
+	savedAll, savedYes, savedStdin := updateAll, updateYes, os.Stdin
+	t.Cleanup(func() {
+		updateWhere, updateSet = saved[0], saved[1]
+		updateAll, updateYes, os.Stdin = savedAll, savedYes, savedStdin
+	})
+	updateWhere, updateSet, updateAll, updateYes, os.Stdin = where, set, all, yes, f
+
+	updateServiceCmd.Run(updateServiceCmd, nil)
+	return buf.String()
+}
+
+func TestUpdateConfirms(t *testing.T) {
+	useUpdate(t)
+
+	printed := runUpdate(t, []string{"lan=10.20.0.0/16"}, []string{"conn=MPLS"}, true, false, "n\n")
+	if !strings.Contains(printed, "conn: ADSL → MPLS") || !strings.Contains(printed, "Update 2 record(s) (y/N)") || !strings.Contains(printed, "Cancelled") {
+		t.Errorf("a declined update printed:\n%s", printed)
+	}
+	if got := serviceConns(t); got != "Bole ADSL, Piassa ADSL, Kality MPLS" {
+		t.Errorf("a declined update wrote %q", got)
+	}
+
+	printed = runUpdate(t, []string{"lan=10.20.0.0/16"}, []string{"conn=MPLS"}, true, false, "y\n")
+	if !strings.Contains(printed, "Updated 2 record(s)") {
+		t.Errorf("a confirmed update printed:\n%s", printed)
+	}
+	if got := serviceConns(t); got != "Bole MPLS, Piassa MPLS, Kality MPLS" {
+		t.Errorf("a confirmed update wrote %q", got)
+	}
+}
+
+func TestUpdateYes(t *testing.T) {
+	useUpdate(t)
+
+	printed := runUpdate(t, []string{"sn=S1"}, []string{"bw=20"}, false, true, "")
+	if strings.Contains(printed, "(y/N)") || !strings.Contains(printed, "Updated 1 record(s)") {
+		t.Errorf("update --yes printed:\n%s", printed)
+	}
+
+	// more than one match without --all lists them and writes nothing
+	printed = runUpdate(t, []string{"conn=ADSL"}, []string{"conn=MPLS"}, false, true, "")
+	if !strings.Contains(printed, "2 records match; use --all") || !strings.Contains(printed, "2. Piassa") {
+		t.Errorf("update without --all printed:\n%s", printed)
+	}
+	if got := serviceConns(t); got != "Bole ADSL, Piassa ADSL, Kality MPLS" {
+		t.Errorf("update without --all wrote %q", got)
+	}
+}
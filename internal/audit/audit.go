@@ -0,0 +1,247 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry is one change to the ATM inventory or the service records
+type Entry struct {
+	Time    time.Time       `json:"time"`
+	User    string          `json:"user"`
+	Command string          `json:"command"`
+	Entity  string          `json:"entity"` // "atm" or "service"
+	Key     string          `json:"key"`    // what was changed, e.g. the ATM name
+	Action  string          `json:"action"` // "add", "edit" or "delete"
+	Before  json.RawMessage `json:"before,omitempty"`
+	After   json.RawMessage `json:"after,omitempty"`
+}
+
+// NewEntry builds an entry for the current user and time; before is nil
+// for additions and after is nil for deletions
+func NewEntry(command, entity, action, key string, before, after any) Entry {
+	return Entry{
+		Time:    time.Now(),
+		User:    CurrentUser(),
+		Command: command,
+		Entity:  entity,
+		Key:     key,
+		Action:  action,
+		Before:  raw(before),
+		After:   raw(after),
+	}
+}
+
+func raw(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// CurrentUser returns the OS user name, falling back to the environment
+func CurrentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	for _, env := range []string{"USER", "USERNAME"} {
+		if name := os.Getenv(env); name != "" {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// Log is an audit log kept as JSON Lines, one entry per line. Entries are
+// appended with a single write each, so writers need no lock and never
+// rewrite what is already there.
+type Log struct {
+	path string
+}
+
+// Open returns the audit log stored at path
+func Open(path string) *Log {
+	return &Log{path: path}
+}
+
+// Append adds entries to the log
+func (l *Log) Append(entries ...Entry) error {
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// a writer that died mid-line left it unterminated; end it so the
+	// next entry starts on a line of its own
+	sep, err := torn(f)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if sep {
+			line = append([]byte{'\n'}, line...)
+			sep = false
+		}
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// torn reports whether the file does not end with a newline
+func torn(f *os.File) (bool, error) {
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return false, err
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+		return false, err
+	}
+	return last[0] != '\n', nil
+}
+
+// load reads every entry. Lines that do not parse, such as the last one
+// of a writer that died mid-write, are skipped.
+func (l *Log) load() ([]Entry, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var e Entry
+			if jerr := json.Unmarshal(line, &e); jerr != nil {
+				slog.Warn("skipping damaged audit log line", "path", l.path, "line", n, "err", jerr)
+			} else {
+				entries = append(entries, e)
+			}
+		}
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Filter selects log entries; zero fields match everything
+type Filter struct {
+	Entity string
+	Key    string // case-insensitive substring
+	User   string
+	Since  time.Time
+	Until  time.Time
+}
+
+// Match reports whether e passes the filter
+func (f Filter) Match(e Entry) bool {
+	switch {
+	case f.Entity != "" && !strings.EqualFold(e.Entity, f.Entity):
+		return false
+	case f.Key != "" && !strings.Contains(strings.ToLower(e.Key), strings.ToLower(f.Key)):
+		return false
+	case f.User != "" && !strings.EqualFold(e.User, f.User):
+		return false
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && e.Time.After(f.Until):
+		return false
+	}
+	return true
+}
+
+// Find returns the entries passing the filter, oldest first
+func (l *Log) Find(f Filter) ([]Entry, error) {
+	entries, err := l.load()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var found []Entry
+	for _, e := range entries {
+		if f.Match(e) {
+			found = append(found, e)
+		}
+	}
+	return found, nil
+}
+
+// Change is a field whose value differs between Before and After
+type Change struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// Changes lists the top-level fields that differ between Before and After
+func (e Entry) Changes() []Change {
+	before, after := fields(e.Before), fields(e.After)
+
+	var keys []string
+	seen := map[string]bool{}
+	for _, m := range []map[string]any{before, after} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []Change
+	for _, k := range keys {
+		old, cur := render(before[k]), render(after[k])
+		if old != cur {
+			changes = append(changes, Change{Field: k, Old: old, New: cur})
+		}
+	}
+	return changes
+}
+
+func fields(data json.RawMessage) map[string]any {
+	m := map[string]any{}
+	if len(data) > 0 {
+		json.Unmarshal(data, &m)
+	}
+	return m
+}
+
+func render(v any) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAppendConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l := Open(path)
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 20 {
+				// a separate Log, as another process would have
+				e := NewEntry("atmer test", "atm", "edit", fmt.Sprintf("g%d-%d", g, i), map[string]string{"region": "North"}, map[string]string{"region": "South"})
+				if err := Open(path).Append(e); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	entries, err := l.Find(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 160 {
+		t.Errorf("got %d entries, want 160", len(entries))
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Count(string(data), "\n"); lines != 160 {
+		t.Errorf("file has %d lines, want one per entry", lines)
+	}
+}
+
+func TestTornLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l := Open(path)
+	if err := l.Append(NewEntry("atmer test", "atm", "add", "Bole", nil, map[string]string{"name": "Bole"})); err != nil {
+		t.Fatal(err)
+	}
+
+	// a writer died half way through its entry
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time":"2026-10-19T08:00:00Z","user":"ali`)
+	f.Close()
+
+	entries, err := l.Find(Filter{})
+	if err != nil {
+		t.Fatalf("Find with a torn last line: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Key != "Bole" {
+		t.Fatalf("entries = %+v, want only Bole", entries)
+	}
+
+	// the next entry must not be glued onto the torn line
+	if err := l.Append(NewEntry("atmer test", "atm", "delete", "Piassa", map[string]string{"name": "Piassa"}, nil)); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = l.Find(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[1].Key != "Piassa" {
+		t.Errorf("entries = %+v, want Bole and Piassa", entries)
+	}
+}
+
+func TestFindMissingLog(t *testing.T) {
+	entries, err := Open(filepath.Join(t.TempDir(), "audit.jsonl")).Find(Filter{})
+	if err != nil || entries != nil {
+		t.Errorf("Find on a missing log = %v, %v, want nothing", entries, err)
+	}
+}
+
+func TestFindFilter(t *testing.T) {
+	l := Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err := l.Append(
+		NewEntry("atmer atm add", "atm", "add", "Bole Branch", nil, map[string]string{"name": "Bole Branch"}),
+		NewEntry("atmer service add", "service", "add", "Bole (10.0.0.1)", nil, map[string]string{"location": "Bole"}),
+		NewEntry("atmer atm add", "atm", "add", "Piassa", nil, map[string]string{"name": "Piassa"}),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := l.Find(Filter{Entity: "ATM", Key: "bole"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Key != "Bole Branch" {
+		t.Errorf("entries = %+v, want only the Bole Branch ATM", entries)
+	}
+}
@@ -0,0 +1,253 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fahmaliyi/atmer/internal/cron"
+	"github.com/fahmaliyi/atmer/internal/mail"
+	"github.com/fahmaliyi/atmer/internal/service"
+)
+
+// DefaultPath is where atmer looks for its config when --config is not given
+const DefaultPath = "atmer.json"
+
+// Config holds the settings that are too structured for flags
+type Config struct {
+	// Status is the decision table mapping link states to a status; the
+	// first rule that holds wins
+	Status []service.StatusRule `json:"status,omitempty"`
+
+	// Regions describes the regions of the ATM list's Region column
+	Regions []Region `json:"regions,omitempty"`
+
+	// Jobs are the reports 'atmer schedule' runs
+	Jobs []Job `json:"jobs,omitempty"`
+
+	// SMTP is the mail server reports are sent through
+	SMTP *mail.Config `json:"smtp,omitempty"`
+
+	// Maintenance lists ATMs and regions left out of the counts, on top
+	// of the ATM list's Maintenance column
+	Maintenance []Maintenance `json:"maintenance,omitempty"`
+}
+
+// Maintenance is a maintenance window for one ATM or a whole region
+type Maintenance struct {
+	ATM    string `json:"atm,omitempty"` // name or address
+	Region string `json:"region,omitempty"`
+	From   string `json:"from,omitempty"`  // e.g. "2026-10-20 22:00"; empty if already started
+	Until  string `json:"until,omitempty"` // a bare date includes that day; empty if open-ended
+	Reason string `json:"reason,omitempty"`
+	Probe  bool   `json:"probe,omitempty"` // probe anyway and report separately
+}
+
+// Window parses the maintenance times
+func (m Maintenance) Window() (service.Window, error) {
+	w := service.Window{ATM: m.ATM, Region: m.Region, Reason: m.Reason, Probe: m.Probe}
+	if m.ATM == "" && m.Region == "" {
+		return w, fmt.Errorf("maintenance needs an atm or a region")
+	}
+	if m.ATM != "" && m.Region != "" {
+		return w, fmt.Errorf("maintenance for %s: give an atm or a region, not both", m.ATM)
+	}
+
+	var err error
+	if m.From != "" {
+		if w.From, err = service.ParseWhen(m.From, false); err != nil {
+			return w, fmt.Errorf("maintenance for %s%s: %w", m.ATM, m.Region, err)
+		}
+	}
+	if m.Until != "" {
+		if w.Until, err = service.ParseWhen(m.Until, true); err != nil {
+			return w, fmt.Errorf("maintenance for %s%s: %w", m.ATM, m.Region, err)
+		}
+		if !w.From.IsZero() && !w.Until.After(w.From) {
+			return w, fmt.Errorf("maintenance for %s%s ends before it starts", m.ATM, m.Region)
+		}
+	}
+	return w, nil
+}
+
+// Job is a report run on a cron schedule
+type Job struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"` // cron expression, e.g. "0 7,13 * * 1-6"
+
+	Inventory string   `json:"inventory,omitempty"` // Excel file, default atms.xlsx
+	Outputs   []string `json:"outputs"`             // files to write; {date} and {time} are filled in
+	History   string   `json:"history,omitempty"`   // status history file; empty keeps none
+
+	Status        []string `json:"status,omitempty"`         // list only these statuses
+	ExcludeStatus []string `json:"exclude_status,omitempty"` // leave these statuses out
+	Where         []string `json:"where,omitempty"`          // list only ATMs matching these field=value selectors
+	NoOnline      bool     `json:"no_online,omitempty"`      // deprecated: exclude_status ["Online"]
+	NoOffline     bool     `json:"no_offline,omitempty"`     // deprecated: exclude_status ["Offline"]
+
+	GroupBy    []string `json:"group_by,omitempty"`
+	GroupMin   int      `json:"group_min,omitempty"`   // default 3
+	SubnetBits int      `json:"subnet_bits,omitempty"` // default 24
+	Diagnose   bool     `json:"diagnose,omitempty"`
+
+	Workers      int    `json:"workers,omitempty"`       // ATMs probed at once, default 16
+	Recheck      *int   `json:"recheck,omitempty"`       // re-checks of failures, default 1
+	RecheckDelay string `json:"recheck_delay,omitempty"` // e.g. "30s", default 10s
+
+	MailTo []string `json:"mail_to,omitempty"` // recipients of the report
+}
+
+// InventoryPath returns the job's Excel file
+func (j Job) InventoryPath() string {
+	if j.Inventory == "" {
+		return "atms.xlsx"
+	}
+	return j.Inventory
+}
+
+// SweepWorkers returns how many ATMs the job probes at once
+func (j Job) SweepWorkers() int {
+	if j.Workers == 0 {
+		return 16
+	}
+	return j.Workers
+}
+
+// Rechecks returns how many times the job re-checks failures
+func (j Job) Rechecks() int {
+	if j.Recheck == nil {
+		return 1
+	}
+	return *j.Recheck
+}
+
+// RecheckWait returns the wait before each re-check
+func (j Job) RecheckWait() (time.Duration, error) {
+	if j.RecheckDelay == "" {
+		return 10 * time.Second, nil
+	}
+	d, err := time.ParseDuration(j.RecheckDelay)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid recheck_delay %q", j.RecheckDelay)
+	}
+	return d, nil
+}
+
+// Region is one region of the network
+type Region struct {
+	Name string `json:"name"`
+	// Upstream is the region's aggregation router; when it does not answer,
+	// the region's failures are blamed on it
+	Upstream string `json:"upstream,omitempty"`
+}
+
+// Load reads the config at path. A missing file gives the defaults, so
+// atmer works without one.
+func Load(path string) (*Config, error) {
+	cfg := &Config{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate checks the parts of the config that JSON alone cannot
+func (c *Config) Validate() error {
+	if err := service.ValidateStatusRules(c.Status); err != nil {
+		return err
+	}
+	for _, r := range c.Regions {
+		if r.Name == "" {
+			return fmt.Errorf("region without a name")
+		}
+		if r.Upstream != "" {
+			if err := service.ValidateAddress(r.Upstream); err != nil {
+				return fmt.Errorf("region %s upstream: %w", r.Name, err)
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, j := range c.Jobs {
+		if j.Name == "" {
+			return fmt.Errorf("job without a name")
+		}
+		if seen[j.Name] {
+			return fmt.Errorf("job %s is defined twice", j.Name)
+		}
+		seen[j.Name] = true
+		if _, err := cron.Parse(j.Schedule); err != nil {
+			return fmt.Errorf("job %s: %w", j.Name, err)
+		}
+		if len(j.Outputs) == 0 {
+			return fmt.Errorf("job %s has no outputs", j.Name)
+		}
+		if j.Workers < 0 {
+			return fmt.Errorf("job %s: workers cannot be negative", j.Name)
+		}
+		if j.Recheck != nil && *j.Recheck < 0 {
+			return fmt.Errorf("job %s: recheck cannot be negative", j.Name)
+		}
+		if _, err := j.RecheckWait(); err != nil {
+			return fmt.Errorf("job %s: %w", j.Name, err)
+		}
+		if len(j.MailTo) > 0 && c.SMTP == nil {
+			return fmt.Errorf("job %s mails its report but there are no smtp settings", j.Name)
+		}
+	}
+
+	if c.SMTP != nil {
+		if err := c.SMTP.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range c.Maintenance {
+		if _, err := m.Window(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Windows returns the maintenance windows; Load has validated them
+func (c *Config) Windows() []service.Window {
+	windows := make([]service.Window, 0, len(c.Maintenance))
+	for _, m := range c.Maintenance {
+		if w, err := m.Window(); err == nil {
+			windows = append(windows, w)
+		}
+	}
+	return windows
+}
+
+// Upstreams maps each region with an upstream router to its address
+func (c *Config) Upstreams() map[string]string {
+	upstreams := map[string]string{}
+	for _, r := range c.Regions {
+		if r.Upstream != "" {
+			upstreams[r.Name] = r.Upstream
+		}
+	}
+	return upstreams
+}
+
+// StatusRules returns the decision table, or the default one
+func (c *Config) StatusRules() []service.StatusRule {
+	if len(c.Status) == 0 {
+		return service.DefaultStatusRules
+	}
+	return c.Status
+}
@@ -0,0 +1,268 @@
+// Package cron parses classic five-field cron expressions and works out
+// when they next fire.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression
+type Schedule struct {
+	expr   string
+	minute bits
+	hour   bits
+	dom    bits
+	month  bits
+	dow    bits
+	// whether day of month and day of week were *; when both are
+	// restricted, cron fires on a day matching either
+	domStar, dowStar bool
+	// whether every hour is allowed, which decides how daylight saving
+	// changes are handled
+	hourStar bool
+}
+
+// bits has bit n set when value n is allowed
+type bits uint64
+
+func (b bits) has(n int) bool { return b&(1<<uint(n)) != 0 }
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// macros are the @ shorthands
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse reads "minute hour day-of-month month day-of-week", where each
+// field is *, a value, a range a-b, a step */n or a-b/n, or a list of
+// those. Months and weekdays may be named (jan, mon); Sunday is 0 or 7.
+func Parse(expr string) (*Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if m, ok := macros[strings.ToLower(spec)]; ok {
+		spec = m
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: want 5 fields, got %d", expr, len(parts))
+	}
+
+	s := &Schedule{expr: expr, domStar: parts[2] == "*", dowStar: parts[4] == "*"}
+	var err error
+	for i, f := range []struct {
+		dst *bits
+		fld field
+	}{
+		{&s.minute, minuteField},
+		{&s.hour, hourField},
+		{&s.dom, domField},
+		{&s.month, monthField},
+		{&s.dow, dowField},
+	} {
+		if *f.dst, err = parseField(parts[i], f.fld); err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+	}
+
+	// Sunday may be written 7
+	if s.dow.has(7) {
+		s.dow |= 1
+	}
+	s.hourStar = s.hour == 1<<24-1
+	return s, nil
+}
+
+func parseField(s string, f field) (bits, error) {
+	var b bits
+	for _, part := range strings.Split(s, ",") {
+		rng, step := part, 1
+		if r, st, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(st)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step %q in %s", st, f.name)
+			}
+			rng, step = r, n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, z, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(z); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("bad range %q in %s", rng, f.name)
+			}
+		default:
+			v, err := f.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			if step > 1 {
+				hi = f.max // 5/15 means from 5 every 15
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			b |= 1 << uint(v)
+		}
+	}
+	return b, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("bad %s %q (%d-%d)", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// String returns the expression as written
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Next returns the first time after t the schedule fires, or the zero time
+// if it never does (such as on February 30th).
+//
+// Around daylight saving changes it behaves as cron does: a time skipped
+// when the clocks go forward fires right after the jump, and when they go
+// back the repeated hour fires again only for schedules that run every
+// hour, so a job at a fixed time runs once.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// five years covers every leap-day schedule
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if !s.month.has(int(t.Month())) {
+			t = forward(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()))
+			continue
+		}
+		if s.fires(t) {
+			return t
+		}
+		if !s.hour.has(t.Hour()) {
+			// on to the next hour; counted in minutes, as a wall clock
+			// hour may not exist on the day the clocks go forward
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+		t = t.Add(time.Minute)
+	}
+	return time.Time{}
+}
+
+// forward returns next, the start of a later day or month, unless the
+// clocks going forward at midnight put it at or before t; then it returns
+// the first instant after t on the hour
+func forward(t, next time.Time) time.Time {
+	for !next.After(t) {
+		next = next.Add(time.Hour)
+	}
+	return next
+}
+
+// fires reports whether the schedule fires at t
+func (s *Schedule) fires(t time.Time) bool {
+	if s.hour.has(t.Hour()) && s.minute.has(t.Minute()) {
+		return s.hourStar || !repeated(t)
+	}
+	return !s.hourStar && s.skipped(t)
+}
+
+// repeated reports whether the wall clock already showed t's time an hour
+// or so earlier, because the clocks went back
+func repeated(t time.Time) bool {
+	_, off := t.Zone()
+	_, before := t.Add(-time.Hour).Zone()
+	if before <= off {
+		return false
+	}
+	_, earlier := t.Add(-time.Duration(before-off) * time.Second).Zone()
+	return earlier == before
+}
+
+// gapBefore reports whether the clocks went forward right before t
+func gapBefore(t time.Time) bool {
+	_, off := t.Zone()
+	_, before := t.Add(-time.Minute).Zone()
+	return off > before
+}
+
+// skipped reports whether the clocks going forward right before t skipped
+// a time the schedule fires at
+func (s *Schedule) skipped(t time.Time) bool {
+	if !gapBefore(t) {
+		return false
+	}
+	// walk the wall clock times that never happened, as UTC so that they do
+	end := wall(t)
+	for w := wall(t.Add(-time.Minute)).Add(time.Minute); w.Before(end); w = w.Add(time.Minute) {
+		if s.month.has(int(w.Month())) && s.dayMatches(w) && s.hour.has(w.Hour()) && s.minute.has(w.Minute()) {
+			return true
+		}
+	}
+	return false
+}
+
+// wall returns t's wall clock reading as a UTC time
+func wall(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom, dow := s.dom.has(t.Day()), s.dow.has(int(t.Weekday()))
+	switch {
+	case s.domStar && s.dowStar:
+		return true
+	case s.domStar:
+		return dow
+	case s.dowStar:
+		return dom
+	default:
+		return dom || dow
+	}
+}
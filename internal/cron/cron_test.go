@@ -0,0 +1,186 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, expr string) *Schedule {
+	t.Helper()
+	s, err := Parse(expr)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", expr, err)
+	}
+	return s
+}
+
+func utc(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, c := range []struct {
+		expr string
+		want string
+	}{
+		{"* * * *", "want 5 fields"},
+		{"60 * * * *", "bad minute"},
+		{"* 24 * * *", "bad hour"},
+		{"* * 0 * *", "bad day of month"},
+		{"* * * 13 *", "bad month"},
+		{"* * * * 8", "bad day of week"},
+		{"5-1 * * * *", "bad range"},
+		{"*/0 * * * *", "bad step"},
+		{"* * * foo *", "bad month"},
+		{"@sometimes", "want 5 fields"},
+	} {
+		if _, err := Parse(c.expr); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("Parse(%q) = %v, want an error with %q", c.expr, err, c.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	for _, c := range []struct {
+		expr, from, want string
+	}{
+		// steps
+		{"*/15 * * * *", "2026-10-19 10:07", "2026-10-19 10:15"},
+		{"*/15 * * * *", "2026-10-19 10:15", "2026-10-19 10:30"},
+		{"5/20 * * * *", "2026-10-19 10:30", "2026-10-19 10:45"},
+		{"5/20 * * * *", "2026-10-19 10:46", "2026-10-19 11:05"},
+		{"0 9-17/4 * * *", "2026-10-19 09:00", "2026-10-19 13:00"},
+		{"0 9-17/4 * * *", "2026-10-19 17:00", "2026-10-20 09:00"},
+
+		// ranges and lists
+		{"0 8,12,18 * * *", "2026-10-19 12:00", "2026-10-19 18:00"},
+		{"0,30 7-8 * * *", "2026-10-19 08:30", "2026-10-20 07:00"},
+		{"0 0 * * mon-fri", "2026-10-17 08:00", "2026-10-19 00:00"},
+		{"0 6 * jan,jul sun", "2026-10-19 00:00", "2027-01-03 06:00"},
+
+		// Sunday is 0 or 7
+		{"0 0 * * 7", "2026-10-19 00:00", "2026-10-25 00:00"},
+		{"0 0 * * 0", "2026-10-19 00:00", "2026-10-25 00:00"},
+
+		// with both day fields restricted, either one matching will do
+		{"0 0 13 * 5", "2026-10-01 00:00", "2026-10-02 00:00"},
+		{"0 0 13 * 5", "2026-10-12 00:00", "2026-10-13 00:00"},
+		{"0 0 13 * *", "2026-10-01 00:00", "2026-10-13 00:00"},
+		{"0 0 * * 5", "2026-10-12 00:00", "2026-10-16 00:00"},
+
+		// month and year rollover
+		{"0 0 31 * *", "2026-04-01 00:00", "2026-05-31 00:00"},
+		{"0 0 1 * *", "2026-12-15 00:00", "2027-01-01 00:00"},
+		{"59 23 31 12 *", "2026-12-31 23:59", "2027-12-31 23:59"},
+		{"0 0 29 2 *", "2026-03-01 00:00", "2028-02-29 00:00"},
+
+		// macros
+		{"@hourly", "2026-10-19 10:07", "2026-10-19 11:00"},
+		{"@weekly", "2026-10-19 10:07", "2026-10-25 00:00"},
+		{"@monthly", "2026-10-19 10:07", "2026-11-01 00:00"},
+	} {
+		got := mustParse(t, c.expr).Next(utc(c.from))
+		if want := utc(c.want); !got.Equal(want) {
+			t.Errorf("%q after %s = %s, want %s", c.expr, c.from, got.Format("2006-01-02 15:04"), c.want)
+		}
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	if got := mustParse(t, "0 0 30 2 *").Next(utc("2026-01-01 00:00")); !got.IsZero() {
+		t.Errorf("February 30th fires at %s", got)
+	}
+}
+
+// runs lists the times a schedule fires from the first to before end
+func runs(s *Schedule, from, end time.Time) []string {
+	var got []string
+	for t := s.Next(from); !t.IsZero() && t.Before(end); t = s.Next(t) {
+		got = append(got, t.Format("2006-01-02 15:04 MST"))
+	}
+	return got
+}
+
+func location(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("no zone data for %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestNextClocksForward(t *testing.T) {
+	ny := location(t, "America/New_York")
+	// on 2026-03-08 the clocks go from 02:00 EST to 03:00 EDT
+	from := time.Date(2026, 3, 8, 0, 0, 0, 0, ny)
+	end := time.Date(2026, 3, 9, 6, 0, 0, 0, ny)
+
+	for _, c := range []struct {
+		expr string
+		want []string
+	}{
+		// a time that never happens fires right after the jump
+		{"30 2 * * *", []string{"2026-03-08 03:00 EDT", "2026-03-09 02:30 EDT"}},
+		{"0 5 * * *", []string{"2026-03-08 05:00 EDT", "2026-03-09 05:00 EDT"}},
+		// a time after the gap is not fired early
+		{"30 3 * * *", []string{"2026-03-08 03:30 EDT", "2026-03-09 03:30 EDT"}},
+	} {
+		if got := runs(mustParse(t, c.expr), from, end); strings.Join(got, ", ") != strings.Join(c.want, ", ") {
+			t.Errorf("%q runs at %q, want %q", c.expr, got, c.want)
+		}
+	}
+
+	// schedules running every hour just carry on
+	got := runs(mustParse(t, "*/30 * * * *"), time.Date(2026, 3, 8, 1, 0, 0, 0, ny), time.Date(2026, 3, 8, 4, 0, 0, 0, ny))
+	want := []string{"2026-03-08 01:30 EST", "2026-03-08 03:00 EDT", "2026-03-08 03:30 EDT"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("*/30 runs at %q, want %q", got, want)
+	}
+}
+
+func TestNextClocksBack(t *testing.T) {
+	ny := location(t, "America/New_York")
+	// on 2026-11-01 the clocks go from 02:00 EDT back to 01:00 EST
+	from := time.Date(2026, 11, 1, 0, 0, 0, 0, ny)
+	end := time.Date(2026, 11, 2, 3, 0, 0, 0, ny)
+
+	// a fixed time in the repeated hour runs once
+	got := runs(mustParse(t, "30 1 * * *"), from, end)
+	want := []string{"2026-11-01 01:30 EDT", "2026-11-02 01:30 EST"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("30 1 runs at %q, want %q", got, want)
+	}
+
+	// hourly schedules run in both passes through the hour
+	got = runs(mustParse(t, "15 * * * *"), time.Date(2026, 11, 1, 0, 30, 0, 0, ny), time.Date(2026, 11, 1, 3, 0, 0, 0, ny))
+	want = []string{"2026-11-01 01:15 EDT", "2026-11-01 01:15 EST", "2026-11-01 02:15 EST"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("15 * runs at %q, want %q", got, want)
+	}
+}
+
+func TestNextMidnightSkipped(t *testing.T) {
+	santiago := location(t, "America/Santiago")
+	// on 2026-09-06 the clocks go from 00:00 straight to 01:00
+	from := time.Date(2026, 9, 5, 12, 0, 0, 0, santiago)
+
+	got := mustParse(t, "0 0 * * *").Next(from)
+	if want := time.Date(2026, 9, 6, 1, 0, 0, 0, santiago); !got.Equal(want) {
+		t.Errorf("midnight run = %s, want %s", got, want)
+	}
+	if got.Day() != 6 {
+		t.Errorf("midnight run on day %d, want the 6th", got.Day())
+	}
+
+	// a weekday schedule must not lose the day whose midnight is missing
+	got = mustParse(t, "0 9 * * sun").Next(from)
+	if want := time.Date(2026, 9, 6, 9, 0, 0, 0, santiago); !got.Equal(want) {
+		t.Errorf("Sunday run = %s, want %s", got, want)
+	}
+}
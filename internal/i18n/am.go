@@ -0,0 +1,164 @@
+package i18n
+
+// am is the Amharic catalog
+var am = map[string]string{
+	// statuses
+	"Online":      "በመስመር ላይ",
+	"Offline":     "ከመስመር ውጭ",
+	"OnlyADSL":    "ADSL ብቻ",
+	"OnBackup":    "በምትኬ መስመር",
+	"Unresolved":  "አድራሻው ያልተገኘ",
+	"Maintenance": "በጥገና ላይ",
+
+	// report
+	"🔄 Checking %d ATMs…\n":                               "🔄 %d ኤቲኤሞች እየተፈተሹ ነው…\n",
+	"🔁 Re-checking %d ATM(s) in %s (attempt %d of %d)…\n": "🔁 %[1]d ኤቲኤም(ዎች) ከ%[2]s በኋላ እንደገና ይፈተሻሉ (ሙከራ %[3]d ከ%[4]d)…\n",
+	" (%d attempts)":      " (%d ሙከራዎች)",
+	"\nSuspected causes:": "\nሊሆኑ የሚችሉ ምክንያቶች:",
+	"\nSummary:":          "\nማጠቃለያ:",
+	"🎯 Partial sweep: %d of %d ATMs (%s)\n":    "🎯 ከፊል ፍተሻ: ከ%[2]d ኤቲኤሞች %[1]d (%[3]s)\n",
+	"🟢 Online: %s\n":                           "🟢 በመስመር ላይ: %s\n",
+	"🟡 OnlyADSL: %s\n":                         "🟡 ADSL ብቻ: %s\n",
+	"🔴 Offline: %s\n":                          "🔴 ከመስመር ውጭ: %s\n",
+	"🛠️ Under maintenance (not counted): %d\n": "🛠️ በጥገና ላይ (ያልተቆጠሩ): %d\n",
+	"✅ Results written to":                     "✅ ውጤቶቹ የተጻፉበት:",
+	"❌ Error writing results:":                 "❌ ውጤቶቹን መጻፍ አልተቻለም:",
+	"📧 Report sent to":                         "📧 ሪፖርቱ የተላከለት:",
+	"❌ Failed to send report:":                 "❌ ሪፖርቱን መላክ አልተቻለም:",
+	"⚠️ Failed to update status history:":      "⚠️ የሁኔታ ታሪኩን ማዘመን አልተቻለም:",
+	"❌ --recheck cannot be negative":           "❌ --recheck አሉታዊ ቁጥር ሊሆን አይችልም",
+	"❌ --workers must be at least 1":           "❌ --workers ቢያንስ 1 መሆን አለበት",
+	"❌ --mail-to needs smtp settings in %s\n":  "❌ --mail-to በ%s ውስጥ የsmtp ቅንብሮችን ይፈልጋል\n",
+	"🛰️ Tracing %d failing ATM(s)…\n":          "🛰️ %d ያልሰሩ ኤቲኤም(ዎች) መንገድ እየተፈለገ ነው…\n",
+	"🛰️ Tracing %s (%s), at most %d hops\n":    "🛰️ የ%s (%s) መንገድ እየተፈለገ ነው፣ እስከ %d ዝላይ\n",
+	"- %s: trace failed: %s\n":                 "- %s: መንገድ ፍለጋው አልተሳካም: %s\n",
+	"❌ Trace failed:":                          "❌ መንገድ ፍለጋው አልተሳካም:",
+
+	// report outputs
+	"Suspected causes:":                      "ሊሆኑ የሚችሉ ምክንያቶች:",
+	"Under maintenance:":                     "በጥገና ላይ:",
+	"Last responding hop:":                   "መጨረሻ የመለሰው ራውተር:",
+	"Partial sweep: %d of %d ATMs (%s)":      "ከፊል ፍተሻ: ከ%[2]d ኤቲኤሞች %[1]d (%[3]s)",
+	"ATM connectivity report":                "የኤቲኤም ግንኙነት ሪፖርት",
+	"ATM connectivity report, %s\n\n":        "የኤቲኤም ግንኙነት ሪፖርት፣ %s\n\n",
+	"ATM report %s: %d Offline, %d OnlyADSL": "የኤቲኤም ሪፖርት %s: %d ከመስመር ውጭ፣ %d ADSL ብቻ",
+	"Under maintenance (not counted): %d\n":  "በጥገና ላይ (ያልተቆጠሩ): %d\n",
+	"Name":                                   "ስም",
+	"IP":                                     "IP",
+	"Status":                                 "ሁኔታ",
+	"Suspected Cause":                        "ሊሆን የሚችል ምክንያት",
+	"Last Hop":                               "መጨረሻ የመለሰው ራውተር",
+	"Attempts":                               "ሙከራዎች",
+
+	// ATMs
+	"📄 Total ATMs: %d\n":                                       "📄 ጠቅላላ ኤቲኤሞች: %d\n",
+	"❌ No ATM named %s\n":                                      "❌ %s የሚባል ኤቲኤም የለም\n",
+	"❌ Failed to load ATM list:":                               "❌ የኤቲኤም ዝርዝሩን መጫን አልተቻለም:",
+	"❌ Failed to add ATM:":                                     "❌ ኤቲኤሙን መጨመር አልተቻለም:",
+	"❌ Failed to delete ATM:":                                  "❌ ኤቲኤሙን መሰረዝ አልተቻለም:",
+	"❌ Failed to save changes:":                                "❌ ለውጦቹን ማስቀመጥ አልተቻለም:",
+	"✅ ATM added":                                              "✅ ኤቲኤሙ ተጨምሯል",
+	"✅ ATM updated":                                            "✅ ኤቲኤሙ ተሻሽሏል",
+	"✅ Deleted %d ATM(s)\n":                                    "✅ %d ኤቲኤም(ዎች) ተሰርዘዋል\n",
+	"❌ No matching ATMs found":                                 "❌ የሚዛመድ ኤቲኤም አልተገኘም",
+	"🔎 Matching ATMs:":                                         "🔎 የሚዛመዱ ኤቲኤሞች:",
+	"❌ ATM Manager failed:":                                    "❌ የኤቲኤም አስተዳዳሪው አልተሳካም:",
+	"❌ No ATMs to change":                                      "❌ የሚቀየር ኤቲኤም የለም",
+	"❓ Continue (y/N): ":                                       "❓ ይቀጥል? (y/N): ",
+	"❓ Confirm delete of %d ATM(s) (y/N): ":                    "❓ %d ኤቲኤም(ዎች) ይሰረዙ? (y/N): ",
+	"❓ Apply to %d ATM(s) and %d service record(s) (y/N): ":    "❓ በ%d ኤቲኤም(ዎች) እና በ%d የአገልግሎት መዝገብ(ቦች) ላይ ይተግበር? (y/N): ",
+	"🚫 Cancelled":                                              "🚫 ተሰርዟል",
+	"❌ %s %s is already used by %s\n":                          "❌ %[1]s %[2]s በ%[3]s ጥቅም ላይ ውሏል\n",
+	"❌ %d ATMs match; use --all to delete every one of them\n": "❌ %d ኤቲኤሞች ይዛመዳሉ፤ ሁሉንም ለመሰረዝ --all ይጠቀሙ\n",
+	"❌ Nothing to change; give --ip, --name, --region, --link and/or --maintenance": "❌ የሚቀየር ነገር የለም፤ --ip፣ --name፣ --region፣ --link ወይም --maintenance ይስጡ",
+	"❌ Give either an ATM name or --where selectors":                                "❌ የኤቲኤም ስም ወይም --where መምረጫዎችን ይስጡ",
+	"❌ Give at least one --map OLD=NEW":                                             "❌ ቢያንስ አንድ --map OLD=NEW ይስጡ",
+	"❌ Give the pattern to replace with --find":                                     "❌ የሚተካውን ንድፍ በ--find ይስጡ",
+	"❌ Invalid --find: %s\n":                                                        "❌ ልክ ያልሆነ --find: %s\n",
+	"❌ Failed to apply changes, nothing was changed:":                               "❌ ለውጦቹን መተግበር አልተቻለም፤ ምንም አልተቀየረም:",
+	"   📡 service record %s\n":                                                      "   📡 የአገልግሎት መዝገብ %s\n",
+	"   🗑️ service record %s\n":                                                     "   🗑️ የአገልግሎት መዝገብ %s\n",
+
+	// services and search
+	"❌ No matches found.":                                         "❌ ምንም አልተገኘም።",
+	"🔍 Found %d match(es):\n\n":                                   "🔍 %d ተገኝተዋል:\n\n",
+	"🔍 Found %d matching service(s):\n\n":                         "🔍 %d የሚዛመዱ አገልግሎቶች ተገኝተዋል:\n\n",
+	"❌ Please provide a search query":                             "❌ እባክዎ የፍለጋ ቃል ያስገቡ",
+	"❌ Please provide a search query using -s":                    "❌ እባክዎ የፍለጋ ቃል በ-s ያስገቡ",
+	"❌ Invalid query: %s\n":                                       "❌ ልክ ያልሆነ ፍለጋ: %s\n",
+	"❌ No record matches %s.\n":                                   "❌ ከ%s ጋር የሚዛመድ መዝገብ የለም።\n",
+	"🔎 Matching records:":                                         "🔎 የሚዛመዱ መዝገቦች:",
+	"✅ Updated %d record(s).\n":                                   "✅ %d መዝገብ(ቦች) ተሻሽለዋል።\n",
+	"✅ Deleted %d record(s)\n":                                    "✅ %d መዝገብ(ቦች) ተሰርዘዋል\n",
+	"✅ Service record for %s added\n":                             "✅ የ%s የአገልግሎት መዝገብ ተጨምሯል\n",
+	"❌ Location is required":                                      "❌ ቦታው ያስፈልጋል",
+	"❌ A LAN or WAN IP is required":                               "❌ የLAN ወይም የWAN IP ያስፈልጋል",
+	"❌ Failed to read services: %s\n":                             "❌ አገልግሎቶቹን ማንበብ አልተቻለም: %s\n",
+	"❓ Confirm delete of %d record(s) (y/N): ":                    "❓ %d መዝገብ(ቦች) ይሰረዙ? (y/N): ",
+	"❓ Update %d record(s) (y/N): ":                               "❓ %d መዝገብ(ቦች) ይሻሻሉ? (y/N): ",
+	"❌ %d records match; use --all to update every one of them\n": "❌ %d መዝገቦች ይዛመዳሉ፤ ሁሉንም ለማሻሻል --all ይጠቀሙ\n",
+	"❌ The matching records changed while you confirmed; nothing was updated. Re-run the command.":               "❌ እያረጋገጡ ሳሉ የሚዛመዱት መዝገቦች ተቀይረዋል፤ ምንም አልተሻሻለም። ትዕዛዙን እንደገና ያስኪዱ።",
+	"❌ %d records match; use --all to delete every one of them\n":                                                "❌ %d መዝገቦች ይዛመዳሉ፤ ሁሉንም ለመሰረዝ --all ይጠቀሙ\n",
+	"❌ The matching records changed while you confirmed; nothing was deleted. Re-run the command.":               "❌ እያረጋገጡ ሳሉ የሚዛመዱት መዝገቦች ተቀይረዋል፤ ምንም አልተሰረዘም። ትዕዛዙን እንደገና ያስኪዱ።",
+	"❌ The selected ATMs or their records changed while you confirmed; nothing was changed. Re-run the command.": "❌ እያረጋገጡ ሳሉ የተመረጡት ኤቲኤሞች ወይም መዝገቦቻቸው ተቀይረዋል፤ ምንም አልተቀየረም። ትዕዛዙን እንደገና ያስኪዱ።",
+	"🔍 Dry run, nothing written.":                  "🔍 ሙከራ ብቻ፣ ምንም አልተጻፈም።",
+	"   no changes":                                "   ምንም ለውጥ የለም",
+	"❌ %s. Try again.\n":                           "❌ %s። እንደገና ይሞክሩ።\n",
+	"✏️ %s (LAN %s, WAN %s)\n":                     "✏️ %s (LAN %s፣ WAN %s)\n",
+	"%d. %s (LAN %s, WAN %s)\n":                    "%d. %s (LAN %s፣ WAN %s)\n",
+	"💡 Run 'atmer migrate -f %s' to convert it.\n": "💡 ለመቀየር 'atmer migrate -f %s' ያስኪዱ።\n",
+
+	// search across ATMs, circuits and status history
+	"⚠️ Failed to load status history:": "⚠️ የሁኔታ ታሪኩን መጫን አልተቻለም:",
+	"📡 Circuit without ATM":             "📡 ኤቲኤም የሌለው ወረዳ",
+	"No circuit on file":                "በመዝገብ ላይ ወረዳ የለም",
+	"IP:":                               "IP:",
+	"Modem:":                            "ሞደም:",
+	"Last status:":                      "የመጨረሻ ሁኔታ:",
+	"(checked %s, since %s)":            "(የተፈተሸው %s፣ ከ%s ጀምሮ)",
+	"Circuit:":                          "ወረዳ:",
+	"LAN:":                              "LAN:",
+	"Conn:":                             "ግንኙነት:",
+	"BW:":                               "ባንድዊድዝ:",
+	"Line:":                             "መስመር:",
+	"Service #:":                        "የአገልግሎት ቁ.:",
+	"Account #:":                        "የሂሳብ ቁ.:",
+
+	// history, undo and migration
+	"❌ Failed to read versions:":                                  "❌ ስሪቶቹን ማንበብ አልተቻለም:",
+	"❌ No versions recorded yet.":                                 "❌ እስካሁን የተመዘገበ ስሪት የለም።",
+	"🕘 %d version(s), newest first:\n\n":                          "🕘 %d ስሪት(ቶች)፣ አዲሱ መጀመሪያ:\n\n",
+	"❌ Failed to undo:":                                           "❌ መቀልበስ አልተቻለም:",
+	"❌ Failed to restore:":                                        "❌ መመለስ አልተቻለም:",
+	"❌ Cannot restore:":                                           "❌ መመለስ አይቻልም:",
+	"✅ Restored to %s\n":                                          "✅ ወደ %s ተመልሷል\n",
+	"❌ Failed to load audit log:":                                 "❌ የኦዲት መዝገቡን መጫን አልተቻለም:",
+	"⚠️ Failed to write audit log:":                               "⚠️ የኦዲት መዝገቡን መጻፍ አልተቻለም:",
+	"⚠️ Failed to snapshot for undo:":                             "⚠️ ለመቀልበስ ቅጂ መያዝ አልተቻለም:",
+	"⚠️ Failed to roll back:":                                     "⚠️ ወደ ቀድሞው መመለስ አልተቻለም:",
+	"❌ No matching changes found.":                                "❌ የሚዛመድ ለውጥ አልተገኘም።",
+	"📜 %d change(s):\n\n":                                         "📜 %d ለውጥ(ጦች):\n\n",
+	"❌ Failed to migrate services: %s\n":                          "❌ አገልግሎቶቹን ማሸጋገር አልተቻለም: %s\n",
+	"❌ Invalid --since: %s\n":                                     "❌ ልክ ያልሆነ --since: %s\n",
+	"❌ Invalid --until: %s\n":                                     "❌ ልክ ያልሆነ --until: %s\n",
+	"❌ Invalid --at: %s\n":                                        "❌ ልክ ያልሆነ --at: %s\n",
+	"❌ Please give a version or time with --at":                   "❌ እባክዎ ስሪት ወይም ጊዜ በ--at ይስጡ",
+	"↩️ Undid version %d: %s (%s by %s)\n":                        "↩️ ስሪት %[1]d ተቀልብሷል: %[2]s (%[3]s በ%[4]s)\n",
+	"✅ Nothing to restore, the files already match %s\n":          "✅ የሚመለስ ነገር የለም፤ ፋይሎቹ ከ%s ጋር ይዛመዳሉ\n",
+	"🕘 Restoring to %s will overwrite:\n":                         "🕘 ወደ %s መመለስ የሚከተሉትን ይተካል:\n",
+	"✅ %s is already at schema version %d\n":                      "✅ %s አስቀድሞ በመዋቅር ስሪት %d ላይ ነው\n",
+	"🔍 Would migrate %d record(s) from schema version %d to %d\n": "🔍 %[1]d መዝገብ(ቦች) ከመዋቅር ስሪት %[2]d ወደ %[3]d ይሸጋገራሉ\n",
+	"✅ Migrated %d record(s) from schema version %d to %d (backup: %s.v%d.bak)\n": "✅ %[1]d መዝገብ(ቦች) ከመዋቅር ስሪት %[2]d ወደ %[3]d ተሸጋግረዋል (ምትኬ: %[4]s.v%[5]d.bak)\n",
+	"\n⚠️ %d value(s) could not be converted as-is:\n":                            "\n⚠️ %d እሴት(ቶች) እንዳሉ መቀየር አልተቻለም:\n",
+
+	// schedule
+	"❌ No jobs in %s\n":         "❌ በ%s ውስጥ ምንም ሥራ የለም\n",
+	"❌ No job named %s\n":       "❌ %s የሚባል ሥራ የለም\n",
+	"❌ Job %s: %s\n":            "❌ ሥራ %s: %s\n",
+	"❌ Failed to open run log:": "❌ የሩጫ መዝገቡን መክፈት አልተቻለም:",
+	"🕘 %-16s %-20s next %s\n":   "🕘 %-16s %-20s ቀጣይ %s\n",
+
+	// logging
+	"❌ Failed to open log file:":                       "❌ የሎግ ፋይሉን መክፈት አልተቻለም:",
+	"❌ Unknown log format %q, expected text or json\n": "❌ ያልታወቀ የሎግ ቅርጸት %q፤ text ወይም json ይጠበቃል\n",
+}
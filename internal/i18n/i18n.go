@@ -0,0 +1,184 @@
+// Package i18n translates atmer's user-facing messages and, in plain mode,
+// strips their emoji.
+//
+// Messages are looked up by their English text, emoji included, so the
+// source stays readable and a message missing from a catalog falls back to
+// English.
+package i18n
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// catalogs maps a language to its translations
+var catalogs = map[string]map[string]string{
+	"en": {},
+	"am": am,
+}
+
+var (
+	lang  = "en"
+	plain bool
+)
+
+// Languages lists the languages with a catalog
+func Languages() []string {
+	langs := make([]string, 0, len(catalogs))
+	for l := range catalogs {
+		langs = append(langs, l)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// SetLang selects the catalog for a locale such as "am" or "am_ET.UTF-8";
+// "C" and "POSIX" are English
+func SetLang(locale string) error {
+	l := base(locale)
+	if l == "c" || l == "posix" {
+		l = "en"
+	}
+	if _, ok := catalogs[l]; !ok {
+		return fmt.Errorf("unsupported language %q (supported: %s)", locale, strings.Join(Languages(), ", "))
+	}
+	lang = l
+	return nil
+}
+
+// Lang returns the selected language
+func Lang() string {
+	return lang
+}
+
+// FromEnv returns the locale from LC_ALL, LC_MESSAGES or LANG, the first
+// that is set
+func FromEnv() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Supported reports whether a locale has a catalog
+func Supported(locale string) bool {
+	_, ok := catalogs[base(locale)]
+	return ok
+}
+
+// base reduces a locale to its language, e.g. "am_ET.UTF-8" to "am"
+func base(locale string) string {
+	l := strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(l, "_-.@"); i >= 0 {
+		l = l[:i]
+	}
+	return l
+}
+
+// SetPlain turns plain output, without emoji, on or off
+func SetPlain(on bool) {
+	plain = on
+}
+
+// Plain reports whether plain output is on
+func Plain() bool {
+	return plain
+}
+
+// T translates a message, or returns it unchanged if the catalog lacks it
+func T(msg string) string {
+	if t, ok := catalogs[lang][msg]; ok {
+		return t
+	}
+	return msg
+}
+
+// Sprintf formats the translation of format
+func Sprintf(format string, args ...any) string {
+	return fmt.Sprintf(T(format), args...)
+}
+
+// Printer writes translated messages, without emoji in plain mode
+type Printer struct {
+	w io.Writer
+}
+
+// NewPrinter returns a printer writing to w
+func NewPrinter(w io.Writer) *Printer {
+	return &Printer{w: w}
+}
+
+// Printf prints the translation of format
+func (p *Printer) Printf(format string, args ...any) {
+	p.write(Sprintf(format, args...))
+}
+
+// Println prints its operands like fmt.Println, translating the first if it
+// is a string
+func (p *Printer) Println(args ...any) {
+	p.write(fmt.Sprintln(translateFirst(args)...))
+}
+
+// Print prints its operands like fmt.Print, translating the first if it
+// is a string
+func (p *Printer) Print(args ...any) {
+	p.write(fmt.Sprint(translateFirst(args)...))
+}
+
+func (p *Printer) write(s string) {
+	if plain {
+		s = Strip(s)
+	}
+	io.WriteString(p.w, s)
+}
+
+func translateFirst(args []any) []any {
+	if len(args) == 0 {
+		return args
+	}
+	if s, ok := args[0].(string); ok {
+		args = slices.Clone(args)
+		args[0] = T(s)
+	}
+	return args
+}
+
+// Strip removes the emoji from s, with the space that follows each
+func Strip(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if !isEmoji(r) && !(i+1 < len(runes) && runes[i+1] == '\uFE0F') {
+			b.WriteRune(r)
+			continue
+		}
+		// skip the variation selector or joiner, then one space
+		for i+1 < len(runes) && (runes[i+1] == '\uFE0F' || runes[i+1] == '\u200D') {
+			i++
+		}
+		if i+1 < len(runes) && runes[i+1] == ' ' {
+			i++
+		}
+	}
+	return b.String()
+}
+
+// isEmoji reports whether r is in the pictograph, symbol and dingbat blocks
+// the CLI draws its icons from
+func isEmoji(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF,
+		r >= 0x2600 && r <= 0x27BF,
+		r >= 0x2B00 && r <= 0x2BFF:
+		return unicode.IsSymbol(r) || r > 0xFFFF
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package i18n
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+// useLang selects lang for the test and English again after it
+func useLang(t *testing.T, lang string) {
+	t.Helper()
+	if err := SetLang(lang); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetLang("en") })
+}
+
+func TestStrip(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{"✅ Results written to", "Results written to"},
+		{"🛠️ Under maintenance (not counted): 3\n", "Under maintenance (not counted): 3\n"},
+		{"⚠️ Failed to load status history:", "Failed to load status history:"},
+		{"📡 Circuit without ATM", "Circuit without ATM"},
+		{"🧑‍💻 operator", "operator"},
+		{"  🏧 Bole (10.20.1.10)", "  Bole (10.20.1.10)"},
+		{"🔴🟢 two", "two"},
+		// letters and punctuation outside the emoji blocks stay
+		{"ኤቲኤም 10.20.1.10 → 10.20.1.9 ±1 ©", "ኤቲኤም 10.20.1.10 → 10.20.1.9 ±1 ©"},
+		{"", ""},
+	} {
+		if got := Strip(c.in); got != c.want {
+			t.Errorf("Strip(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestPrinterPlain(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewPrinter(&buf)
+
+	p.Printf("🔴 Offline: %s\n", "3")
+	SetPlain(true)
+	t.Cleanup(func() { SetPlain(false) })
+	p.Printf("🔴 Offline: %s\n", "3")
+	p.Println("✅ Results written to", "r.json")
+	p.Print("❌ Error writing results:", " disk full\n")
+
+	want := "🔴 Offline: 3\nOffline: 3\nResults written to r.json\nError writing results: disk full\n"
+	if buf.String() != want {
+		t.Errorf("printed %q, want %q", buf.String(), want)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	useLang(t, "am_ET.UTF-8")
+	if Lang() != "am" {
+		t.Fatalf("Lang() = %q after am_ET.UTF-8, want am", Lang())
+	}
+
+	if got := T("Offline"); got != am["Offline"] {
+		t.Errorf("T(Offline) = %q, want %q", got, am["Offline"])
+	}
+	if got := Sprintf("🔴 Offline: %s\n", "3"); got != "🔴 ከመስመር ውጭ: 3\n" {
+		t.Errorf("Sprintf = %q", got)
+	}
+
+	// a message the catalog lacks falls back to English
+	if got := T("Nothing like this"); got != "Nothing like this" {
+		t.Errorf("T of a missing message = %q", got)
+	}
+	if got := Sprintf("%d unknown ATMs", 4); got != "4 unknown ATMs" {
+		t.Errorf("Sprintf of a missing message = %q", got)
+	}
+
+	// only the first operand of Println is a message
+	var buf bytes.Buffer
+	NewPrinter(&buf).Println("✅ Results written to", "Offline")
+	if want := am["✅ Results written to"] + " Offline\n"; buf.String() != want {
+		t.Errorf("Println = %q, want %q", buf.String(), want)
+	}
+
+	for _, locale := range []string{"C", "POSIX", "en_US.UTF-8"} {
+		if err := SetLang(locale); err != nil || Lang() != "en" || T("Offline") != "Offline" {
+			t.Errorf("SetLang(%q) = %v, language %q", locale, err, Lang())
+		}
+	}
+	if err := SetLang("fr_FR"); err == nil || Lang() != "en" {
+		t.Errorf("SetLang(fr_FR) = %v, language %q; want an error and no change", err, Lang())
+	}
+	if Supported("fr") || !Supported("am-ET") {
+		t.Error("Supported disagrees with the catalogs")
+	}
+}
+
+// TestCatalogComplete checks that every message literal printed through a
+// Printer or passed to T or Sprintf has an Amharic translation
+func TestCatalogComplete(t *testing.T) {
+	root := filepath.Join("..", "..")
+	fset := token.NewFileSet()
+	var checked int
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && (d.Name() == "testdata" || strings.HasPrefix(d.Name(), ".")) && path != root {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			msg, pos, ok := message(n)
+			if !ok {
+				return true
+			}
+			checked++
+			if _, ok := am[msg]; !ok {
+				t.Errorf("%s: %q has no Amharic translation", fset.Position(pos), msg)
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked == 0 {
+		t.Fatal("found no messages; is the walk rooted at the module?")
+	}
+}
+
+// message returns the message literal of a call to out.Printf, out.Println,
+// out.Print, i18n.T, i18n.Sprintf or the CLI's confirm. Literals without
+// letters, such as "%s: %s\n", are not messages.
+func message(n ast.Node) (string, token.Pos, bool) {
+	call, ok := n.(*ast.CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return "", 0, false
+	}
+	var name string
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		name = fun.Name
+	case *ast.SelectorExpr:
+		if x, ok := fun.X.(*ast.Ident); ok {
+			name = x.Name + "." + fun.Sel.Name
+		}
+	}
+	switch name {
+	case "out.Printf", "out.Println", "out.Print", "i18n.T", "i18n.Sprintf", "confirm":
+	default:
+		return "", 0, false
+	}
+
+	lit, ok := call.Args[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", 0, false
+	}
+	msg, err := strconv.Unquote(lit.Value)
+	if err != nil || !strings.ContainsFunc(stripVerbs(msg), unicode.IsLetter) {
+		return "", 0, false
+	}
+	return msg, lit.Pos(), true
+}
+
+// stripVerbs drops the formatting verbs of a format, e.g. %s and %[2]d
+func stripVerbs(format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+		// skip flags, width, precision and argument indexes up to the verb
+		for i++; i < len(format) && strings.IndexByte("+-# 0123456789.[]*", format[i]) >= 0; i++ {
+		}
+	}
+	return b.String()
+}
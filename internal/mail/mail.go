@@ -0,0 +1,212 @@
+// Package mail sends reports over SMTP.
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the SMTP server to send through
+type Config struct {
+	Host string `json:"host"`
+	Port int    `json:"port,omitempty"` // default 587
+	From string `json:"from"`
+
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// PasswordEnv names an environment variable holding the password, to
+	// keep it out of the config file
+	PasswordEnv string `json:"password_env,omitempty"`
+
+	// StartTLS upgrades the connection before authenticating; servers that
+	// offer it are always upgraded, this makes it required
+	StartTLS           bool `json:"starttls,omitempty"`
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+}
+
+// Validate checks that the config can be used to send
+func (c Config) Validate() error {
+	if c.Host == "" {
+		return fmt.Errorf("smtp host is required")
+	}
+	if c.From == "" {
+		return fmt.Errorf("smtp from address is required")
+	}
+	return nil
+}
+
+// Addr returns host:port
+func (c Config) Addr() string {
+	port := c.Port
+	if port == 0 {
+		port = 587
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(port))
+}
+
+func (c Config) password() string {
+	if c.PasswordEnv != "" {
+		return os.Getenv(c.PasswordEnv)
+	}
+	return c.Password
+}
+
+// Attachment is a file sent with a message
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+// AttachFile reads a file as an attachment
+func AttachFile(path string) (Attachment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Attachment{}, err
+	}
+	return Attachment{Name: filepath.Base(path), Data: data}, nil
+}
+
+// Message is one email
+type Message struct {
+	To          []string
+	Subject     string
+	Body        string // plain text
+	Attachments []Attachment
+}
+
+// Send delivers msg through the server in cfg
+func Send(cfg Config, msg Message) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if len(msg.To) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+
+	conn, err := net.DialTimeout("tcp", cfg.Addr(), 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", cfg.Addr(), err)
+	}
+	slog.Debug("smtp connected", "addr", cfg.Addr())
+	conn.SetDeadline(time.Now().Add(2 * time.Minute))
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to talk to %s: %w", cfg.Addr(), err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		tlsConfig := &tls.Config{ServerName: cfg.Host, InsecureSkipVerify: cfg.InsecureSkipVerify}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+		slog.Debug("smtp starttls", "addr", cfg.Addr(), "insecure", cfg.InsecureSkipVerify)
+	} else if cfg.StartTLS {
+		return fmt.Errorf("%s does not offer STARTTLS", cfg.Addr())
+	}
+
+	if cfg.Username != "" {
+		// PlainAuth refuses to send the password unencrypted, except to localhost
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, cfg.password(), cfg.Host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+		slog.Debug("smtp authenticated", "addr", cfg.Addr(), "user", cfg.Username)
+	}
+
+	if err := c.Mail(cfg.From); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s refused: %w", to, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes(cfg.From, time.Now())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// Bytes renders the message as MIME, multipart when it has attachments
+func (m Message) Bytes(from string, date time.Time) []byte {
+	var b bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&b, "%s: %s\r\n", k, v) }
+
+	header("From", from)
+	header("To", strings.Join(m.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+
+	if len(m.Attachments) == 0 {
+		header("Content-Type", `text/plain; charset="utf-8"`)
+		header("Content-Transfer-Encoding", "base64")
+		b.WriteString("\r\n")
+		writeBase64(&b, []byte(m.Body))
+		return b.Bytes()
+	}
+
+	boundary := newBoundary()
+	header("Content-Type", fmt.Sprintf(`multipart/mixed; boundary="%s"`, boundary))
+	b.WriteString("\r\n")
+
+	fmt.Fprintf(&b, "--%s\r\n", boundary)
+	header("Content-Type", `text/plain; charset="utf-8"`)
+	header("Content-Transfer-Encoding", "base64")
+	b.WriteString("\r\n")
+	writeBase64(&b, []byte(m.Body))
+
+	for _, a := range m.Attachments {
+		ctype := mime.TypeByExtension(filepath.Ext(a.Name))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		name := mime.QEncoding.Encode("utf-8", a.Name)
+
+		fmt.Fprintf(&b, "--%s\r\n", boundary)
+		header("Content-Type", fmt.Sprintf(`%s; name="%s"`, ctype, name))
+		header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, name))
+		header("Content-Transfer-Encoding", "base64")
+		b.WriteString("\r\n")
+		writeBase64(&b, a.Data)
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes()
+}
+
+// writeBase64 writes data base64 encoded in 76 character lines
+func writeBase64(b *bytes.Buffer, data []byte) {
+	enc := base64.StdEncoding.EncodeToString(data)
+	for len(enc) > 76 {
+		b.WriteString(enc[:76] + "\r\n")
+		enc = enc[76:]
+	}
+	b.WriteString(enc + "\r\n")
+}
+
+func newBoundary() string {
+	var buf [12]byte
+	rand.Read(buf[:])
+	return "atmer-" + fmt.Sprintf("%x", buf)
+}
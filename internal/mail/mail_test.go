@@ -0,0 +1,346 @@
+package mail
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// session is what the fake server saw of one client
+type session struct {
+	commands []string
+	data     string
+	tls      bool
+}
+
+// fakeSMTP is a one-connection SMTP server on a real listener, offering
+// STARTTLS when it has a certificate
+type fakeSMTP struct {
+	ln   net.Listener
+	cert *tls.Certificate
+	done chan session
+}
+
+func startSMTP(t *testing.T, host string, cert *tls.Certificate) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		t.Skipf("cannot listen on %s: %v", host, err)
+	}
+	s := &fakeSMTP{ln: ln, cert: cert, done: make(chan session, 1)}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+// config points a Config at the server
+func (s *fakeSMTP) config(host string) Config {
+	_, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	n, _ := strconv.Atoi(port)
+	return Config{Host: host, Port: n, From: "atmer@bank.example"}
+}
+
+// session waits for the client to go away and returns what it did
+func (s *fakeSMTP) session(t *testing.T) session {
+	t.Helper()
+	select {
+	case ss := <-s.done:
+		return ss
+	case <-time.After(5 * time.Second):
+		t.Fatal("fake SMTP server saw no session")
+		return session{}
+	}
+}
+
+func (s *fakeSMTP) serve() {
+	var ss session
+	defer func() { s.done <- ss }()
+
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer func() { conn.Close() }()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	r := bufio.NewReader(conn)
+	reply := func(lines ...string) {
+		for _, l := range lines {
+			io.WriteString(conn, l+"\r\n")
+		}
+	}
+	reply("220 fake ESMTP")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		ss.commands = append(ss.commands, line)
+		verb := strings.ToUpper(strings.Fields(line + " ")[0])
+
+		switch verb {
+		case "EHLO":
+			if s.cert != nil && !ss.tls {
+				reply("250-fake", "250-STARTTLS", "250 AUTH PLAIN")
+			} else {
+				reply("250-fake", "250 AUTH PLAIN")
+			}
+		case "STARTTLS":
+			reply("220 go ahead")
+			tc := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{*s.cert}})
+			if err := tc.Handshake(); err != nil {
+				return
+			}
+			conn, r, ss.tls = tc, bufio.NewReader(tc), true
+		case "AUTH":
+			reply("235 accepted")
+		case "DATA":
+			reply("354 go on")
+			var b strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				b.WriteString(strings.TrimPrefix(l, "."))
+			}
+			ss.data = b.String()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+// selfSigned makes a certificate for the fake server's STARTTLS
+func selfSigned(t *testing.T) *tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "smtp.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.2")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func hasCommand(ss session, prefix string) bool {
+	for _, c := range ss.commands {
+		if strings.HasPrefix(c, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeBase64(t *testing.T, r io.Reader) string {
+	t.Helper()
+	data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSendWithAttachments(t *testing.T) {
+	srv := startSMTP(t, "127.0.0.1", nil)
+	cfg := srv.config("127.0.0.1")
+
+	// long enough to need several base64 lines
+	csv := "Name,IP,Status\r\n" + strings.Repeat("Bole,10.20.1.10,Offline\r\n", 20)
+	msg := Message{
+		To:      []string{"noc@bank.example", "ops@bank.example"},
+		Subject: "ATM report — 2 offline",
+		Body:    "2 ATMs are offline.\nSee the attachments.",
+		Attachments: []Attachment{
+			{Name: "report.csv", Data: []byte(csv)},
+			{Name: "raw.bin", Data: []byte{0, 1, 2, 0xff}},
+		},
+	}
+	if err := Send(cfg, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	ss := srv.session(t)
+	for _, want := range []string{"MAIL FROM:<atmer@bank.example>", "RCPT TO:<noc@bank.example>", "RCPT TO:<ops@bank.example>"} {
+		if !hasCommand(ss, want) {
+			t.Errorf("server never got %q: %q", want, ss.commands)
+		}
+	}
+
+	m, err := mail.ReadMessage(strings.NewReader(ss.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("Subject = %q, %v", subject, err)
+	}
+	if got := m.Header.Get("To"); got != "noc@bank.example, ops@bank.example" {
+		t.Errorf("To = %q", got)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %q, %v", m.Header.Get("Content-Type"), err)
+	}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+
+	body, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := body.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("first part is %q, want the text body", ct)
+	}
+	if got := decodeBase64(t, body); got != msg.Body {
+		t.Errorf("body = %q", got)
+	}
+
+	for _, want := range msg.Attachments {
+		p, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("attachment %s: %v", want.Name, err)
+		}
+		if p.FileName() != want.Name {
+			t.Errorf("attachment named %q, want %q", p.FileName(), want.Name)
+		}
+		if got := decodeBase64(t, p); got != string(want.Data) {
+			t.Errorf("attachment %s = %q", want.Name, got)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("extra part after the attachments: %v", err)
+	}
+
+	for _, line := range strings.Split(ss.data, "\r\n") {
+		if len(line) > 78 {
+			t.Errorf("line longer than 78 characters: %q", line)
+			break
+		}
+	}
+}
+
+func TestSendPlainBody(t *testing.T) {
+	srv := startSMTP(t, "127.0.0.1", nil)
+	if err := Send(srv.config("127.0.0.1"), Message{To: []string{"noc@bank.example"}, Subject: "All online", Body: "47 of 47 online"}); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := mail.ReadMessage(strings.NewReader(srv.session(t).data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := m.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain without attachments", ct)
+	}
+	if got := decodeBase64(t, m.Body); got != "47 of 47 online" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestStartTLSRequired(t *testing.T) {
+	srv := startSMTP(t, "127.0.0.1", nil)
+	cfg := srv.config("127.0.0.1")
+	cfg.StartTLS = true
+
+	err := Send(cfg, Message{To: []string{"noc@bank.example"}, Subject: "x", Body: "x"})
+	if err == nil || !strings.Contains(err.Error(), "does not offer STARTTLS") {
+		t.Fatalf("Send = %v, want STARTTLS refused", err)
+	}
+	if ss := srv.session(t); hasCommand(ss, "MAIL") || ss.data != "" {
+		t.Error("the message was sent without TLS")
+	}
+}
+
+func TestStartTLSAndAuth(t *testing.T) {
+	srv := startSMTP(t, "127.0.0.2", selfSigned(t))
+	cfg := srv.config("127.0.0.2")
+	cfg.StartTLS = true
+	cfg.InsecureSkipVerify = true
+	cfg.Username = "atmer"
+	cfg.PasswordEnv = "ATMER_TEST_SMTP_PASSWORD"
+	t.Setenv(cfg.PasswordEnv, "s3cret")
+
+	if err := Send(cfg, Message{To: []string{"noc@bank.example"}, Subject: "x", Body: "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ss := srv.session(t)
+	if !ss.tls {
+		t.Error("the connection was not upgraded")
+	}
+	want := "AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00atmer\x00s3cret"))
+	if !hasCommand(ss, want) {
+		t.Errorf("no %q in %q", want, ss.commands)
+	}
+}
+
+func TestAuthRefusedInPlaintext(t *testing.T) {
+	// 127.0.0.2 is not one of the names net/smtp treats as local
+	srv := startSMTP(t, "127.0.0.2", nil)
+	cfg := srv.config("127.0.0.2")
+	cfg.Username = "atmer"
+	cfg.Password = "s3cret"
+
+	err := Send(cfg, Message{To: []string{"noc@bank.example"}, Subject: "x", Body: "x"})
+	if err == nil || !strings.Contains(err.Error(), "failed to authenticate") {
+		t.Fatalf("Send = %v, want authentication refused", err)
+	}
+	ss := srv.session(t)
+	if hasCommand(ss, "AUTH") {
+		t.Errorf("the password went over plaintext: %q", ss.commands)
+	}
+	if hasCommand(ss, "MAIL") {
+		t.Error("the message was sent after auth failed")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{From: "a@b"}, "host"},
+		{Config{Host: "smtp.bank.example"}, "from"},
+	} {
+		if err := Send(c.cfg, Message{To: []string{"x@y"}}); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("Send with %+v = %v, want an error about %s", c.cfg, err, c.want)
+		}
+	}
+	if got := (Config{Host: "smtp.bank.example"}).Addr(); got != "smtp.bank.example:587" {
+		t.Errorf("default Addr = %q", got)
+	}
+}
@@ -0,0 +1,75 @@
+package query
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxDistance is the number of typos tolerated for a query of this length;
+// short queries must match exactly or they would match almost anything
+func maxDistance(q string) int {
+	switch n := len([]rune(q)); {
+	case n <= 3:
+		return 0
+	case n <= 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// fuzzyScore compares q against v and each of its words, allowing a few
+// typos. Closer matches score higher.
+func fuzzyScore(v, q string) (float64, bool) {
+	limit := maxDistance(q)
+	if limit == 0 {
+		if strings.Contains(v, q) {
+			return scoreFuzzy, true
+		}
+		return 0, false
+	}
+
+	best := levenshtein(v, q)
+	for _, w := range words(v) {
+		best = min(best, levenshtein(w, q))
+		// also compare against the start of longer words, so "adis" finds "addisalem"
+		if r := []rune(w); len(r) > len([]rune(q)) {
+			best = min(best, levenshtein(string(r[:len([]rune(q))]), q)+1)
+		}
+	}
+
+	if best > limit {
+		return 0, false
+	}
+	return scoreFuzzy / float64(1+best), true
+}
+
+// words splits v on anything that is not a letter or digit
+func words(v string) []string {
+	return strings.FieldsFunc(v, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
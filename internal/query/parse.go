@@ -0,0 +1,258 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Node is a parsed query expression
+type Node interface{}
+
+// And matches when every operand matches
+type And []Node
+
+// Or matches when any operand matches
+type Or []Node
+
+// Not matches when its operand does not
+type Not struct{ Node Node }
+
+// Term is a single condition such as "bw:>=4", "location:addis" or a bare word
+type Term struct {
+	Field string // empty for bare words, which match any field
+	Op    string // "", "=", "~", ">", ">=", "<", "<="
+	Value string
+}
+
+type token struct {
+	text   string
+	quoted bool // the text contained quotes, so it is never a keyword
+	field  string
+	hasCol bool // an unquoted ':' separated field and text
+}
+
+// Parse turns a query string into an expression tree.
+//
+// Terms separated by spaces must all match; OR (or "|") between terms
+// matches either side, NOT (or a leading "-") negates a term, and
+// parentheses group. A term is either a bare word or field:value, where the
+// value may start with = (exact), ~ (fuzzy) or a comparison operator, and
+// may be quoted to include spaces.
+func Parse(input string) (Node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+
+	p := &parser{tokens: tokens}
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return n, nil
+}
+
+func lex(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '(' || c == ')':
+			tokens = append(tokens, token{text: string(c)})
+			i++
+			continue
+		}
+
+		var tok token
+		var b strings.Builder
+		for i < len(runes) {
+			c := runes[i]
+			if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '(' || c == ')' {
+				break
+			}
+			if c == '"' {
+				end := i + 1
+				for end < len(runes) && runes[end] != '"' {
+					end++
+				}
+				if end == len(runes) {
+					return nil, fmt.Errorf("unterminated quote")
+				}
+				b.WriteString(string(runes[i+1 : end]))
+				tok.quoted = true
+				i = end + 1
+				continue
+			}
+			if c == ':' && !tok.hasCol && !tok.quoted {
+				tok.field = b.String()
+				tok.hasCol = true
+				b.Reset()
+				i++
+				continue
+			}
+			b.WriteRune(c)
+			i++
+		}
+		tok.text = b.String()
+		tokens = append(tokens, tok)
+	}
+
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) keyword(words ...string) bool {
+	t, ok := p.peek()
+	if !ok || t.quoted || t.hasCol {
+		return false
+	}
+	for _, w := range words {
+		if t.text == w {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) or() (Node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := Or{left}
+	for p.keyword("OR", "|") {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, right)
+	}
+
+	if len(nodes) == 1 {
+		return left, nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) and() (Node, error) {
+	var nodes And
+	for {
+		if _, ok := p.peek(); !ok || p.keyword(")", "OR", "|") {
+			break
+		}
+		if p.keyword("AND", "&") {
+			p.pos++
+			continue
+		}
+
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+
+	switch len(nodes) {
+	case 0:
+		return nil, fmt.Errorf("missing term")
+	case 1:
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) unary() (Node, error) {
+	if p.keyword("NOT", "!") {
+		p.pos++
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{n}, nil
+	}
+
+	t, _ := p.peek()
+	if !t.quoted && (strings.HasPrefix(t.text, "-") && !t.hasCol && len(t.text) > 1 ||
+		strings.HasPrefix(t.field, "-") && t.hasCol) {
+		// "-word" and "-field:value" are shorthand for NOT
+		if t.hasCol {
+			t.field = t.field[1:]
+		} else {
+			t.text = t.text[1:]
+		}
+		p.tokens[p.pos] = t
+		n, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{n}, nil
+	}
+
+	return p.primary()
+}
+
+func (p *parser) primary() (Node, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("missing term")
+	}
+
+	if t.text == "(" && !t.quoted && !t.hasCol {
+		p.pos++
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword(")") {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return n, nil
+	}
+	if t.text == ")" && !t.quoted && !t.hasCol {
+		return nil, fmt.Errorf("unexpected )")
+	}
+
+	p.pos++
+	term := Term{Field: strings.ToLower(t.field), Value: t.text}
+	if t.hasCol {
+		for _, op := range []string{">=", "<=", "=", "~", ">", "<"} {
+			if strings.HasPrefix(term.Value, op) {
+				term.Op = op
+				term.Value = term.Value[len(op):]
+				break
+			}
+		}
+		if term.Field == "" {
+			return nil, fmt.Errorf("missing field name before ':'")
+		}
+	}
+	if term.Value == "" {
+		return nil, fmt.Errorf("missing value for %q", t.field)
+	}
+	return term, nil
+}
@@ -0,0 +1,364 @@
+package query
+
+import (
+	"fmt"
+	"net/netip"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kind selects how a field's values are compared
+type Kind int
+
+const (
+	Text   Kind = iota // case-insensitive substring, or exact with '='
+	IP                 // like Text, plus CIDR prefixes such as 10.20.0.0/16
+	Number             // numeric equality and comparisons
+)
+
+// Field describes one queryable field of T
+type Field[T any] struct {
+	Name    string
+	Aliases []string
+	Kind    Kind
+	Fuzzy   bool // bare and plain terms also match with small typos
+	Value   func(T) string
+
+	// Number returns the numeric value of Number fields, and ParseNumber
+	// parses the query side; strconv.ParseFloat is used when nil
+	Number      func(T) (float64, bool)
+	ParseNumber func(string) (float64, error)
+}
+
+// Schema is the set of fields a query may refer to
+type Schema[T any] []Field[T]
+
+// Lookup finds a field by name or alias, ignoring case
+func (s Schema[T]) Lookup(name string) (Field[T], bool) {
+	name = strings.ToLower(name)
+	for _, f := range s {
+		if strings.ToLower(f.Name) == name {
+			return f, true
+		}
+		for _, a := range f.Aliases {
+			if strings.ToLower(a) == name {
+				return f, true
+			}
+		}
+	}
+	return Field[T]{}, false
+}
+
+// Names lists the canonical field names
+func (s Schema[T]) Names() []string {
+	names := make([]string, len(s))
+	for i, f := range s {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// matcher reports whether a record matches and how relevant the match is
+type matcher[T any] func(T) (float64, bool)
+
+// Query is a compiled query bound to a schema
+type Query[T any] struct {
+	match matcher[T]
+}
+
+// Compile parses input and resolves it against the schema
+func (s Schema[T]) Compile(input string) (*Query[T], error) {
+	n, err := Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return s.CompileNode(n)
+}
+
+// CompileNode resolves an already built expression against the schema
+func (s Schema[T]) CompileNode(n Node) (*Query[T], error) {
+	m, err := s.compile(n)
+	if err != nil {
+		return nil, err
+	}
+	return &Query[T]{match: m}, nil
+}
+
+// Match reports whether r matches the query
+func (q *Query[T]) Match(r T) bool {
+	_, ok := q.match(r)
+	return ok
+}
+
+// Score reports whether r matches and how relevant it is; higher is better
+func (q *Query[T]) Score(r T) (float64, bool) {
+	return q.match(r)
+}
+
+// Rank returns the matching records, most relevant first
+func (q *Query[T]) Rank(records []T) []T {
+	type hit struct {
+		record T
+		score  float64
+	}
+
+	var hits []hit
+	for _, r := range records {
+		if score, ok := q.match(r); ok {
+			hits = append(hits, hit{r, score})
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+
+	ranked := make([]T, len(hits))
+	for i, h := range hits {
+		ranked[i] = h.record
+	}
+	return ranked
+}
+
+func (s Schema[T]) compile(n Node) (matcher[T], error) {
+	switch n := n.(type) {
+	case And:
+		parts, err := s.compileAll(n)
+		if err != nil {
+			return nil, err
+		}
+		return func(r T) (float64, bool) {
+			total := 0.0
+			for _, m := range parts {
+				score, ok := m(r)
+				if !ok {
+					return 0, false
+				}
+				total += score
+			}
+			return total, true
+		}, nil
+
+	case Or:
+		parts, err := s.compileAll(n)
+		if err != nil {
+			return nil, err
+		}
+		return func(r T) (float64, bool) {
+			best, matched := 0.0, false
+			for _, m := range parts {
+				if score, ok := m(r); ok {
+					matched = true
+					best = max(best, score)
+				}
+			}
+			return best, matched
+		}, nil
+
+	case Not:
+		inner, err := s.compile(n.Node)
+		if err != nil {
+			return nil, err
+		}
+		return func(r T) (float64, bool) {
+			_, ok := inner(r)
+			return 0, !ok
+		}, nil
+
+	case Term:
+		return s.compileTerm(n)
+	}
+
+	return nil, fmt.Errorf("unsupported expression %T", n)
+}
+
+func (s Schema[T]) compileAll(nodes []Node) ([]matcher[T], error) {
+	parts := make([]matcher[T], 0, len(nodes))
+	for _, n := range nodes {
+		m, err := s.compile(n)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, m)
+	}
+	return parts, nil
+}
+
+func (s Schema[T]) compileTerm(t Term) (matcher[T], error) {
+	if t.Field == "" {
+		// bare words match any field
+		var parts []matcher[T]
+		for _, f := range s {
+			parts = append(parts, textMatcher(f, "", t.Value))
+		}
+		return func(r T) (float64, bool) {
+			best, matched := 0.0, false
+			for _, m := range parts {
+				if score, ok := m(r); ok {
+					matched = true
+					best = max(best, score)
+				}
+			}
+			return best, matched
+		}, nil
+	}
+
+	f, ok := s.Lookup(t.Field)
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q (fields: %s)", t.Field, strings.Join(s.Names(), ", "))
+	}
+
+	switch f.Kind {
+	case Number:
+		return numberMatcher(f, t)
+	case IP:
+		if strings.Contains(t.Value, "/") && t.Op == "" {
+			prefix, err := netip.ParsePrefix(t.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q for %s", t.Value, f.Name)
+			}
+			prefix = prefix.Masked()
+			return func(r T) (float64, bool) {
+				addr, err := netip.ParseAddr(strings.TrimSpace(f.Value(r)))
+				if err != nil || !prefix.Contains(addr) {
+					return 0, false
+				}
+				return scoreExact, true
+			}, nil
+		}
+	}
+
+	switch t.Op {
+	case "", "=", "~":
+		return textMatcher(f, t.Op, t.Value), nil
+	}
+	return nil, fmt.Errorf("operator %s needs a numeric field, %s is not one", t.Op, f.Name)
+}
+
+// Relevance of the different kinds of match; fuzzy matches score below
+// scoreSubstring, scaled down by their edit distance
+const (
+	scoreExact     = 4.0
+	scorePrefix    = 3.0
+	scoreSubstring = 2.0
+	scoreFuzzy     = 1.0
+)
+
+func textMatcher[T any](f Field[T], op, value string) matcher[T] {
+	q := strings.ToLower(strings.TrimSpace(value))
+	glob := op != "~" && strings.ContainsAny(q, "*?")
+
+	return func(r T) (float64, bool) {
+		v := strings.ToLower(strings.TrimSpace(f.Value(r)))
+
+		if glob {
+			// wildcards match the whole value, like a file name pattern
+			if ok, _ := path.Match(q, v); ok {
+				return scoreExact, true
+			}
+			return 0, false
+		}
+
+		switch op {
+		case "=":
+			if v == q {
+				return scoreExact, true
+			}
+			return 0, false
+		case "~":
+			return fuzzyScore(v, q)
+		}
+
+		switch {
+		case v == q:
+			return scoreExact, true
+		case strings.HasPrefix(v, q):
+			return scorePrefix, true
+		case wordPrefix(v, q):
+			return scorePrefix - 0.5, true
+		case strings.Contains(v, q):
+			return scoreSubstring, true
+		case f.Fuzzy:
+			return fuzzyScore(v, q)
+		}
+		return 0, false
+	}
+}
+
+func numberMatcher[T any](f Field[T], t Term) (matcher[T], error) {
+	parse := f.ParseNumber
+	if parse == nil {
+		parse = func(s string) (float64, error) { return strconv.ParseFloat(s, 64) }
+	}
+
+	want, err := parse(t.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %q for %s", t.Value, f.Name)
+	}
+
+	var cmp func(float64) bool
+	switch t.Op {
+	case "", "=":
+		cmp = func(v float64) bool { return v == want }
+	case ">":
+		cmp = func(v float64) bool { return v > want }
+	case ">=":
+		cmp = func(v float64) bool { return v >= want }
+	case "<":
+		cmp = func(v float64) bool { return v < want }
+	case "<=":
+		cmp = func(v float64) bool { return v <= want }
+	default:
+		return nil, fmt.Errorf("operator %s does not apply to %s", t.Op, f.Name)
+	}
+
+	return func(r T) (float64, bool) {
+		v, ok := f.Number(r)
+		if !ok || !cmp(v) {
+			return 0, false
+		}
+		return scoreExact, true
+	}, nil
+}
+
+// wordPrefix reports whether any word of v starts with q
+func wordPrefix(v, q string) bool {
+	for _, w := range words(v) {
+		if strings.HasPrefix(w, q) {
+			return true
+		}
+	}
+	return false
+}
+
+// Embed adapts a schema over T to a schema over P, reading T through get.
+// Fields of a P without a T never match.
+func Embed[P, T any](s Schema[T], get func(P) (T, bool)) Schema[P] {
+	embedded := make(Schema[P], 0, len(s))
+	for _, f := range s {
+		f := f
+		e := Field[P]{
+			Name:        f.Name,
+			Aliases:     f.Aliases,
+			Kind:        f.Kind,
+			Fuzzy:       f.Fuzzy,
+			ParseNumber: f.ParseNumber,
+			Value: func(p P) string {
+				if t, ok := get(p); ok {
+					return f.Value(t)
+				}
+				return ""
+			},
+		}
+		if f.Number != nil {
+			e.Number = func(p P) (float64, bool) {
+				if t, ok := get(p); ok {
+					return f.Number(t)
+				}
+				return 0, false
+			}
+		}
+		embedded = append(embedded, e)
+	}
+	return embedded
+}
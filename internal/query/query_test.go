@@ -0,0 +1,302 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// show prints a parsed expression with explicit grouping
+func show(n Node) string {
+	join := func(nodes []Node, op string) string {
+		var parts []string
+		for _, x := range nodes {
+			parts = append(parts, show(x))
+		}
+		return "(" + strings.Join(parts, " "+op+" ") + ")"
+	}
+	switch n := n.(type) {
+	case And:
+		return join(n, "AND")
+	case Or:
+		return join(n, "OR")
+	case Not:
+		return "NOT " + show(n.Node)
+	case Term:
+		if n.Field == "" {
+			return fmt.Sprintf("%q", n.Value)
+		}
+		return fmt.Sprintf("%s:%s%q", n.Field, n.Op, n.Value)
+	}
+	return fmt.Sprintf("?%T", n)
+}
+
+func TestParse(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		// AND binds tighter than OR
+		{"a b OR c", `(("a" AND "b") OR "c")`},
+		{"a OR b c", `("a" OR ("b" AND "c"))`},
+		{"a | b & c", `("a" OR ("b" AND "c"))`},
+		{"a AND b OR c AND d", `(("a" AND "b") OR ("c" AND "d"))`},
+		{"(a OR b) c", `(("a" OR "b") AND "c")`},
+		{"a (b OR (c d))", `("a" AND ("b" OR ("c" AND "d")))`},
+
+		// NOT applies to the next term only
+		{"NOT a b", `(NOT "a" AND "b")`},
+		{"! a", `NOT "a"`},
+		{"NOT NOT a", `NOT NOT "a"`},
+		{"NOT (a OR b)", `NOT ("a" OR "b")`},
+		{"-a -loc:bole", `(NOT "a" AND NOT loc:"bole")`},
+		{"a - b", `("a" AND "-" AND "b")`},
+		{"a-b", `"a-b"`},
+
+		// fields, operators and quoting
+		{"Location:addis", `location:"addis"`},
+		{"bw:>=4 bw:<8", `(bw:>="4" AND bw:<"8")`},
+		{"name:=Bole name:~bol", `(name:="Bole" AND name:~"bol")`},
+		{`loc:"Bole Main"`, `loc:"Bole Main"`},
+		{`"bole main"`, `"bole main"`},
+		{`loc:Bole" "Main`, `loc:"Bole Main"`},
+		{`"OR" a`, `("OR" AND "a")`},
+		{`"a:b"`, `"a:b"`},
+		{"url:http://x", `url:"http://x"`},
+		{"ip:10.20.0.0/16", `ip:"10.20.0.0/16"`},
+		{"ip:fd00::1", `ip:"fd00::1"`},
+	} {
+		n, err := Parse(c.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", c.in, err)
+			continue
+		}
+		if got := show(n); got != c.want {
+			t.Errorf("Parse(%q) = %s, want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{"", "empty query"},
+		{"   ", "empty query"},
+		{"(a", "missing closing parenthesis"},
+		{"a)", `unexpected ")"`},
+		{"()", "missing term"},
+		{"a OR", "missing term"},
+		{"OR a", "missing term"},
+		{"NOT", "missing term"},
+		{`"abc`, "unterminated quote"},
+		{`loc:"abc`, "unterminated quote"},
+		{":x", "missing field name"},
+		{"loc:", "missing value"},
+		{"bw:>=", "missing value"},
+	} {
+		_, err := Parse(c.in)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("Parse(%q) = %v, want an error with %q", c.in, err, c.want)
+		}
+	}
+}
+
+type atm struct {
+	name, ip, region string
+	speed            float64 // 0 when unknown
+}
+
+var schema = Schema[atm]{
+	{Name: "name", Aliases: []string{"atm"}, Fuzzy: true, Value: func(a atm) string { return a.name }},
+	{Name: "ip", Kind: IP, Value: func(a atm) string { return a.ip }},
+	{Name: "region", Value: func(a atm) string { return a.region }},
+	{
+		Name:   "speed",
+		Kind:   Number,
+		Value:  func(a atm) string { return fmt.Sprint(a.speed) },
+		Number: func(a atm) (float64, bool) { return a.speed, a.speed != 0 },
+	},
+}
+
+var atms = []atm{
+	{"Bole", "10.20.1.10", "Central", 4},
+	{"Bole Main", "10.20.2.10", "Central", 8},
+	{"Piassa", "10.30.1.10", "North", 2},
+	{"Kality", "10.20.1.99", "South", 0},
+	{"Megenagna", "fd00::10", "North", 16},
+	{"ayat-branch", "atm7.bank.example", "East", 4},
+}
+
+// matching lists the names of the ATMs matching q, in inventory order
+func matching(t *testing.T, q string) string {
+	t.Helper()
+	query, err := schema.Compile(q)
+	if err != nil {
+		t.Fatalf("Compile(%q): %v", q, err)
+	}
+	var names []string
+	for _, a := range atms {
+		if query.Match(a) {
+			names = append(names, a.name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func TestMatch(t *testing.T) {
+	for _, c := range []struct{ q, want string }{
+		// bare words look in every field
+		{"bole", "Bole, Bole Main"},
+		{"north", "Piassa, Megenagna"},
+		{"bank.example", "ayat-branch"},
+
+		// exact, glob and substring text
+		{"name:=bole", "Bole"},
+		{"name:=bol", ""},
+		{"atm:bole*", "Bole, Bole Main"},
+		{"name:*a", "Piassa, Megenagna"},
+		{"name:?ole", "Bole"},
+		{"region:cent", "Bole, Bole Main"},
+		{`name:"bole main"`, "Bole Main"},
+
+		// IP fields take CIDR prefixes, unmasked ones too
+		{"ip:10.20.0.0/16", "Bole, Bole Main, Kality"},
+		{"ip:10.20.1.77/24", "Bole, Kality"},
+		{"ip:fd00::/64", "Megenagna"},
+		{"ip:10.0.0.0/8", "Bole, Bole Main, Piassa, Kality"},
+		// without a prefix they match as text, hostnames too
+		{"ip:10.20.1", "Bole, Kality"},
+		{"ip:=10.20.1.10", "Bole"},
+		{"ip:bank", "ayat-branch"},
+
+		// numbers; an unknown value never matches
+		{"speed:4", "Bole, ayat-branch"},
+		{"speed:=4", "Bole, ayat-branch"},
+		{"speed:>4", "Bole Main, Megenagna"},
+		{"speed:>=8", "Bole Main, Megenagna"},
+		{"speed:<4", "Piassa"},
+		{"speed:<=4", "Bole, Piassa, ayat-branch"},
+		{"speed:1e1", ""},
+		{"speed:<1", ""},
+
+		// combinations
+		{"region:north OR speed:>=8", "Bole Main, Piassa, Megenagna"},
+		{"region:central speed:>4", "Bole Main"},
+		{"-region:central", "Piassa, Kality, Megenagna, ayat-branch"},
+		{"NOT (region:central OR region:north)", "Kality, ayat-branch"},
+		{"ip:10.20.0.0/16 -name:=kality", "Bole, Bole Main"},
+	} {
+		if got := matching(t, c.q); got != c.want {
+			t.Errorf("%q matches %q, want %q", c.q, got, c.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, c := range []struct{ q, want string }{
+		{"colour:red", `unknown field "colour" (fields: name, ip, region, speed)`},
+		{"ip:10.20.0.0/33", "invalid CIDR"},
+		{"ip:bole/16", "invalid CIDR"},
+		{"speed:fast", `invalid number "fast" for speed`},
+		{"speed:~4", "operator ~ does not apply to speed"},
+		{"region:>3", "operator > needs a numeric field, region is not one"},
+		{"name:<=b", "needs a numeric field"},
+		{"bole OR (colour:red)", "unknown field"},
+		{"(a", "missing closing parenthesis"},
+	} {
+		_, err := schema.Compile(c.q)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("Compile(%q) = %v, want an error with %q", c.q, err, c.want)
+		}
+	}
+}
+
+func TestFuzzy(t *testing.T) {
+	for _, c := range []struct{ q, want string }{
+		// up to three letters must match exactly
+		{"bol", "Bole, Bole Main"},
+		{"bxl", ""},
+		// four to six letters allow one typo
+		{"bolle", "Bole, Bole Main"},
+		{"piasa", "Piassa"},
+		{"kalty", "Kality"},
+		{"kalyt", ""}, // a swap is two edits
+		// seven or more allow two
+		{"megenanga", "Megenagna"},
+		{"mgenanga", ""},
+		// the start of a longer word counts, one edit for the rest
+		{"megen", "Megenagna"},
+		{"branc", "ayat-branch"},
+		// only fuzzy fields are fuzzy for plain terms
+		{"region:nort", "Piassa, Megenagna"},
+		{"region:nroth", ""},
+		{"nroth", ""},
+		// ~ makes any field fuzzy, = never is
+		{"region:~nrth", "Piassa, Megenagna"},
+		{"name:=bolle", ""},
+	} {
+		if got := matching(t, c.q); got != c.want {
+			t.Errorf("%q matches %q, want %q", c.q, got, c.want)
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	records := []atm{
+		{name: "Kebole"},
+		{name: "Bolle"},
+		{name: "Addis Bole"},
+		{name: "Bole Main"},
+		{name: "Bole"},
+		{name: "Piassa"},
+	}
+	rank := func(q string) string {
+		query, err := schema.Compile(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, a := range query.Rank(records) {
+			names = append(names, a.name)
+		}
+		return strings.Join(names, ", ")
+	}
+
+	// exact, prefix, word prefix, substring, then typos
+	if got, want := rank("bole"), "Bole, Bole Main, Addis Bole, Kebole, Bolle"; got != want {
+		t.Errorf("bole ranks %q, want %q", got, want)
+	}
+	// OR keeps the best score of its sides, ties keep their order
+	if got, want := rank("name:=piassa OR main"), "Piassa, Bole Main"; got != want {
+		t.Errorf("OR ranks %q, want %q", got, want)
+	}
+	// AND adds the scores up
+	q, _ := schema.Compile("bole main")
+	exact, _ := q.Score(atm{name: "Bole Main"})
+	if full, _ := schema.Compile("bole"); true {
+		part, _ := full.Score(atm{name: "Bole Main"})
+		if exact <= part {
+			t.Errorf("two matching words score %v, no more than one word's %v", exact, part)
+		}
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	type site struct{ atm *atm }
+	embedded := Embed(schema, func(s site) (atm, bool) {
+		if s.atm == nil {
+			return atm{}, false
+		}
+		return *s.atm, true
+	})
+
+	q, err := embedded.Compile("speed:<=4 OR region:north")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.Match(site{&atms[0]}) {
+		t.Error("the embedded record did not match")
+	}
+	if q.Match(site{}) {
+		t.Error("a site without the record matched")
+	}
+	if n, err := embedded.Compile("-region:north"); err != nil || !n.Match(site{}) {
+		t.Errorf("NOT of a missing record: %v", err)
+	}
+}
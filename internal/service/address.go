@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatusUnresolved is the status of an ATM whose hostname did not resolve
+const StatusUnresolved = "Unresolved"
+
+// ParseAddress parses an IPv4 or IPv6 address. IPv6 may come in brackets,
+// as in URLs ("[fd00::10]"), and with a zone ("fe80::1%eth0").
+func ParseAddress(s string) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > 2 && s[0] == '[' && s[len(s)-1] == ']' {
+		addr, err := netip.ParseAddr(s[1 : len(s)-1])
+		if err != nil || !addr.Is6() {
+			return netip.Addr{}, fmt.Errorf("invalid address %q", s)
+		}
+		return addr, nil
+	}
+	return netip.ParseAddr(s)
+}
+
+// ValidateAddress accepts an IPv4 or IPv6 address or a DNS hostname
+func ValidateAddress(s string) error {
+	if _, err := ParseAddress(s); err == nil {
+		return nil
+	}
+	if IsHostname(s) {
+		return nil
+	}
+	return fmt.Errorf("invalid address %q: expected an IPv4 or IPv6 address or a hostname", s)
+}
+
+// IsHostname reports whether s is a valid DNS name (RFC 1123) rather than
+// an IP address. Names ending in an all-numeric label are refused, so a
+// mistyped IPv4 address such as 10.20.1 is not taken for a hostname.
+func IsHostname(s string) bool {
+	s = strings.TrimSuffix(s, ".")
+	if s == "" || len(s) > 253 {
+		return false
+	}
+	if _, err := ParseAddress(s); err == nil {
+		return false
+	}
+
+	labels := strings.Split(s, ".")
+	for _, l := range labels {
+		if l == "" || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+			return false
+		}
+		for _, c := range l {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+
+	last := labels[len(labels)-1]
+	return strings.Trim(last, "0123456789") != ""
+}
+
+// Resolver turns ATM addresses into IPs, caching hostname lookups so a
+// sweep asks DNS once per name
+type Resolver struct {
+	TTL     time.Duration // how long a lookup, good or failed, is reused
+	Timeout time.Duration // limit for one lookup
+
+	// Lookup does the DNS query; nil means the system resolver
+	Lookup func(ctx context.Context, host string) ([]netip.Addr, error)
+
+	mu    sync.Mutex
+	cache map[string]resolved
+}
+
+type resolved struct {
+	addr    netip.Addr
+	err     error
+	expires time.Time
+}
+
+// DefaultResolver is used by Probe and by report
+var DefaultResolver = &Resolver{TTL: 5 * time.Minute, Timeout: 3 * time.Second}
+
+// Resolve returns the IP for an address: IP literals as they are, hostnames
+// looked up, preferring IPv4 when a name has both
+func (r *Resolver) Resolve(address string) (netip.Addr, error) {
+	address = strings.TrimSpace(address)
+	if addr, err := ParseAddress(address); err == nil {
+		return addr, nil
+	}
+	if !IsHostname(address) {
+		return netip.Addr{}, fmt.Errorf("invalid address %q", address)
+	}
+
+	key := strings.ToLower(strings.TrimSuffix(address, "."))
+	now := time.Now()
+
+	r.mu.Lock()
+	if c, ok := r.cache[key]; ok && now.Before(c.expires) {
+		r.mu.Unlock()
+		return c.addr, c.err
+	}
+	r.mu.Unlock()
+
+	addr, err := r.lookup(key)
+	if err != nil {
+		slog.Warn("lookup failed", "host", key, "took", time.Since(now), "err", err)
+	} else {
+		slog.Debug("lookup", "host", key, "addr", addr, "took", time.Since(now))
+	}
+
+	r.mu.Lock()
+	if r.cache == nil {
+		r.cache = map[string]resolved{}
+	}
+	r.cache[key] = resolved{addr: addr, err: err, expires: now.Add(r.TTL)}
+	r.mu.Unlock()
+	return addr, err
+}
+
+func (r *Resolver) lookup(host string) (netip.Addr, error) {
+	lookup := r.Lookup
+	if lookup == nil {
+		lookup = func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		}
+	}
+
+	ctx := context.Background()
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	addrs, err := lookup(ctx, host)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	if len(addrs) == 0 {
+		return netip.Addr{}, fmt.Errorf("failed to resolve %s: no addresses", host)
+	}
+
+	for _, a := range addrs {
+		if a.Unmap().Is4() {
+			return a.Unmap(), nil
+		}
+	}
+	return addrs[0], nil
+}
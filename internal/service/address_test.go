@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseAddress(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{"10.20.1.10", "10.20.1.10"},
+		{" 10.20.1.10 ", "10.20.1.10"},
+		{"fd00::10", "fd00::10"},
+		{"FD00:0::10", "fd00::10"},
+		{"[fd00::10]", "fd00::10"},
+		{"fe80::1%eth0", "fe80::1%eth0"},
+		{"[fe80::1%eth0]", "fe80::1%eth0"},
+		{"::ffff:10.20.1.10", "::ffff:10.20.1.10"},
+	} {
+		addr, err := ParseAddress(c.in)
+		if err != nil || addr.String() != c.want {
+			t.Errorf("ParseAddress(%q) = %v, %v, want %s", c.in, addr, err, c.want)
+		}
+	}
+
+	for _, in := range []string{"", "[]", "[10.20.1.10]", "[fd00::10", "fd00::10]", "10.20.1", "10.20.1.256", "atm7.bank.example", "[atm7]"} {
+		if addr, err := ParseAddress(in); err == nil {
+			t.Errorf("ParseAddress(%q) = %v, want an error", in, addr)
+		}
+	}
+}
+
+func TestIsHostname(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want bool
+	}{
+		{"atm7", true},
+		{"atm-7.bank.example", true},
+		{"ATM7.Bank.Example.", true},
+		{"7atm.bank.example", true},
+		{"10.20.1.10.example", true},
+		{strings.Repeat("a", 63) + ".example", true},
+
+		// addresses, and mistyped ones, are not names
+		{"10.20.1.10", false},
+		{"10.20.1", false},
+		{"10.20.1.256", false},
+		{"fd00::10", false},
+		{"[fd00::10]", false},
+		{"fe80::1%eth0", false},
+
+		{"", false},
+		{".", false},
+		{"atm..bank", false},
+		{"-atm.bank", false},
+		{"atm-.bank", false},
+		{"atm_7.bank", false},
+		{"atm 7", false},
+		{strings.Repeat("a", 64) + ".example", false},
+		{strings.Repeat("a.", 127) + "ab", false},
+	} {
+		if got := IsHostname(c.in); got != c.want {
+			t.Errorf("IsHostname(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestValidateAddress(t *testing.T) {
+	for _, in := range []string{"10.20.1.10", "fd00::10", "[fd00::10]", "fe80::1%eth0", "atm7.bank.example"} {
+		if err := ValidateAddress(in); err != nil {
+			t.Errorf("ValidateAddress(%q): %v", in, err)
+		}
+	}
+	for _, in := range []string{"", "10.20.1", "10.20.1.300", "[10.20.1.10]", "atm_7", "http://atm7"} {
+		if err := ValidateAddress(in); err == nil {
+			t.Errorf("ValidateAddress(%q) passed", in)
+		}
+	}
+}
+
+// fakeDNS answers lookups from a table and counts them
+type fakeDNS struct {
+	mu      sync.Mutex
+	records map[string][]string
+	lookups map[string]int
+}
+
+func (d *fakeDNS) lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.lookups == nil {
+		d.lookups = map[string]int{}
+	}
+	d.lookups[host]++
+	if _, ok := ctx.Deadline(); !ok {
+		return nil, errors.New("lookup without a timeout")
+	}
+	ips, ok := d.records[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	var addrs []netip.Addr
+	for _, ip := range ips {
+		addrs = append(addrs, netip.MustParseAddr(ip))
+	}
+	return addrs, nil
+}
+
+func newFakeDNS() *fakeDNS {
+	return &fakeDNS{records: map[string][]string{
+		"atm7.bank.example": {"fd00::7", "::ffff:10.20.7.10"},
+		"atm8.bank.example": {"fd00::8"},
+		"empty.bank":        {},
+	}}
+}
+
+func TestResolve(t *testing.T) {
+	dns := newFakeDNS()
+	r := &Resolver{TTL: time.Hour, Timeout: time.Second, Lookup: dns.lookup}
+
+	for _, c := range []struct{ in, want, err string }{
+		// literals are never looked up
+		{"10.20.1.10", "10.20.1.10", ""},
+		{"[fd00::10]", "fd00::10", ""},
+		{"fe80::1%eth0", "fe80::1%eth0", ""},
+		// names prefer IPv4, unmapped
+		{"atm7.bank.example", "10.20.7.10", ""},
+		{"atm8.bank.example", "fd00::8", ""},
+		{"nowhere.bank", "", "failed to resolve nowhere.bank: no such host"},
+		{"empty.bank", "", "failed to resolve empty.bank: no addresses"},
+		{"10.20.1", "", `invalid address "10.20.1"`},
+	} {
+		addr, err := r.Resolve(c.in)
+		switch {
+		case c.err != "" && (err == nil || err.Error() != c.err):
+			t.Errorf("Resolve(%q) = %v, %v, want error %q", c.in, addr, err, c.err)
+		case c.err == "" && (err != nil || addr.String() != c.want):
+			t.Errorf("Resolve(%q) = %v, %v, want %s", c.in, addr, err, c.want)
+		}
+	}
+	if len(dns.lookups) != 4 || dns.lookups["10.20.1"] != 0 {
+		t.Errorf("looked up %v, want only the four names", dns.lookups)
+	}
+}
+
+func TestResolveCache(t *testing.T) {
+	dns := newFakeDNS()
+	r := &Resolver{TTL: time.Hour, Timeout: time.Second, Lookup: dns.lookup}
+
+	// names are cached case-insensitively and without the root dot
+	for _, name := range []string{"atm7.bank.example", "ATM7.Bank.Example.", " atm7.bank.example "} {
+		if addr, err := r.Resolve(name); err != nil || addr.String() != "10.20.7.10" {
+			t.Errorf("Resolve(%q) = %v, %v", name, addr, err)
+		}
+	}
+	// failures are cached too, so a dead name is not asked for per link
+	for range 3 {
+		if _, err := r.Resolve("nowhere.bank"); err == nil {
+			t.Error("nowhere.bank resolved")
+		}
+	}
+	if dns.lookups["atm7.bank.example"] != 1 || dns.lookups["nowhere.bank"] != 1 {
+		t.Errorf("lookups = %v, want one per name", dns.lookups)
+	}
+
+	// once the TTL is over the name is asked for again, and a fixed
+	// record is picked up
+	r = &Resolver{TTL: 20 * time.Millisecond, Timeout: time.Second, Lookup: dns.lookup}
+	r.Resolve("nowhere.bank")
+	dns.records["nowhere.bank"] = []string{"10.20.9.10"}
+	if _, err := r.Resolve("nowhere.bank"); err == nil {
+		t.Error("the cached failure was not reused before expiring")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if addr, err := r.Resolve("nowhere.bank"); err != nil || addr.String() != "10.20.9.10" {
+		t.Errorf("after expiry Resolve = %v, %v", addr, err)
+	}
+	if dns.lookups["nowhere.bank"] != 3 {
+		t.Errorf("nowhere.bank looked up %d times, want 3", dns.lookups["nowhere.bank"])
+	}
+}
+
+func TestGetModemIP(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{"10.20.1.10", "10.20.1.9"},
+		{"10.20.1.0", "10.20.0.0"},
+		{"172.16.1.10", "172.16.1.10"},
+		{"::ffff:10.20.1.10", "10.20.1.9"},
+		{"fd00::10", "fd00::f"},
+		{"[fd00::10]", "fd00::f"},
+		{"fe80::10%eth0", "fe80::f%eth0"},
+		// the modem stays in the ATM's /64
+		{"fd00:0:0:1::", "fd00:0:0:1::"},
+		{"atm7.bank.example", "atm7.bank.example"},
+	} {
+		if got := GetModemIP(c.in); got != c.want {
+			t.Errorf("GetModemIP(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestClassifyHostnames(t *testing.T) {
+	resolve := (&Resolver{TTL: time.Hour, Timeout: time.Second, Lookup: newFakeDNS().lookup}).Resolve
+
+	var probed []string
+	probe := func(up ...string) func(string) bool {
+		probed = nil
+		return func(ip string) bool {
+			probed = append(probed, ip)
+			for _, u := range up {
+				if ip == u {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	// the name is pinged by its address, and the modem derived from it
+	m := Machine{Name: "Ayat", IP: "atm7.bank.example"}
+	if got := Classify(m, DefaultStatusRules, resolve, probe("10.20.7.9")); got != "OnlyADSL" {
+		t.Errorf("Ayat is %s, want OnlyADSL", got)
+	}
+	if strings.Join(probed, " ") != "10.20.7.10 10.20.7.9" {
+		t.Errorf("probed %v", probed)
+	}
+
+	// nothing resolves: Unresolved, without a single ping
+	m = Machine{Name: "Gone", IP: "nowhere.bank", Links: []Link{{Name: "4g", Role: RoleBackup, Address: "gone-4g.bank"}}}
+	if got := Classify(m, DefaultStatusRules, resolve, probe()); got != StatusUnresolved {
+		t.Errorf("Gone is %s, want %s", got, StatusUnresolved)
+	}
+	if len(probed) != 0 {
+		t.Errorf("probed %v for an ATM that does not resolve", probed)
+	}
+
+	// a link that resolves but does not answer makes it Offline
+	m.Links = append(m.Links, Link{Name: "adsl", Role: RoleModem, Address: "[fd00::9]"})
+	if got := Classify(m, DefaultStatusRules, resolve, probe()); got != "Offline" {
+		t.Errorf("Gone with a modem is %s, want Offline", got)
+	}
+	if strings.Join(probed, " ") != "fd00::9" {
+		t.Errorf("probed %v", probed)
+	}
+}
@@ -1,23 +1,58 @@
 package service
 
+import "time"
+
 type Machine struct {
-	IP   string
-	Name string
+	IP     string `json:"ip"`
+	Name   string `json:"name"`
+	Region string `json:"region,omitempty"`
+	Links  []Link `json:"links,omitempty"` // links besides IP, e.g. a 4G backup
+
+	// Maintenance puts the ATM under maintenance, see ParseMaintenance
+	Maintenance string `json:"maintenance,omitempty"`
+}
+
+// MachineChange is one machine added (Before nil), edited, or deleted (After nil)
+type MachineChange struct {
+	Before *Machine
+	After  *Machine
 }
 
 type PingResult struct {
-	IP     string
-	Name   string
-	Status string
+	IP      string
+	Name    string
+	Status  string
+	Cause   string `json:",omitempty"` // suspected shared cause, see Correlate
+	LastHop string `json:",omitempty"` // last router answering a traceroute
+
+	// Attempts is how many times the ATM was probed, more than one when a
+	// failure was re-checked; 0 if it was not probed
+	Attempts int `json:",omitempty"`
+
+	// Maintenance describes the window the ATM is in; such ATMs are not
+	// counted or grouped into outages
+	Maintenance string `json:",omitempty"`
+}
+
+// StatusRecord is the last known status of an ATM, kept across report runs
+type StatusRecord struct {
+	Name    string    `json:"name"`
+	IP      string    `json:"ip"`
+	Status  string    `json:"status"`
+	Checked time.Time `json:"checked"`
+	Since   time.Time `json:"since"` // when the ATM entered Status
 }
 
+// ServicesVersion is the current schema version of the services file
+const ServicesVersion = 2
+
 type ServiceRecord struct {
-	Location       string `json:"location"`
-	WANIP          string `json:"wan_ip"`
-	LANIP          string `json:"lan_ip"`
-	ConnectionType string `json:"connection_type"`
-	Bandwidth      any    `json:"bandwidth"`
-	LineType       string `json:"line_type"`
-	ServiceNumber  any    `json:"service_number"`
-	AccountNumber  any    `json:"account_number"`
+	Location       string    `json:"location"`
+	WANIP          string    `json:"wan_ip"`
+	LANIP          string    `json:"lan_ip"`
+	ConnectionType string    `json:"connection_type"`
+	Bandwidth      Bandwidth `json:"bandwidth"`
+	LineType       string    `json:"line_type"`
+	ServiceNumber  string    `json:"service_number"`
+	AccountNumber  string    `json:"account_number"`
 }
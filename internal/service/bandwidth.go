@@ -0,0 +1,92 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Bandwidth is a line rate together with the unit it was recorded in
+type Bandwidth struct {
+	Value float64
+	Unit  string // Kbps, Mbps or Gbps
+}
+
+var bandwidthUnits = map[string]string{
+	"k": "Kbps", "kb": "Kbps", "kbps": "Kbps", "kbit": "Kbps", "kbit/s": "Kbps",
+	"m": "Mbps", "mb": "Mbps", "mbps": "Mbps", "mbit": "Mbps", "mbit/s": "Mbps",
+	"g": "Gbps", "gb": "Gbps", "gbps": "Gbps", "gbit": "Gbps", "gbit/s": "Gbps",
+}
+
+// ParseBandwidth parses values such as "4", "4M", "512 kbps" or "1.5Gbps".
+// A bare number is taken to be in Mbps.
+func ParseBandwidth(s string) (Bandwidth, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Bandwidth{}, nil
+	}
+
+	i := 0
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+		i++
+	}
+
+	value, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || value < 0 {
+		return Bandwidth{}, fmt.Errorf("invalid bandwidth %q", s)
+	}
+
+	suffix := strings.ToLower(strings.TrimSpace(s[i:]))
+	if suffix == "" {
+		return Bandwidth{Value: value, Unit: "Mbps"}, nil
+	}
+
+	unit, ok := bandwidthUnits[suffix]
+	if !ok {
+		return Bandwidth{}, fmt.Errorf("invalid bandwidth unit %q", s[i:])
+	}
+	return Bandwidth{Value: value, Unit: unit}, nil
+}
+
+// IsZero reports whether no bandwidth is recorded
+func (b Bandwidth) IsZero() bool {
+	return b.Unit == ""
+}
+
+// Mbps returns the rate converted to Mbps
+func (b Bandwidth) Mbps() float64 {
+	switch b.Unit {
+	case "Kbps":
+		return b.Value / 1000
+	case "Gbps":
+		return b.Value * 1000
+	default:
+		return b.Value
+	}
+}
+
+func (b Bandwidth) String() string {
+	if b.IsZero() {
+		return ""
+	}
+	return strconv.FormatFloat(b.Value, 'f', -1, 64) + " " + b.Unit
+}
+
+func (b Bandwidth) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.String())
+}
+
+func (b *Bandwidth) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("bandwidth must be a string such as \"4 Mbps\"")
+	}
+
+	parsed, err := ParseBandwidth(s)
+	if err != nil {
+		return err
+	}
+	*b = parsed
+	return nil
+}
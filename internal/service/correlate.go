@@ -0,0 +1,180 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Outage is a group of failed ATMs blamed on one shared cause
+type Outage struct {
+	Kind    string // "upstream", "region" or "subnet"
+	Key     string // region name or subnet
+	Cause   string // e.g. "Region South uplink down (80 ATMs, 10.20.0.1 unreachable)"
+	Members []int  // indexes into the results
+}
+
+// CorrelateOptions selects how failures are grouped
+type CorrelateOptions struct {
+	ByUpstream bool
+	ByRegion   bool
+	BySubnet   bool
+	SubnetBits int // size of an IPv4 subnet; IPv6 uses /64
+
+	// Upstreams maps a region to the address of its aggregation router
+	Upstreams map[string]string
+	// MinSize is the smallest group worth reporting as one outage
+	MinSize int
+	Probe   func(ip string) bool
+	// Rules is the decision table the statuses came from; nil means
+	// DefaultStatusRules
+	Rules []StatusRule
+}
+
+// Failed reports whether a status counts as a failure for correlation: it
+// does unless its rule needs the primary link up. Statuses no rule gives,
+// such as Offline and Unresolved, are failures; Maintenance is not.
+func Failed(status string, rules []StatusRule) bool {
+	if status == StatusMaintenance {
+		return false
+	}
+	if rules == nil {
+		rules = DefaultStatusRules
+	}
+	for _, r := range rules {
+		if r.Status == status {
+			return !slices.Contains(r.Up, RolePrimary)
+		}
+	}
+	return true
+}
+
+// Correlate groups the failed results into outages and sets their Cause.
+// machines[i] is the ATM of results[i]. An unreachable upstream router
+// explains every failure in its region; otherwise a region or subnet in
+// which every ATM failed is taken as one outage. Each ATM is blamed on the
+// first cause found, in that order.
+func Correlate(machines []Machine, results []PingResult, opts CorrelateOptions) []Outage {
+	minSize := max(opts.MinSize, 1)
+	var outages []Outage
+	claimed := make([]bool, len(results))
+
+	add := func(kind, key, cause, detail string, members []int) {
+		o := Outage{Kind: kind, Key: key, Cause: fmt.Sprintf("%s (%d ATMs%s)", cause, len(members), detail), Members: members}
+		for _, i := range members {
+			claimed[i] = true
+			results[i].Cause = o.Cause
+		}
+		outages = append(outages, o)
+	}
+
+	if opts.ByUpstream && opts.Probe != nil {
+		regions := groupBy(machines, results, func(m Machine) string { return strings.ToLower(m.Region) })
+		for _, region := range regions.keys {
+			upstream := lookupFold(opts.Upstreams, region)
+			if upstream == "" {
+				continue
+			}
+			failed := failing(results, claimed, regions.members[region], opts.Rules)
+			if len(failed) < minSize || opts.Probe(upstream) {
+				continue
+			}
+			name := machines[failed[0]].Region
+			add("upstream", name, fmt.Sprintf("Region %s uplink down", name), fmt.Sprintf(", %s unreachable", upstream), failed)
+		}
+	}
+
+	if opts.ByRegion {
+		regions := groupBy(machines, results, func(m Machine) string { return strings.ToLower(m.Region) })
+		for _, region := range regions.keys {
+			members := regions.members[region]
+			if region == "" || len(members) < minSize {
+				continue
+			}
+			if failed := failing(results, claimed, members, opts.Rules); len(failed) == len(members) {
+				name := machines[failed[0]].Region
+				add("region", name, fmt.Sprintf("Region %s uplink down", name), "", failed)
+			}
+		}
+	}
+
+	if opts.BySubnet {
+		bits := opts.SubnetBits
+		if bits <= 0 {
+			bits = 24
+		}
+		subnets := groupBy(machines, results, func(m Machine) string { return subnetOf(m.IP, bits) })
+		for _, subnet := range subnets.keys {
+			members := subnets.members[subnet]
+			if subnet == "" || len(members) < minSize {
+				continue
+			}
+			if failed := failing(results, claimed, members, opts.Rules); len(failed) == len(members) {
+				add("subnet", subnet, fmt.Sprintf("Subnet %s down", subnet), "", failed)
+			}
+		}
+	}
+
+	return outages
+}
+
+type groups struct {
+	keys    []string
+	members map[string][]int
+}
+
+// groupBy buckets machine indexes by key, keys sorted. ATMs under
+// maintenance take no part, so they neither join nor break up an outage.
+func groupBy(machines []Machine, results []PingResult, key func(Machine) string) groups {
+	g := groups{members: map[string][]int{}}
+	for i, m := range machines {
+		if results[i].Maintenance != "" {
+			continue
+		}
+		k := key(m)
+		if _, ok := g.members[k]; !ok {
+			g.keys = append(g.keys, k)
+		}
+		g.members[k] = append(g.members[k], i)
+	}
+	sort.Strings(g.keys)
+	return g
+}
+
+// failing returns the members that failed and are not yet explained
+func failing(results []PingResult, claimed []bool, members []int, rules []StatusRule) []int {
+	var failed []int
+	for _, i := range members {
+		if !claimed[i] && Failed(results[i].Status, rules) {
+			failed = append(failed, i)
+		}
+	}
+	return failed
+}
+
+// subnetOf returns the subnet of an IP address, or "" for hostnames
+func subnetOf(ip string, bits int) string {
+	addr, err := ParseAddress(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	if addr.Is6() {
+		bits = 64
+	}
+	p, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return p.String()
+}
+
+func lookupFold(m map[string]string, key string) string {
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
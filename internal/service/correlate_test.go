@@ -0,0 +1,211 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fleet is a sweep across three regions and an unnamed one
+func fleet() ([]Machine, []PingResult) {
+	rows := []struct{ name, ip, region, status string }{
+		{"N1", "10.1.1.10", "North", "Offline"},
+		{"N2", "10.1.1.11", "North", "OnlyADSL"},
+		{"N3", "10.1.2.10", "north", "OnBackup"},
+		{"S1", "10.2.1.10", "South", "Offline"},
+		{"S2", "10.2.1.11", "South", "Online"},
+		{"S3", "10.2.2.10", "South", "Offline"},
+		{"S4", "10.2.2.11", "South", "Offline"},
+		{"S5", "10.2.2.12", "South", StatusUnresolved},
+		{"E1", "10.3.1.10", "East", "Offline"},
+		{"E2", "10.3.1.11", "East", "Offline"},
+		{"E3", "10.3.1.12", "East", StatusMaintenance},
+		{"X1", "fd00::1", "", "Offline"},
+		{"X2", "[fd00::2]", "", "Offline"},
+		{"H1", "atm7.bank.example", "", "Offline"},
+	}
+	var machines []Machine
+	var results []PingResult
+	for _, r := range rows {
+		machines = append(machines, Machine{Name: r.name, IP: r.ip, Region: r.region})
+		res := PingResult{Name: r.name, IP: r.ip, Status: r.status}
+		if r.status == StatusMaintenance {
+			res.Maintenance = "refit"
+		}
+		results = append(results, res)
+	}
+	return machines, results
+}
+
+// outages prints each outage as "kind key: cause [members]"
+func outages(machines []Machine, found []Outage) []string {
+	var lines []string
+	for _, o := range found {
+		var names []string
+		for _, i := range o.Members {
+			names = append(names, machines[i].Name)
+		}
+		lines = append(lines, fmt.Sprintf("%s %s: %s %v", o.Kind, o.Key, o.Cause, names))
+	}
+	return lines
+}
+
+func TestCorrelate(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		opts CorrelateOptions
+		want []string
+	}{
+		{
+			"region",
+			CorrelateOptions{ByRegion: true, MinSize: 3},
+			// South has an ATM online, East too few outside maintenance
+			[]string{"region North: Region North uplink down (3 ATMs) [N1 N2 N3]"},
+		},
+		{
+			"small regions",
+			CorrelateOptions{ByRegion: true, MinSize: 2},
+			[]string{
+				"region East: Region East uplink down (2 ATMs) [E1 E2]",
+				"region North: Region North uplink down (3 ATMs) [N1 N2 N3]",
+			},
+		},
+		{
+			"subnet",
+			CorrelateOptions{BySubnet: true, MinSize: 2},
+			// the default /24; IPv6 by /64, hostnames not at all
+			[]string{
+				"subnet 10.1.1.0/24: Subnet 10.1.1.0/24 down (2 ATMs) [N1 N2]",
+				"subnet 10.2.2.0/24: Subnet 10.2.2.0/24 down (3 ATMs) [S3 S4 S5]",
+				"subnet 10.3.1.0/24: Subnet 10.3.1.0/24 down (2 ATMs) [E1 E2]",
+				"subnet fd00::/64: Subnet fd00::/64 down (2 ATMs) [X1 X2]",
+			},
+		},
+		{
+			"wider subnets",
+			CorrelateOptions{BySubnet: true, SubnetBits: 16, MinSize: 3},
+			[]string{"subnet 10.1.0.0/16: Subnet 10.1.0.0/16 down (3 ATMs) [N1 N2 N3]"},
+		},
+		{
+			"min size of one",
+			CorrelateOptions{BySubnet: true, SubnetBits: 24},
+			[]string{
+				"subnet 10.1.1.0/24: Subnet 10.1.1.0/24 down (2 ATMs) [N1 N2]",
+				"subnet 10.1.2.0/24: Subnet 10.1.2.0/24 down (1 ATMs) [N3]",
+				"subnet 10.2.2.0/24: Subnet 10.2.2.0/24 down (3 ATMs) [S3 S4 S5]",
+				"subnet 10.3.1.0/24: Subnet 10.3.1.0/24 down (2 ATMs) [E1 E2]",
+				"subnet fd00::/64: Subnet fd00::/64 down (2 ATMs) [X1 X2]",
+			},
+		},
+		{
+			"region before subnet",
+			CorrelateOptions{ByRegion: true, BySubnet: true, MinSize: 2},
+			[]string{
+				"region East: Region East uplink down (2 ATMs) [E1 E2]",
+				"region North: Region North uplink down (3 ATMs) [N1 N2 N3]",
+				"subnet 10.2.2.0/24: Subnet 10.2.2.0/24 down (3 ATMs) [S3 S4 S5]",
+				"subnet fd00::/64: Subnet fd00::/64 down (2 ATMs) [X1 X2]",
+			},
+		},
+		{
+			"upstream without a probe",
+			CorrelateOptions{ByUpstream: true, Upstreams: map[string]string{"South": "10.2.0.1"}},
+			nil,
+		},
+	} {
+		machines, results := fleet()
+		found := outages(machines, Correlate(machines, results, c.opts))
+		if !slices.Equal(found, c.want) {
+			t.Errorf("%s:\n got %s\nwant %s", c.name, strings.Join(found, "\n     "), strings.Join(c.want, "\n     "))
+		}
+	}
+}
+
+func TestCorrelateUpstream(t *testing.T) {
+	machines, results := fleet()
+	var probed []string
+	opts := CorrelateOptions{
+		ByUpstream: true,
+		ByRegion:   true,
+		MinSize:    3,
+		Upstreams:  map[string]string{"NORTH": "10.1.0.1", "South": "10.2.0.1", "East": "10.3.0.1"},
+		Probe: func(ip string) bool {
+			probed = append(probed, ip)
+			return ip == "10.1.0.1"
+		},
+	}
+
+	found := outages(machines, Correlate(machines, results, opts))
+	want := []string{
+		// South's failures are blamed on its router despite S2 answering
+		"upstream South: Region South uplink down (4 ATMs, 10.2.0.1 unreachable) [S1 S3 S4 S5]",
+		// North's router answers, so its outage is the region's own
+		"region North: Region North uplink down (3 ATMs) [N1 N2 N3]",
+	}
+	if !slices.Equal(found, want) {
+		t.Errorf("got %s\nwant %s", strings.Join(found, "\n    "), strings.Join(want, "\n     "))
+	}
+	// East has too few failures for its router to be worth a ping
+	if !slices.Equal(probed, []string{"10.1.0.1", "10.2.0.1"}) {
+		t.Errorf("probed %v", probed)
+	}
+
+	for i, r := range results {
+		switch machines[i].Region {
+		case "South":
+			if r.Status != "Online" && !strings.HasPrefix(r.Cause, "Region South uplink down") {
+				t.Errorf("%s cause %q", r.Name, r.Cause)
+			}
+			if r.Status == "Online" && r.Cause != "" {
+				t.Errorf("online %s blamed on %q", r.Name, r.Cause)
+			}
+		case "East", "":
+			if r.Cause != "" {
+				t.Errorf("%s blamed on %q", r.Name, r.Cause)
+			}
+		}
+	}
+}
+
+func TestFailed(t *testing.T) {
+	rules := []StatusRule{
+		{Status: "Up", Up: []Role{RolePrimary}},
+		{Status: "PrimaryOnly", Up: []Role{RolePrimary}, Down: []Role{RoleBackup}},
+		{Status: "Degraded", Up: []Role{RoleBackup}},
+		{Status: "Dark"},
+	}
+	for _, c := range []struct {
+		status string
+		rules  []StatusRule
+		want   bool
+	}{
+		{"Online", nil, false},
+		{"OnBackup", nil, true},
+		{"OnlyADSL", nil, true},
+		{"Offline", nil, true},
+		{StatusUnresolved, nil, true},
+		{StatusMaintenance, nil, false},
+		{"Up", rules, false},
+		{"PrimaryOnly", rules, false},
+		{"Degraded", rules, true},
+		{"Dark", rules, true},
+		{"Offline", rules, true},
+		{StatusMaintenance, rules, false},
+	} {
+		if got := Failed(c.status, c.rules); got != c.want {
+			t.Errorf("Failed(%s) with %d rules = %v, want %v", c.status, len(c.rules), got, c.want)
+		}
+	}
+
+	// an ATM up on a custom status breaks up its region's outage
+	machines := []Machine{{Name: "A", Region: "West"}, {Name: "B", Region: "West"}, {Name: "C", Region: "West"}}
+	results := []PingResult{{Status: "Degraded"}, {Status: "Dark"}, {Status: "Up"}}
+	if found := Correlate(machines, results, CorrelateOptions{ByRegion: true, Rules: rules}); len(found) != 0 {
+		t.Errorf("region with an ATM Up grouped: %v", outages(machines, found))
+	}
+	results[2].Status = "Degraded"
+	if found := Correlate(machines, results, CorrelateOptions{ByRegion: true, Rules: rules}); len(found) != 1 {
+		t.Errorf("region with every ATM failed not grouped: %v", outages(machines, found))
+	}
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/fahmaliyi/atmer/internal/query"
+)
+
+// ServiceSchema lists the service record fields available to queries
+var ServiceSchema = query.Schema[ServiceRecord]{
+	{
+		Name:    "location",
+		Aliases: []string{"loc"},
+		Fuzzy:   true,
+		Value:   func(r ServiceRecord) string { return r.Location },
+	},
+	{
+		Name:    "wan",
+		Aliases: []string{"wanip", "wan_ip"},
+		Kind:    query.IP,
+		Value:   func(r ServiceRecord) string { return r.WANIP },
+	},
+	{
+		Name:    "lan",
+		Aliases: []string{"lanip", "lan_ip"},
+		Kind:    query.IP,
+		Value:   func(r ServiceRecord) string { return r.LANIP },
+	},
+	{
+		Name:    "conn",
+		Aliases: []string{"connection", "connectiontype", "connection_type"},
+		Value:   func(r ServiceRecord) string { return r.ConnectionType },
+	},
+	{
+		Name:    "bw",
+		Aliases: []string{"bandwidth"},
+		Kind:    query.Number,
+		Value:   func(r ServiceRecord) string { return r.Bandwidth.String() },
+		Number: func(r ServiceRecord) (float64, bool) {
+			return r.Bandwidth.Mbps(), !r.Bandwidth.IsZero()
+		},
+		ParseNumber: func(s string) (float64, error) {
+			b, err := ParseBandwidth(s)
+			return b.Mbps(), err
+		},
+	},
+	{
+		Name:    "line",
+		Aliases: []string{"linetype", "line_type"},
+		Value:   func(r ServiceRecord) string { return r.LineType },
+	},
+	{
+		Name:    "service",
+		Aliases: []string{"sn", "servicenumber", "service_number"},
+		Value:   func(r ServiceRecord) string { return r.ServiceNumber },
+	},
+	{
+		Name:    "account",
+		Aliases: []string{"acct", "accountnumber", "account_number"},
+		Value:   func(r ServiceRecord) string { return r.AccountNumber },
+	},
+}
+
+// MachineSchema lists the ATM fields available to queries
+var MachineSchema = query.Schema[Machine]{
+	{
+		Name:    "name",
+		Aliases: []string{"atm"},
+		Fuzzy:   true,
+		Value:   func(m Machine) string { return m.Name },
+	},
+	{
+		Name:  "ip",
+		Kind:  query.IP,
+		Value: func(m Machine) string { return m.IP },
+	},
+	{
+		Name:  "modem",
+		Kind:  query.IP,
+		Value: func(m Machine) string { return m.Modem() },
+	},
+	{
+		Name:  "region",
+		Value: func(m Machine) string { return m.Region },
+	},
+	{
+		Name:  "links",
+		Value: func(m Machine) string { return FormatLinks(m.Links) },
+	},
+	{
+		Name:  "maintenance",
+		Value: func(m Machine) string { return m.Maintenance },
+	},
+}
+
+// SiteSchema queries ATMs and service records together; fields of whichever
+// side a site lacks never match
+var SiteSchema = append(append(
+	query.Embed(MachineSchema, func(s Site) (Machine, bool) {
+		if s.Machine == nil {
+			return Machine{}, false
+		}
+		return *s.Machine, true
+	}),
+	query.Embed(ServiceSchema, func(s Site) (ServiceRecord, bool) {
+		if s.Record == nil {
+			return ServiceRecord{}, false
+		}
+		return *s.Record, true
+	})...),
+	query.Field[Site]{
+		Name: "status",
+		Value: func(s Site) string {
+			if s.Status == nil {
+				return ""
+			}
+			return s.Status.Status
+		},
+	},
+)
+
+// Change is one field that differs between two versions of a record
+type Change struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// ServiceChanges lists the fields that differ between before and after
+func ServiceChanges(before, after ServiceRecord) []Change {
+	return fieldChanges(ServiceSchema, before, after)
+}
+
+// MachineChanges lists the fields that differ between before and after
+func MachineChanges(before, after Machine) []Change {
+	return fieldChanges(MachineSchema, before, after)
+}
+
+func fieldChanges[T any](schema query.Schema[T], before, after T) []Change {
+	var changes []Change
+	for _, f := range schema {
+		if old, cur := f.Value(before), f.Value(after); old != cur {
+			changes = append(changes, Change{Field: f.Name, Old: old, New: cur})
+		}
+	}
+	return changes
+}
+
+// SetServiceField validates value for the named field, which may be any
+// name or alias from ServiceSchema, and stores it in r
+func SetServiceField(r *ServiceRecord, name, value string) error {
+	f, ok := ServiceSchema.Lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown field %q (fields: %s)", name, strings.Join(ServiceSchema.Names(), ", "))
+	}
+	value = strings.TrimSpace(value)
+
+	switch f.Name {
+	case "location":
+		if value == "" {
+			return fmt.Errorf("location cannot be empty")
+		}
+		r.Location = value
+	case "wan", "lan":
+		if value != "" {
+			if _, err := netip.ParseAddr(value); err != nil {
+				return fmt.Errorf("invalid IP address %q for %s", value, f.Name)
+			}
+		}
+		if f.Name == "wan" {
+			r.WANIP = value
+		} else {
+			r.LANIP = value
+		}
+	case "conn":
+		r.ConnectionType = value
+	case "bw":
+		bw, err := ParseBandwidth(value)
+		if err != nil {
+			return err
+		}
+		r.Bandwidth = bw
+	case "line":
+		r.LineType = value
+	case "service":
+		r.ServiceNumber = value
+	case "account":
+		r.AccountNumber = value
+	}
+	return nil
+}
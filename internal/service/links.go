@@ -0,0 +1,118 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Role is what a link is for; the status table decides on roles, not on
+// individual links
+type Role string
+
+const (
+	RolePrimary Role = "primary"
+	RoleBackup  Role = "backup"
+	RoleModem   Role = "modem"
+)
+
+// Roles lists the known link roles
+var Roles = []Role{RolePrimary, RoleBackup, RoleModem}
+
+// Link is one way of reaching an ATM, e.g. a 4G backup router
+type Link struct {
+	Name    string `json:"name"`
+	Role    Role   `json:"role"`
+	Address string `json:"address"`
+}
+
+// ParseRole checks a role name
+func ParseRole(s string) (Role, error) {
+	r := Role(strings.ToLower(strings.TrimSpace(s)))
+	if !slices.Contains(Roles, r) {
+		return "", fmt.Errorf("unknown link role %q (roles: primary, backup, modem)", s)
+	}
+	return r, nil
+}
+
+// ParseLinks reads links written as name:role=address separated by
+// semicolons, e.g. "4g:backup=10.50.1.10; adsl:modem=10.20.1.9". The name
+// may be left out and defaults to the role.
+func ParseLinks(s string) ([]Link, error) {
+	var links []Link
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		label, address, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid link %q, expected name:role=address", part)
+		}
+		name, role, ok := strings.Cut(label, ":")
+		if !ok {
+			role = name
+		}
+
+		l := Link{Name: strings.TrimSpace(name), Address: strings.TrimSpace(address)}
+		var err error
+		if l.Role, err = ParseRole(role); err != nil {
+			return nil, err
+		}
+		if err := ValidateAddress(l.Address); err != nil {
+			return nil, fmt.Errorf("link %s: %w", l.Name, err)
+		}
+		links = append(links, l)
+	}
+	return links, nil
+}
+
+// FormatLinks writes links the way ParseLinks reads them
+func FormatLinks(links []Link) string {
+	parts := make([]string, len(links))
+	for i, l := range links {
+		if l.Name == "" || l.Name == string(l.Role) {
+			parts[i] = fmt.Sprintf("%s=%s", l.Role, l.Address)
+		} else {
+			parts[i] = fmt.Sprintf("%s:%s=%s", l.Name, l.Role, l.Address)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// AllLinks returns every link of the ATM: its IP as the primary link, the
+// extra links, and the derived modem address if no modem link is listed
+func (m Machine) AllLinks() []Link {
+	links := append([]Link{{Name: string(RolePrimary), Role: RolePrimary, Address: m.IP}}, m.Links...)
+	if !m.hasRole(RoleModem) {
+		links = append(links, Link{Name: string(RoleModem), Role: RoleModem, Address: GetModemIP(m.IP)})
+	}
+	return links
+}
+
+// Modem returns the address of the ATM's modem: the first modem link, or
+// the one derived from its IP
+func (m Machine) Modem() string {
+	for _, l := range m.Links {
+		if l.Role == RoleModem {
+			return l.Address
+		}
+	}
+	return GetModemIP(m.IP)
+}
+
+func (m Machine) hasRole(role Role) bool {
+	for _, l := range m.Links {
+		if l.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Equal reports whether two machines have the same fields and links
+func (m Machine) Equal(o Machine) bool {
+	return m.IP == o.IP && m.Name == o.Name && m.Region == o.Region && slices.Equal(m.Links, o.Links) &&
+		m.Maintenance == o.Maintenance
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseLinks(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want []Link
+		out  string // FormatLinks of the result
+	}{
+		{"", nil, ""},
+		{"backup=10.50.1.10", []Link{{Name: "backup", Role: RoleBackup, Address: "10.50.1.10"}}, "backup=10.50.1.10"},
+		{
+			" 4g:Backup = 10.50.1.10 ; adsl:modem=10.20.1.9; ",
+			[]Link{{Name: "4g", Role: RoleBackup, Address: "10.50.1.10"}, {Name: "adsl", Role: RoleModem, Address: "10.20.1.9"}},
+			"4g:backup=10.50.1.10; adsl:modem=10.20.1.9",
+		},
+		{
+			"lte:backup=[fd00::7];vsat:backup=vsat7.bank.example",
+			[]Link{{Name: "lte", Role: RoleBackup, Address: "[fd00::7]"}, {Name: "vsat", Role: RoleBackup, Address: "vsat7.bank.example"}},
+			"lte:backup=[fd00::7]; vsat:backup=vsat7.bank.example",
+		},
+	} {
+		links, err := ParseLinks(c.in)
+		if err != nil || !slices.Equal(links, c.want) {
+			t.Errorf("ParseLinks(%q) = %+v, %v, want %+v", c.in, links, err, c.want)
+			continue
+		}
+		if got := FormatLinks(links); got != c.out {
+			t.Errorf("FormatLinks(%+v) = %q, want %q", links, got, c.out)
+		}
+		if again, err := ParseLinks(FormatLinks(links)); err != nil || !slices.Equal(again, links) {
+			t.Errorf("%q does not read back: %+v, %v", c.out, again, err)
+		}
+	}
+}
+
+func TestParseLinksErrors(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{"10.50.1.10", `invalid link "10.50.1.10"`},
+		{"4g:wifi=10.50.1.10", `unknown link role "wifi"`},
+		{"backup=10.50.1", `link backup: invalid address "10.50.1"`},
+		{"ok:backup=10.50.1.10; 4g:backup=", "link 4g: invalid address"},
+	} {
+		_, err := ParseLinks(c.in)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("ParseLinks(%q) = %v, want an error with %q", c.in, err, c.want)
+		}
+	}
+}
+
+func TestAllLinks(t *testing.T) {
+	show := func(links []Link) string {
+		var parts []string
+		for _, l := range links {
+			parts = append(parts, l.Name+":"+string(l.Role)+"="+l.Address)
+		}
+		return strings.Join(parts, " ")
+	}
+
+	m := Machine{Name: "Bole", IP: "10.20.1.10"}
+	if got := show(m.AllLinks()); got != "primary:primary=10.20.1.10 modem:modem=10.20.1.9" {
+		t.Errorf("plain ATM links: %s", got)
+	}
+	if m.Modem() != "10.20.1.9" {
+		t.Errorf("derived modem %s", m.Modem())
+	}
+
+	m.Links = []Link{{Name: "4g", Role: RoleBackup, Address: "10.50.1.10"}}
+	if got := show(m.AllLinks()); got != "primary:primary=10.20.1.10 4g:backup=10.50.1.10 modem:modem=10.20.1.9" {
+		t.Errorf("ATM with a backup: %s", got)
+	}
+
+	// a listed modem replaces the derived one, the first one counting
+	m.Links = append(m.Links, Link{Name: "adsl", Role: RoleModem, Address: "10.60.1.1"}, Link{Name: "adsl2", Role: RoleModem, Address: "10.60.1.2"})
+	if got := show(m.AllLinks()); got != "primary:primary=10.20.1.10 4g:backup=10.50.1.10 adsl:modem=10.60.1.1 adsl2:modem=10.60.1.2" {
+		t.Errorf("ATM with modems: %s", got)
+	}
+	if m.Modem() != "10.60.1.1" {
+		t.Errorf("listed modem %s", m.Modem())
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for _, in := range []string{"primary", " Backup ", "MODEM"} {
+		if r, err := ParseRole(in); err != nil || string(r) != strings.ToLower(strings.TrimSpace(in)) {
+			t.Errorf("ParseRole(%q) = %q, %v", in, r, err)
+		}
+	}
+	if _, err := ParseRole("adsl"); err == nil {
+		t.Error("ParseRole accepted adsl")
+	}
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// StatusMaintenance is the status of ATMs under maintenance that are not
+// probed
+const StatusMaintenance = "Maintenance"
+
+// Window is a maintenance period for one ATM or a whole region. ATMs in an
+// active window are left out of the counts and outage grouping.
+type Window struct {
+	ATM    string    // name or address
+	Region string    // the whole region, when ATM is empty
+	From   time.Time // zero: already started
+	Until  time.Time // zero: open-ended, e.g. a decommissioned branch
+	Reason string
+	Probe  bool // probe anyway and report the status separately
+}
+
+// Active reports whether the window is open at now
+func (w Window) Active(now time.Time) bool {
+	return (w.From.IsZero() || !now.Before(w.From)) && (w.Until.IsZero() || now.Before(w.Until))
+}
+
+// Covers reports whether the window is for m
+func (w Window) Covers(m Machine) bool {
+	if w.ATM != "" {
+		return strings.EqualFold(w.ATM, m.Name) || w.ATM == m.IP
+	}
+	return w.Region != "" && strings.EqualFold(w.Region, m.Region)
+}
+
+// String describes the window for reports, e.g. "branch refit (through
+// 2026-11-01)"
+func (w Window) String() string {
+	until := "open-ended"
+	switch {
+	case w.Until.IsZero():
+	case w.Until.Equal(midnight(w.Until)):
+		until = "through " + w.Until.AddDate(0, 0, -1).Format("2006-01-02")
+	default:
+		until = "until " + w.Until.Format("2006-01-02 15:04")
+	}
+	if w.Reason == "" {
+		return until
+	}
+	return fmt.Sprintf("%s (%s)", w.Reason, until)
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// FindWindow returns the first active window covering m, including the one
+// from m's own Maintenance column
+func FindWindow(windows []Window, m Machine, now time.Time) (Window, bool) {
+	if m.Maintenance != "" {
+		w, err := ParseMaintenance(m.Maintenance)
+		if err != nil {
+			// LoadSheet rejects these, but Machines may come from elsewhere
+			slog.Warn("maintenance ignored", "atm", m.Name, "err", err)
+		} else if w.Active(now) {
+			w.ATM = m.Name
+			return w, true
+		}
+	}
+	for _, w := range windows {
+		if w.Active(now) && w.Covers(m) {
+			return w, true
+		}
+	}
+	return Window{}, false
+}
+
+// ParseMaintenance reads an ATM's Maintenance column: an expiry time
+// ("2026-11-01 18:00"), a reason ("decommissioned", open-ended) or both
+// ("branch refit until 2026-11-01"). Text after "until" that is not a date,
+// as in "closed until further notice", is part of an open-ended reason.
+func ParseMaintenance(s string) (Window, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Window{}, fmt.Errorf("empty maintenance")
+	}
+
+	reason, when := s, ""
+	// " until " in the padded text starts one byte before "until" in s
+	i := strings.LastIndex(" "+strings.ToLower(s), " until ")
+	if i >= 0 && looksLikeDate(strings.TrimSpace(s[i+len("until"):])) {
+		reason, when = strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+len("until"):])
+	} else if looksLikeDate(s) {
+		reason, when = "", s
+	}
+
+	w := Window{Reason: reason}
+	if when != "" {
+		until, err := ParseWhen(when, true)
+		if err != nil {
+			return Window{}, fmt.Errorf("invalid maintenance %q: %w", s, err)
+		}
+		w.Until = until
+	}
+	return w, nil
+}
+
+// looksLikeDate tells a mistyped expiry from a reason, so "2026-13-01" is
+// an error rather than an open-ended window
+func looksLikeDate(s string) bool {
+	return len(s) >= 5 && strings.IndexFunc(s[:4], func(r rune) bool { return r < '0' || r > '9' }) < 0 && s[4] == '-'
+}
+
+// whenLayouts are the accepted maintenance times, in local time unless the
+// zone is given
+var whenLayouts = []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"}
+
+// ParseWhen reads a maintenance time. A bare date is the start of that day,
+// or with end set the end of it, so "until 2026-11-01" includes the 1st.
+func ParseWhen(s string, end bool) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range whenLayouts {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err != nil {
+			continue
+		}
+		if layout == "2006-01-02" && end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected e.g. 2026-11-01 or 2026-11-01 18:00", s)
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMaintenance(t *testing.T) {
+	for _, c := range []struct {
+		in, reason, until string // until as 2006-01-02 15:04, "" when open-ended
+	}{
+		{"decommissioned", "decommissioned", ""},
+		{"2026-11-01 18:00", "", "2026-11-01 18:00"},
+		{"branch refit until 2026-11-01", "branch refit", "2026-11-02 00:00"},
+		{"Refit UNTIL 2026-11-01 18:00", "Refit", "2026-11-01 18:00"},
+		// an "until" not followed by a date is part of the reason
+		{"closed until further notice", "closed until further notice", ""},
+		{"until the new switch arrives", "until the new switch arrives", ""},
+		{"on hold until landlord signs until 2026-11-01", "on hold until landlord signs", "2026-11-02 00:00"},
+	} {
+		w, err := ParseMaintenance(c.in)
+		if err != nil {
+			t.Errorf("ParseMaintenance(%q): %v", c.in, err)
+			continue
+		}
+		until := ""
+		if !w.Until.IsZero() {
+			until = w.Until.Format("2006-01-02 15:04")
+		}
+		if w.Reason != c.reason || until != c.until {
+			t.Errorf("ParseMaintenance(%q) = %q until %q, want %q until %q", c.in, w.Reason, until, c.reason, c.until)
+		}
+	}
+
+	// mistyped dates are still errors, so LoadSheet catches them
+	for _, in := range []string{"", "2026-13-01", "refit until 2026-11-31"} {
+		if _, err := ParseMaintenance(in); err == nil {
+			t.Errorf("ParseMaintenance(%q) accepted", in)
+		}
+	}
+}
+
+func TestFindWindowBadMaintenance(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)
+	if w, ok := FindWindow(nil, Machine{Name: "Bole", Maintenance: "closed until further notice"}, now); !ok || w.ATM != "Bole" {
+		t.Errorf("open-ended reason with until: %+v, %v", w, ok)
+	}
+
+	regional := []Window{{Region: "North", Reason: "fibre cut"}}
+	m := Machine{Name: "Piassa", Region: "North", Maintenance: "refit until 2026-13-01"}
+	if w, ok := FindWindow(regional, m, now); !ok || w.Reason != "fibre cut" {
+		t.Errorf("the region's window was not found past a bad column: %+v, %v", w, ok)
+	}
+	if !strings.Contains(buf.String(), "maintenance ignored") || !strings.Contains(buf.String(), "atm=Piassa") {
+		t.Errorf("no warning for the bad column: %q", buf.String())
+	}
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// MigrationIssue describes a legacy value that could not be converted as-is
+type MigrationIssue struct {
+	Index    int // position of the record in the file, starting at 1
+	Location string
+	Field    string
+	Value    string
+	Reason   string
+}
+
+func (i MigrationIssue) String() string {
+	return fmt.Sprintf("record %d (%s): %s %s: %s", i.Index, i.Location, i.Field, i.Value, i.Reason)
+}
+
+// legacyServiceRecord is the unversioned layout, where numeric-looking
+// columns were stored as either JSON strings or numbers
+type legacyServiceRecord struct {
+	Location       string `json:"location"`
+	WANIP          string `json:"wan_ip"`
+	LANIP          string `json:"lan_ip"`
+	ConnectionType string `json:"connection_type"`
+	Bandwidth      any    `json:"bandwidth"`
+	LineType       string `json:"line_type"`
+	ServiceNumber  any    `json:"service_number"`
+	AccountNumber  any    `json:"account_number"`
+}
+
+// MigrateServices converts a legacy services file to the current schema.
+// Numbers are decoded as json.Number, so identifiers keep every digit as
+// written. Values that cannot be converted are reported, not guessed.
+func MigrateServices(data []byte) ([]ServiceRecord, []MigrationIssue, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var legacy []legacyServiceRecord
+	if err := dec.Decode(&legacy); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse legacy json: %w", err)
+	}
+
+	records := make([]ServiceRecord, 0, len(legacy))
+	var issues []MigrationIssue
+
+	for i, l := range legacy {
+		report := func(field string, value any, reason string) {
+			issues = append(issues, MigrationIssue{
+				Index:    i + 1,
+				Location: l.Location,
+				Field:    field,
+				Value:    fmt.Sprintf("%v", value),
+				Reason:   reason,
+			})
+		}
+
+		r := ServiceRecord{
+			Location:       l.Location,
+			WANIP:          l.WANIP,
+			LANIP:          l.LANIP,
+			ConnectionType: l.ConnectionType,
+			LineType:       l.LineType,
+		}
+
+		var err error
+		if r.ServiceNumber, err = legacyIdentifier(l.ServiceNumber); err != nil {
+			report("service_number", l.ServiceNumber, err.Error())
+		}
+		if r.AccountNumber, err = legacyIdentifier(l.AccountNumber); err != nil {
+			report("account_number", l.AccountNumber, err.Error())
+		}
+		if r.Bandwidth, err = legacyBandwidth(l.Bandwidth); err != nil {
+			report("bandwidth", l.Bandwidth, err.Error())
+		}
+
+		records = append(records, r)
+	}
+
+	return records, issues, nil
+}
+
+// legacyIdentifier turns a string or number into its exact decimal text
+func legacyIdentifier(v any) (string, error) {
+	switch val := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return val, nil
+	case json.Number:
+		f, ok := new(big.Float).SetPrec(512).SetString(val.String())
+		if !ok {
+			return "", fmt.Errorf("not a number")
+		}
+		if !f.IsInt() {
+			return val.String(), fmt.Errorf("not a whole number, kept as written")
+		}
+		return f.Text('f', 0), nil
+	default:
+		return "", fmt.Errorf("unsupported %T value, left empty", v)
+	}
+}
+
+// legacyBandwidth parses a bandwidth that may have been a bare number of Mbps
+func legacyBandwidth(v any) (Bandwidth, error) {
+	switch val := v.(type) {
+	case nil:
+		return Bandwidth{}, nil
+	case string:
+		b, err := ParseBandwidth(val)
+		if err != nil {
+			return Bandwidth{}, fmt.Errorf("%s, left empty", err)
+		}
+		return b, nil
+	case json.Number:
+		// JSON allows exponents such as 1e3, which ParseBandwidth does not
+		f, ok := new(big.Float).SetString(val.String())
+		if !ok || f.Sign() < 0 {
+			return Bandwidth{}, fmt.Errorf("invalid bandwidth %s, left empty", val)
+		}
+		return ParseBandwidth(f.Text('f', -1))
+	default:
+		return Bandwidth{}, fmt.Errorf("unsupported %T value, left empty", v)
+	}
+}
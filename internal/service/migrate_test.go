@@ -0,0 +1,48 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrateServices(t *testing.T) {
+	legacy := `[
+		{"location": "Bole", "bandwidth": 4, "service_number": 251911000123456789, "account_number": "00123"},
+		{"location": "Piassa", "bandwidth": 1e3, "service_number": 2.51911e5, "account_number": 1.5},
+		{"location": "Kality", "bandwidth": "512 kbps", "service_number": null},
+		{"location": "CMC", "bandwidth": 2.5E-1},
+		{"location": "Ayat", "bandwidth": -2},
+		{"location": "Megenagna", "bandwidth": "fast", "service_number": true}
+	]`
+
+	records, issues, err := MigrateServices([]byte(legacy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []struct {
+		bandwidth, service, account string
+	}{
+		{"4 Mbps", "251911000123456789", "00123"},
+		{"1000 Mbps", "251911", "1.5"},
+		{"512 Kbps", "", ""},
+		{"0.25 Mbps", "", ""},
+		{"", "", ""},
+		{"", "", ""},
+	} {
+		r := records[i]
+		if r.Bandwidth.String() != want.bandwidth || r.ServiceNumber != want.service || r.AccountNumber != want.account {
+			t.Errorf("%s = %q, %q, %q, want %q, %q, %q", r.Location, r.Bandwidth, r.ServiceNumber, r.AccountNumber,
+				want.bandwidth, want.service, want.account)
+		}
+	}
+
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.Location+" "+issue.Field)
+	}
+	want := "Piassa account_number, Ayat bandwidth, Megenagna service_number, Megenagna bandwidth"
+	if strings.Join(got, ", ") != want {
+		t.Errorf("issues = %q, want %q", got, want)
+	}
+}
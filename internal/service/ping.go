@@ -1,51 +1,118 @@
 package service
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"log/slog"
+	"net/netip"
 	"os/exec"
+	"regexp"
 	"runtime"
-	"strings"
+	"strconv"
+	"time"
 )
 
 func Ping(ip string) bool {
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command("ping", "-n", "1", "-w", "1000", ip)
-	} else {
-		cmd = exec.Command("ping", "-c", "1", "-W", "1", ip)
-	}
-	err := cmd.Run()
-	return err == nil
+	ok, _ := Probe(ip)
+	return ok
 }
 
-func atoi(s string) int {
-	var n int
-	fmt.Sscanf(s, "%d", &n)
-	return n
+// rttPattern finds the round trip time in ping output, e.g. "time=1.23 ms"
+// or "time<1ms"
+var rttPattern = regexp.MustCompile(`time[=<]\s*([0-9.]+)\s*ms`)
+
+// Probe pings ip once and reports whether it answered and the round trip
+// time. ip may be an IPv4 or IPv6 address or a hostname, which is resolved
+// through DefaultResolver; a name that does not resolve counts as no answer.
+// The time is read from ping's output when possible, otherwise it is how
+// long the ping command took.
+func Probe(ip string) (bool, time.Duration) {
+	return ProbeContext(context.Background(), ip)
+}
+
+// ProbeContext is Probe, killing the ping when ctx is cancelled
+func ProbeContext(ctx context.Context, ip string) (bool, time.Duration) {
+	addr, err := DefaultResolver.Resolve(ip)
+	if err != nil {
+		slog.Debug("probe skipped", "target", ip, "err", err)
+		return false, 0
+	}
+	cmd := pingCommand(ctx, addr)
+
+	start := time.Now()
+	out, err := cmd.Output()
+	elapsed := time.Since(start)
+	if ctx.Err() != nil {
+		return false, 0
+	}
+	if err != nil {
+		// ping exits 1 when no reply came within its timeout, anything
+		// else means it could not run
+		var exit *exec.ExitError
+		if errors.As(err, &exit) && exit.ExitCode() == 1 {
+			slog.Debug("probe timed out", "target", ip, "addr", addr, "command", cmd.String(), "took", elapsed)
+		} else {
+			slog.Warn("probe failed", "target", ip, "addr", addr, "command", cmd.String(), "took", elapsed, "err", err)
+		}
+		return false, 0
+	}
+
+	rtt := elapsed
+	if m := rttPattern.FindSubmatch(out); m != nil {
+		if ms, err := strconv.ParseFloat(string(m[1]), 64); err == nil {
+			rtt = time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	slog.Debug("probe answered", "target", ip, "addr", addr, "command", cmd.String(), "rtt", rtt, "took", elapsed)
+	return true, rtt
 }
 
-func itoa(i int) string {
-	return fmt.Sprintf("%d", i)
+// pingCommand builds a single-echo ping for addr. BSD and macOS ping only
+// speak IPv4, IPv6 needs ping6 there.
+func pingCommand(ctx context.Context, addr netip.Addr) *exec.Cmd {
+	target := addr.String()
+	switch {
+	case runtime.GOOS == "windows":
+		return exec.CommandContext(ctx, "ping", "-n", "1", "-w", "1000", target)
+	case addr.Is6() && runtime.GOOS != "linux":
+		return exec.CommandContext(ctx, "ping6", "-c", "1", target)
+	case addr.Is6():
+		return exec.CommandContext(ctx, "ping", "-6", "-c", "1", "-W", "1", target)
+	default:
+		return exec.CommandContext(ctx, "ping", "-c", "1", "-W", "1", target)
+	}
 }
 
+// GetModemIP derives the ADSL modem's address from the ATM's. For IPv4 the
+// modem sits one below the ATM (10.20.1.10 → 10.20.1.9; a .0 ATM borrows
+// from the third octet), and 172.x ATMs are reached through the modem
+// itself. For IPv6 the modem is likewise the address one below, within the
+// ATM's /64. Hostnames are returned unchanged; derive from the resolved
+// address instead.
 func GetModemIP(ip string) string {
-	if strings.HasPrefix(ip, "172.") {
+	addr, err := ParseAddress(ip)
+	if err != nil {
 		return ip
 	}
+	addr = addr.Unmap()
 
-	parts := strings.Split(ip, ".")
-	if len(parts) != 4 {
-		return ip
+	if addr.Is6() {
+		// Contains never matches a zoned address, so compare without it
+		prefix, _ := addr.Prefix(64)
+		if prev := addr.Prev(); prev.IsValid() && prefix.Contains(prev.WithZone("")) {
+			return prev.String()
+		}
+		return addr.String()
 	}
 
-	last := atoi(parts[3])
-	third := atoi(parts[2])
-
-	if last > 0 {
-		parts[3] = itoa(last - 1)
-	} else if third > 0 {
-		parts[2] = itoa(third - 1)
-		parts[3] = "0"
+	b := addr.As4()
+	switch {
+	case b[0] == 172:
+	case b[3] > 0:
+		b[3]--
+	case b[2] > 0:
+		b[2]--
+		b[3] = 0
 	}
-	return strings.Join(parts, ".")
+	return netip.AddrFrom4(b).String()
 }
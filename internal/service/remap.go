@@ -0,0 +1,87 @@
+package service
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// SubnetMap moves addresses from one prefix to another of the same size,
+// keeping the host part: with 10.20.0.0/16=10.40.0.0/16, 10.20.3.7 becomes
+// 10.40.3.7
+type SubnetMap struct {
+	From netip.Prefix
+	To   netip.Prefix
+}
+
+// ParseSubnetMap parses OLD=NEW, where both are CIDR prefixes of the same
+// family and length
+func ParseSubnetMap(s string) (SubnetMap, error) {
+	from, to, ok := strings.Cut(s, "=")
+	if !ok {
+		return SubnetMap{}, fmt.Errorf("invalid mapping %q, expected OLD=NEW such as 10.20.0.0/16=10.40.0.0/16", s)
+	}
+
+	var m SubnetMap
+	var err error
+	if m.From, err = netip.ParsePrefix(strings.TrimSpace(from)); err != nil {
+		return SubnetMap{}, fmt.Errorf("invalid mapping %q: %w", s, err)
+	}
+	if m.To, err = netip.ParsePrefix(strings.TrimSpace(to)); err != nil {
+		return SubnetMap{}, fmt.Errorf("invalid mapping %q: %w", s, err)
+	}
+	if m.From.Addr().Is4() != m.To.Addr().Is4() || m.From.Bits() != m.To.Bits() {
+		return SubnetMap{}, fmt.Errorf("invalid mapping %q: both sides must be the same size", s)
+	}
+
+	m.From, m.To = m.From.Masked(), m.To.Masked()
+	return m, nil
+}
+
+// Contains reports whether ip falls in the prefix being moved
+func (m SubnetMap) Contains(ip string) bool {
+	addr, err := ParseAddress(ip)
+	return err == nil && m.From.Contains(addr)
+}
+
+// Apply returns ip moved into the new prefix, or ip unchanged and false if
+// it is not in the old one
+func (m SubnetMap) Apply(ip string) (string, bool) {
+	addr, err := ParseAddress(ip)
+	if err != nil || !m.From.Contains(addr) {
+		return ip, false
+	}
+
+	host := addr.As16()
+	net := m.To.Addr().As16()
+	bits := m.To.Bits()
+	if addr.Is4() {
+		bits += 96 // IPv4 sits in the last 4 bytes
+	}
+	for i := 0; i < 16; i++ {
+		keep := bits - i*8 // network bits left in this byte
+		switch {
+		case keep >= 8:
+			host[i] = net[i]
+		case keep > 0:
+			mask := byte(0xff << (8 - keep))
+			host[i] = net[i]&mask | host[i]&^mask
+		}
+	}
+
+	moved := netip.AddrFrom16(host)
+	if addr.Is4() {
+		moved = moved.Unmap()
+	}
+	return moved.String(), true
+}
+
+// RemapAddrs applies the first matching mapping to ip
+func RemapAddrs(maps []SubnetMap, ip string) string {
+	for _, m := range maps {
+		if moved, ok := m.Apply(ip); ok {
+			return moved
+		}
+	}
+	return ip
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Site is an ATM joined with its service record and last known status.
+// Either side may be missing: an ATM without a circuit on file, or a
+// circuit no ATM in the inventory points at.
+type Site struct {
+	Machine *Machine
+	Record  *ServiceRecord
+	Status  *StatusRecord
+}
+
+// linkScore rates how surely r is the circuit serving m; 0 means unrelated
+func linkScore(m Machine, r ServiceRecord) int {
+	lan := strings.TrimSpace(r.LANIP)
+	switch {
+	case lan == "":
+	case lan == m.IP:
+		return 4
+	case lan == m.Modem():
+		return 3
+	case sameSubnet(lan, m.IP):
+		return 2
+	}
+
+	if strings.EqualFold(strings.TrimSpace(r.Location), strings.TrimSpace(m.Name)) {
+		return 1
+	}
+	return 0
+}
+
+// sameSubnet reports whether two addresses share a /24 (IPv4) or a /64
+// (IPv6)
+func sameSubnet(a, b string) bool {
+	subnet := subnetOf(a, 24)
+	return subnet != "" && subnet == subnetOf(b, 24)
+}
+
+// LinkSites pairs every ATM with its best matching service record and last
+// status. Stronger links are settled first, so an exact LAN IP match is never
+// lost to a weaker guess; records left over become sites of their own.
+//
+// Records are indexed by LAN IP, subnet and location, so each ATM is only
+// scored against the records that could link to it.
+func LinkSites(machines []Machine, records []ServiceRecord, statuses []StatusRecord) []Site {
+	byName := make(map[string]*StatusRecord, len(statuses))
+	for i := range statuses {
+		byName[strings.ToLower(statuses[i].Name)] = &statuses[i]
+	}
+
+	byLAN := map[string][]int{}
+	bySubnet := map[string][]int{}
+	byLocation := map[string][]int{}
+	for j, r := range records {
+		if lan := strings.TrimSpace(r.LANIP); lan != "" {
+			byLAN[lan] = append(byLAN[lan], j)
+			if subnet := subnetOf(lan, 24); subnet != "" {
+				bySubnet[subnet] = append(bySubnet[subnet], j)
+			}
+		}
+		if loc := strings.ToLower(strings.TrimSpace(r.Location)); loc != "" {
+			byLocation[loc] = append(byLocation[loc], j)
+		}
+	}
+
+	type pair struct{ machine, record, score int }
+	var pairs []pair
+	var candidates []int
+	for i, m := range machines {
+		candidates = append(candidates[:0], byLAN[m.IP]...)
+		candidates = append(candidates, byLAN[m.Modem()]...)
+		if subnet := subnetOf(m.IP, 24); subnet != "" {
+			candidates = append(candidates, bySubnet[subnet]...)
+		}
+		candidates = append(candidates, byLocation[strings.ToLower(strings.TrimSpace(m.Name))]...)
+
+		// in record order, as a scan of every record would pair them
+		slices.Sort(candidates)
+		for _, j := range slices.Compact(candidates) {
+			if score := linkScore(m, records[j]); score > 0 {
+				pairs = append(pairs, pair{i, j, score})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(a, b int) bool { return pairs[a].score > pairs[b].score })
+
+	sites := make([]Site, len(machines), len(machines)+len(records))
+	for i := range machines {
+		sites[i] = Site{Machine: &machines[i], Status: byName[strings.ToLower(machines[i].Name)]}
+	}
+
+	claimed := make([]bool, len(records))
+	for _, p := range pairs {
+		if claimed[p.record] || sites[p.machine].Record != nil {
+			continue
+		}
+		claimed[p.record] = true
+		sites[p.machine].Record = &records[p.record]
+	}
+
+	for j := range records {
+		if !claimed[j] {
+			sites = append(sites, Site{Record: &records[j]})
+		}
+	}
+
+	return sites
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// linked describes sites as "ATM=location", "ATM=-" for an ATM without a
+// circuit and "-=location" for a circuit without an ATM
+func linked(sites []Site) string {
+	var out []string
+	for _, s := range sites {
+		atm, circuit := "-", "-"
+		if s.Machine != nil {
+			atm = s.Machine.Name
+		}
+		if s.Record != nil {
+			circuit = s.Record.Location
+		}
+		out = append(out, atm+"="+circuit)
+	}
+	return strings.Join(out, " ")
+}
+
+func TestLinkSites(t *testing.T) {
+	machines := []Machine{
+		{Name: "Bole", IP: "10.20.1.10"},
+		{Name: "Piassa", IP: "10.20.2.10"},
+		{Name: "Kality", IP: "10.20.3.10"},
+		{Name: "CMC", IP: "cmc.branch"},
+		{Name: "Ayat", IP: "10.20.6.10"},
+		{Name: "Lebu", IP: "fd00:1::10"},
+	}
+	records := []ServiceRecord{
+		{Location: "Bole subnet", LANIP: "10.20.1.50"},      // a weaker guess for Bole
+		{Location: "Bole branch", LANIP: "10.20.1.10"},      // Bole's own LAN IP
+		{Location: "Piassa modem", LANIP: "10.20.2.9"},      // Piassa's modem
+		{Location: "kality ", LANIP: ""},                    // Kality by name only
+		{Location: "CMC", LANIP: " cmc.branch "},            // a hostname, matched as given
+		{Location: "Megenagna", LANIP: "10.20.9.10"},        // no ATM
+		{Location: "Lebu", LANIP: "[fd00:1::99]"},           // same /64
+		{Location: "Ayat second line", LANIP: "10.20.6.10"}, // Ayat already claimed by an earlier record
+		{Location: "Ayat", LANIP: "10.20.6.10"},
+	}
+	statuses := []StatusRecord{{Name: "BOLE", Status: "Online"}, {Name: "Gone", Status: "Offline"}}
+
+	sites := LinkSites(machines, records, statuses)
+	want := "Bole=Bole branch Piassa=Piassa modem Kality=kality  CMC=CMC Ayat=Ayat second line Lebu=Lebu " +
+		"-=Bole subnet -=Megenagna -=Ayat"
+	if got := linked(sites); got != want {
+		t.Errorf("sites\n got %s\nwant %s", got, want)
+	}
+
+	if st := sites[0].Status; st == nil || st.Status != "Online" {
+		t.Errorf("Bole's status = %+v, want its record matched regardless of case", st)
+	}
+	for _, s := range sites[1:] {
+		if s.Status != nil {
+			t.Errorf("%s got status %+v", linked([]Site{s}), s.Status)
+		}
+	}
+}
+
+func TestLinkSitesWeakerLinkYields(t *testing.T) {
+	// Bole comes first and its subnet guess could take the record, but
+	// Ayat's exact LAN IP is settled before it
+	machines := []Machine{{Name: "Bole", IP: "10.20.1.10"}, {Name: "Ayat", IP: "10.20.1.20"}}
+	records := []ServiceRecord{{Location: "Ayat", LANIP: "10.20.1.20"}}
+
+	if got := linked(LinkSites(machines, records, nil)); got != "Bole=- Ayat=Ayat" {
+		t.Errorf("sites = %s", got)
+	}
+}
+
+// linkSitesByScan is LinkSites scoring every ATM against every record
+func linkSitesByScan(machines []Machine, records []ServiceRecord) []Site {
+	type pair struct{ machine, record, score int }
+	var pairs []pair
+	for i, m := range machines {
+		for j, r := range records {
+			if score := linkScore(m, r); score > 0 {
+				pairs = append(pairs, pair{i, j, score})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(a, b int) bool { return pairs[a].score > pairs[b].score })
+
+	sites := make([]Site, len(machines))
+	for i := range machines {
+		sites[i] = Site{Machine: &machines[i]}
+	}
+	claimed := make([]bool, len(records))
+	for _, p := range pairs {
+		if !claimed[p.record] && sites[p.machine].Record == nil {
+			claimed[p.record] = true
+			sites[p.machine].Record = &records[p.record]
+		}
+	}
+	for j := range records {
+		if !claimed[j] {
+			sites = append(sites, Site{Record: &records[j]})
+		}
+	}
+	return sites
+}
+
+func TestLinkSitesMatchesScan(t *testing.T) {
+	// a fleet dense with competing links: shared subnets, modems, repeated
+	// LAN IPs and names
+	var machines []Machine
+	var records []ServiceRecord
+	for i := range 300 {
+		machines = append(machines, Machine{Name: fmt.Sprintf("ATM%d", i%250), IP: fmt.Sprintf("10.%d.%d.%d", i%3, i%40, 10+i%7)})
+	}
+	for j := range 400 {
+		r := ServiceRecord{Location: fmt.Sprintf("atm%d", (j*7)%330)}
+		switch j % 4 {
+		case 0:
+			r.LANIP = fmt.Sprintf("10.%d.%d.%d", j%3, j%40, 10+j%7)
+		case 1:
+			r.LANIP = fmt.Sprintf("10.%d.%d.%d", j%3, j%40, 9+j%7) // a modem
+		case 2:
+			r.LANIP = fmt.Sprintf("10.%d.%d.200", j%3, j%45) // the subnet only
+		}
+		records = append(records, r)
+	}
+
+	sites := LinkSites(machines, records, nil)
+	var paired int
+	for _, s := range sites {
+		if s.Machine != nil && s.Record != nil {
+			paired++
+		}
+	}
+	if paired < 200 {
+		t.Errorf("only %d of %d ATMs linked; the fleet does not exercise the index", paired, len(machines))
+	}
+
+	got, want := linked(sites), linked(linkSitesByScan(machines, records))
+	if got != want {
+		t.Errorf("indexed linking differs from a full scan\n got %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+)
+
+// StatusRule is one row of the status decision table. It holds when every
+// role in Up has a link that answers and no link of a role in Down does;
+// an ATM without links of a role counts that role as down. A rule with
+// neither is a catch-all.
+type StatusRule struct {
+	Status string `json:"status"`
+	Up     []Role `json:"up,omitempty"`
+	Down   []Role `json:"down,omitempty"`
+}
+
+// DefaultStatusRules is the decision table used when the config has none
+var DefaultStatusRules = []StatusRule{
+	{Status: "Online", Up: []Role{RolePrimary}},
+	{Status: "OnBackup", Up: []Role{RoleBackup}},
+	{Status: "OnlyADSL", Up: []Role{RoleModem}},
+	{Status: "Offline"},
+}
+
+// ValidateStatusRules checks the roles of a decision table
+func ValidateStatusRules(rules []StatusRule) error {
+	for i, r := range rules {
+		if r.Status == "" {
+			return fmt.Errorf("status rule %d has no status", i+1)
+		}
+		for _, role := range append(slices.Clone(r.Up), r.Down...) {
+			if _, err := ParseRole(string(role)); err != nil {
+				return fmt.Errorf("status rule %s: %w", r.Status, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Classify returns the status of the first rule that holds for m, or
+// Offline if none does. Links are probed only when a rule asks about their
+// role, so an ATM whose primary link answers costs one ping. Hostnames are
+// looked up with resolve, nil meaning DefaultResolver, and probe is given
+// the addresses; if none of them resolve the status is StatusUnresolved.
+func Classify(m Machine, rules []StatusRule, resolve func(address string) (netip.Addr, error), probe func(ip string) bool) string {
+	if resolve == nil {
+		resolve = DefaultResolver.Resolve
+	}
+	// the modem is derived from the resolved primary, so hostnames get one too
+	primary, perr := resolve(m.IP)
+	links := append([]Link{{Name: string(RolePrimary), Role: RolePrimary, Address: m.IP}}, m.Links...)
+	if !m.hasRole(RoleModem) && perr == nil {
+		links = append(links, Link{Name: string(RoleModem), Role: RoleModem, Address: GetModemIP(primary.String())})
+	}
+
+	resolvedAny := false
+	up := map[Role]bool{}
+	probed := map[Role]bool{}
+	isUp := func(role Role) bool {
+		if probed[role] {
+			return up[role]
+		}
+		probed[role] = true
+		for i, l := range links {
+			if l.Role != role {
+				continue
+			}
+			addr, err := primary, perr
+			if i > 0 {
+				addr, err = resolve(l.Address)
+			}
+			if err != nil {
+				continue
+			}
+			resolvedAny = true
+			if probe(addr.String()) {
+				up[role] = true
+				break
+			}
+		}
+		return up[role]
+	}
+
+	status := "Offline"
+	for _, r := range rules {
+		if holds(r, isUp) {
+			status = r.Status
+			break
+		}
+	}
+
+	if !resolvedAny {
+		// resolve the links no rule asked about before blaming DNS
+		for i, l := range links {
+			if i == 0 {
+				resolvedAny = perr == nil
+			} else if _, err := resolve(l.Address); err == nil {
+				resolvedAny = true
+			}
+			if resolvedAny {
+				break
+			}
+		}
+		if !resolvedAny {
+			slog.Debug("classified", "atm", m.Name, "status", StatusUnresolved)
+			return StatusUnresolved
+		}
+	}
+	slog.Debug("classified", "atm", m.Name, "status", status, "up", up)
+	return status
+}
+
+func holds(r StatusRule, isUp func(Role) bool) bool {
+	for _, role := range r.Up {
+		if !isUp(role) {
+			return false
+		}
+	}
+	for _, role := range r.Down {
+		if isUp(role) {
+			return false
+		}
+	}
+	return true
+}
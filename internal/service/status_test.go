@@ -0,0 +1,155 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+// pinger answers for the IPs listed as up and records what was pinged
+type pinger struct {
+	up     map[string]bool
+	probed []string
+}
+
+func newPinger(up ...string) *pinger {
+	p := &pinger{up: map[string]bool{}}
+	for _, ip := range up {
+		p.up[ip] = true
+	}
+	return p
+}
+
+func (p *pinger) probe(ip string) bool {
+	p.probed = append(p.probed, ip)
+	return p.up[ip]
+}
+
+// bole has a 4G backup; its modem is derived, 10.20.1.9
+var bole = Machine{Name: "Bole", IP: "10.20.1.10", Links: []Link{{Name: "4g", Role: RoleBackup, Address: "10.50.1.10"}}}
+
+func TestClassifyDefaultRules(t *testing.T) {
+	for _, c := range []struct {
+		m      Machine
+		up     []string
+		want   string
+		probed string
+	}{
+		// one ping when the primary answers
+		{bole, []string{"10.20.1.10", "10.50.1.10"}, "Online", "10.20.1.10"},
+		{bole, []string{"10.50.1.10", "10.20.1.9"}, "OnBackup", "10.20.1.10 10.50.1.10"},
+		{bole, []string{"10.20.1.9"}, "OnlyADSL", "10.20.1.10 10.50.1.10 10.20.1.9"},
+		{bole, nil, "Offline", "10.20.1.10 10.50.1.10 10.20.1.9"},
+
+		// without a backup link the backup role is down, unpinged
+		{Machine{Name: "Piassa", IP: "10.20.2.10"}, []string{"10.20.2.9"}, "OnlyADSL", "10.20.2.10 10.20.2.9"},
+
+		// a listed modem replaces the derived one
+		{
+			Machine{Name: "Kality", IP: "10.20.3.10", Links: []Link{{Name: "adsl", Role: RoleModem, Address: "10.60.3.1"}}},
+			[]string{"10.60.3.1", "10.20.3.9"}, "OnlyADSL", "10.20.3.10 10.60.3.1",
+		},
+
+		// any link of a role answering is enough, tried in order
+		{
+			Machine{Name: "CMC", IP: "10.20.4.10", Links: []Link{
+				{Name: "4g", Role: RoleBackup, Address: "10.50.4.10"},
+				{Name: "vsat", Role: RoleBackup, Address: "10.70.4.10"},
+			}},
+			[]string{"10.70.4.10"}, "OnBackup", "10.20.4.10 10.50.4.10 10.70.4.10",
+		},
+	} {
+		p := newPinger(c.up...)
+		if got := Classify(c.m, DefaultStatusRules, nil, p.probe); got != c.want {
+			t.Errorf("%s with %v up is %s, want %s", c.m.Name, c.up, got, c.want)
+		}
+		if got := strings.Join(p.probed, " "); got != c.probed {
+			t.Errorf("%s with %v up probed %q, want %q", c.m.Name, c.up, got, c.probed)
+		}
+	}
+}
+
+func TestClassifyCustomRules(t *testing.T) {
+	// a bank that tells apart a dead primary with both fallbacks working
+	rules := []StatusRule{
+		{Status: "Online", Up: []Role{RolePrimary}},
+		{Status: "Degraded", Up: []Role{RoleBackup, RoleModem}},
+		{Status: "OnBackup", Up: []Role{RoleBackup}, Down: []Role{RoleModem}},
+		{Status: "ModemOnly", Up: []Role{RoleModem}},
+		{Status: "Dark"},
+	}
+	for _, c := range []struct {
+		up   []string
+		want string
+	}{
+		{[]string{"10.20.1.10"}, "Online"},
+		{[]string{"10.50.1.10", "10.20.1.9"}, "Degraded"},
+		{[]string{"10.50.1.10"}, "OnBackup"},
+		{[]string{"10.20.1.9"}, "ModemOnly"},
+		{nil, "Dark"},
+	} {
+		if got := Classify(bole, rules, nil, newPinger(c.up...).probe); got != c.want {
+			t.Errorf("with %v up Bole is %s, want %s", c.up, got, c.want)
+		}
+	}
+}
+
+func TestClassifyRuleOrder(t *testing.T) {
+	up := newPinger("10.20.1.10", "10.50.1.10")
+
+	// the first rule that holds wins, even a catch-all
+	rules := []StatusRule{{Status: "Unknown"}, {Status: "Online", Up: []Role{RolePrimary}}}
+	if got := Classify(bole, rules, nil, up.probe); got != "Unknown" {
+		t.Errorf("catch-all first gives %s", got)
+	}
+	if len(up.probed) != 0 {
+		t.Errorf("probed %v although no rule asked", up.probed)
+	}
+
+	// Down rules out a status while another role answers
+	rules = []StatusRule{
+		{Status: "PrimaryOnly", Up: []Role{RolePrimary}, Down: []Role{RoleBackup}},
+		{Status: "Online", Up: []Role{RolePrimary}},
+	}
+	if got := Classify(bole, rules, nil, up.probe); got != "Online" {
+		t.Errorf("with the backup up Bole is %s, want Online", got)
+	}
+	if got := Classify(bole, rules, nil, newPinger("10.20.1.10").probe); got != "PrimaryOnly" {
+		t.Errorf("with the backup down Bole is %s, want PrimaryOnly", got)
+	}
+
+	// no rule holding is Offline
+	rules = []StatusRule{{Status: "Online", Up: []Role{RolePrimary}}}
+	if got := Classify(bole, rules, nil, newPinger().probe); got != "Offline" {
+		t.Errorf("with no rule holding Bole is %s, want Offline", got)
+	}
+
+	// each role is probed once however many rules ask about it
+	p := newPinger()
+	Classify(bole, []StatusRule{
+		{Status: "A", Up: []Role{RoleBackup}},
+		{Status: "B", Up: []Role{RoleBackup, RoleModem}},
+		{Status: "C", Down: []Role{RoleBackup}, Up: []Role{RolePrimary}},
+	}, nil, p.probe)
+	if got := strings.Join(p.probed, " "); got != "10.50.1.10 10.20.1.10" {
+		t.Errorf("probed %q, want each needed link once", got)
+	}
+}
+
+func TestValidateStatusRules(t *testing.T) {
+	if err := ValidateStatusRules(DefaultStatusRules); err != nil {
+		t.Errorf("default rules: %v", err)
+	}
+	for _, c := range []struct {
+		rules []StatusRule
+		want  string
+	}{
+		{[]StatusRule{{Status: "Online", Up: []Role{"Primary"}}, {}}, "status rule 2 has no status"},
+		{[]StatusRule{{Status: "Online", Up: []Role{"wifi"}}}, `status rule Online: unknown link role "wifi"`},
+		{[]StatusRule{{Status: "Dark", Down: []Role{"satellite"}}}, `unknown link role "satellite"`},
+	} {
+		err := ValidateStatusRules(c.rules)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("ValidateStatusRules(%+v) = %v, want %q", c.rules, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fahmaliyi/atmer/internal/storage"
+)
+
+// MaxVersions is how many versions are kept; older snapshots are pruned
+const MaxVersions = 100
+
+// File is the content one data file had before a change
+type File struct {
+	Path     string `json:"path"`     // absolute path of the data file
+	Snapshot string `json:"snapshot"` // copy inside the snapshot dir; empty if the file did not exist
+}
+
+// Version is one change to the data files, with what they held before it
+type Version struct {
+	ID      int       `json:"id"`
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Command string    `json:"command"`
+	Summary string    `json:"summary"`
+	Files   []File    `json:"files"`
+}
+
+// Store keeps snapshots of data files in a directory, indexed by a
+// versions.json manifest
+type Store struct {
+	dir      string
+	versions *storage.Storage[Version]
+}
+
+// Open returns the snapshot store kept in dir
+func Open(dir string) *Store {
+	return &Store{dir: dir, versions: storage.New[Version](filepath.Join(dir, "versions.json"))}
+}
+
+// Take copies files as they are now, before a change described by summary
+func (s *Store) Take(user, command, summary string, files ...string) (Version, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return Version{}, fmt.Errorf("failed to create snapshot dir: %w", err)
+	}
+
+	var taken Version
+	err := s.versions.Modify(func(versions []Version) ([]Version, error) {
+		v := Version{ID: 1, Time: time.Now(), User: user, Command: command, Summary: summary}
+		if n := len(versions); n > 0 {
+			v.ID = versions[n-1].ID + 1
+		}
+
+		for i, path := range files {
+			f, err := s.copyIn(v.ID, i, path)
+			if err != nil {
+				s.remove(v)
+				return nil, err
+			}
+			v.Files = append(v.Files, f)
+		}
+
+		versions = append(versions, v)
+		for len(versions) > MaxVersions {
+			s.remove(versions[0])
+			versions = versions[1:]
+		}
+
+		taken = v
+		return versions, nil
+	})
+	return taken, err
+}
+
+// Discard drops a version whose change did not go through
+func (s *Store) Discard(v Version) error {
+	return s.versions.Modify(func(versions []Version) ([]Version, error) {
+		kept := versions[:0]
+		for _, x := range versions {
+			if x.ID != v.ID {
+				kept = append(kept, x)
+			}
+		}
+		s.remove(v)
+		return kept, nil
+	})
+}
+
+// Rollback puts the files of a version back as they were before its change
+// and drops it, for a change that failed part way. Like Take, it must be
+// called holding the storage locks of the files, so that nobody sees them
+// between the change and its rollback.
+func (s *Store) Rollback(v Version) error {
+	for _, f := range v.Files {
+		if err := s.copyOut(f); err != nil {
+			return err
+		}
+	}
+	return s.Discard(v)
+}
+
+// List returns the versions, oldest first
+func (s *Store) List() ([]Version, error) {
+	versions, err := s.versions.Load()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return versions, err
+}
+
+// Undo puts the files of the latest version back as they were before its
+// change and forgets the version
+func (s *Store) Undo() (Version, error) {
+	for {
+		versions, err := s.List()
+		if err != nil {
+			return Version{}, err
+		}
+		if len(versions) == 0 {
+			return Version{}, fmt.Errorf("nothing to undo")
+		}
+		v := versions[len(versions)-1]
+
+		unlock, err := lockFiles(v.Files)
+		if err != nil {
+			return Version{}, err
+		}
+		err = s.versions.Modify(func(versions []Version) ([]Version, error) {
+			// a change may have come in before the files were locked
+			if len(versions) == 0 || versions[len(versions)-1].ID != v.ID {
+				return nil, errMoved
+			}
+			for _, f := range v.Files {
+				if err := s.copyOut(f); err != nil {
+					return nil, err
+				}
+			}
+			s.remove(v)
+			return versions[:len(versions)-1], nil
+		})
+		unlock()
+
+		if !errors.Is(err, errMoved) {
+			return v, err
+		}
+	}
+}
+
+// errMoved has Undo try again when the latest version changed under it
+var errMoved = errors.New("versions changed")
+
+// PlanVersion lists, for each file changed after version id, the content it
+// had right after it. Version 0 is before the first change.
+func (s *Store) PlanVersion(id int) ([]File, error) {
+	versions, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	// the oldest kept snapshot holds the files as of the version before it
+	if len(versions) > 0 && id < versions[0].ID-1 {
+		return nil, fmt.Errorf("version %d is older than the kept history; the oldest version that can be restored is %d", id, versions[0].ID-1)
+	}
+	return plan(versions, func(v Version) bool { return v.ID <= id }), nil
+}
+
+// PlanTime lists, for each file changed after t, the content it had at t
+func (s *Store) PlanTime(t time.Time) ([]File, error) {
+	versions, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	// before the oldest kept version, older ones may have been pruned
+	if len(versions) > 0 && versions[0].ID > 1 && t.Before(versions[0].Time) {
+		return nil, fmt.Errorf("%s is older than the kept history, which starts at %s", t.Local().Format("2006-01-02 15:04"), versions[0].Time.Local().Format("2006-01-02 15:04:05"))
+	}
+	return plan(versions, func(v Version) bool { return !v.Time.After(t) }), nil
+}
+
+// plan lists, for each file changed after the cut, the content it had at
+// the cut. included reports whether a version is at or before the cut.
+func plan(versions []Version, included func(Version) bool) []File {
+	seen := map[string]bool{}
+	var plan []File
+	for _, v := range versions {
+		if included(v) {
+			continue
+		}
+		// the first change after the cut holds the file as it was at the cut
+		for _, f := range v.Files {
+			if !seen[f.Path] {
+				seen[f.Path] = true
+				plan = append(plan, f)
+			}
+		}
+	}
+
+	sort.Slice(plan, func(i, j int) bool { return plan[i].Path < plan[j].Path })
+	return plan
+}
+
+// Restore writes back the file contents of a plan. The files are locked
+// and their current contents taken as a new version first, so the restore
+// itself can be undone; if it fails part way they are put back.
+func (s *Store) Restore(plan []File, user, command, summary string) (Version, error) {
+	unlock, err := lockFiles(plan)
+	if err != nil {
+		return Version{}, err
+	}
+	defer unlock()
+
+	// read the plan first: taking the new version may prune its snapshots
+	contents := make([][]byte, len(plan))
+	paths := make([]string, len(plan))
+	for i, f := range plan {
+		if contents[i], err = s.read(f); err != nil {
+			return Version{}, err
+		}
+		paths[i] = f.Path
+	}
+	v, err := s.Take(user, command, summary, paths...)
+	if err != nil {
+		return Version{}, err
+	}
+
+	for i, f := range plan {
+		if err := write(f.Path, contents[i]); err != nil {
+			for _, b := range v.Files {
+				s.copyOut(b)
+			}
+			s.Discard(v)
+			return Version{}, err
+		}
+	}
+	return v, nil
+}
+
+// lockFiles takes the storage locks of the files, see storage.LockAll.
+// Data files are always locked before the versions manifest, as a change
+// holding its file's lock takes its snapshot.
+func lockFiles(files []File) (func(), error) {
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	return storage.LockAll(paths...)
+}
+
+// copyIn saves the current content of path as file n of version id
+func (s *Store) copyIn(id, n int, path string) (File, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return File{}, err
+	}
+
+	data, err := os.ReadFile(abs)
+	if os.IsNotExist(err) {
+		return File{Path: abs}, nil
+	}
+	if err != nil {
+		return File{}, fmt.Errorf("failed to snapshot %s: %w", path, err)
+	}
+
+	name := fmt.Sprintf("%d-%d-%s", id, n, filepath.Base(abs))
+	if err := os.WriteFile(filepath.Join(s.dir, name), data, 0644); err != nil {
+		return File{}, fmt.Errorf("failed to snapshot %s: %w", path, err)
+	}
+	return File{Path: abs, Snapshot: name}, nil
+}
+
+// copyOut puts a snapshot back in place, removing files that did not
+// exist; callers must hold the file's lock
+func (s *Store) copyOut(f File) error {
+	data, err := s.read(f)
+	if err != nil {
+		return err
+	}
+	return write(f.Path, data)
+}
+
+// read returns the content of a snapshot, nil if the file did not exist
+func (s *Store) read(f File) ([]byte, error) {
+	if f.Snapshot == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, f.Snapshot))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot of %s: %w", f.Path, err)
+	}
+	return data, nil
+}
+
+// write replaces the file at path with data through a temporary file, or
+// removes it when data is nil
+func write(path string, data []byte) error {
+	if data == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to restore %s: %w", path, err)
+		}
+		return nil
+	}
+
+	tmp := path + ".restore"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to restore %s: %w", path, err)
+	}
+	return nil
+}
+
+// remove deletes the snapshot copies of a version
+func (s *Store) remove(v Version) {
+	for _, f := range v.Files {
+		if f.Snapshot != "" {
+			os.Remove(filepath.Join(s.dir, f.Snapshot))
+		}
+	}
+}
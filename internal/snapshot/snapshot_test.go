@@ -0,0 +1,239 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fahmaliyi/atmer/internal/storage"
+)
+
+// change snapshots path and then writes content to it, as a command does
+func change(t *testing.T, s *Store, path, content string) Version {
+	t.Helper()
+	v, err := s.Take("tester", "atmer test", "set "+content, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func assertContent(t *testing.T, path, want string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("%s = %q, want %q", filepath.Base(path), data, want)
+	}
+}
+
+// assertNoLocks fails if a lock or half-restored file is left in dir
+func assertNoLocks(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".lock") || strings.HasSuffix(e.Name(), ".restore") {
+			t.Errorf("left behind: %s", e.Name())
+		}
+	}
+}
+
+func TestUndo(t *testing.T) {
+	dir := t.TempDir()
+	s := Open(filepath.Join(dir, "snapshots"))
+	path := filepath.Join(dir, "services.json")
+
+	change(t, s, path, "one")
+	change(t, s, path, "two")
+
+	v, err := s.Undo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.ID != 2 {
+		t.Errorf("undid version %d, want 2", v.ID)
+	}
+	assertContent(t, path, "one")
+
+	// the first change created the file, so undoing it removes it
+	if _, err := s.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file still there after undoing its creation: %v", err)
+	}
+	if _, err := s.Undo(); err == nil {
+		t.Error("Undo with no versions returned no error")
+	}
+	assertNoLocks(t, dir)
+}
+
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	s := Open(filepath.Join(dir, "snapshots"))
+	atms := filepath.Join(dir, "atms.xlsx")
+	services := filepath.Join(dir, "services.json")
+
+	change(t, s, atms, "a1")
+	change(t, s, services, "s1")
+	change(t, s, atms, "a2")
+	change(t, s, services, "s2")
+
+	plan, err := s.PlanVersion(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 2 {
+		t.Fatalf("plan has %d files, want 2", len(plan))
+	}
+	v, err := s.Restore(plan, "tester", "atmer restore", "Restored to version 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContent(t, atms, "a1")
+	assertContent(t, services, "s1")
+
+	// the restore is a version of its own
+	if v.ID != 5 {
+		t.Errorf("restore recorded as version %d, want 5", v.ID)
+	}
+	if _, err := s.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	assertContent(t, atms, "a2")
+	assertContent(t, services, "s2")
+	assertNoLocks(t, dir)
+}
+
+func TestPlanBeforeHistory(t *testing.T) {
+	dir := t.TempDir()
+	s := Open(filepath.Join(dir, "snapshots"))
+	path := filepath.Join(dir, "services.json")
+
+	start := time.Now().Add(-time.Second)
+	for i := range MaxVersions + 5 {
+		change(t, s, path, strings.Repeat("x", i+1))
+	}
+	versions, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != MaxVersions || versions[0].ID != 6 {
+		t.Fatalf("kept %d versions from %d, want %d from 6", len(versions), versions[0].ID, MaxVersions)
+	}
+
+	if _, err := s.PlanVersion(3); err == nil || !strings.Contains(err.Error(), "oldest version that can be restored is 5") {
+		t.Errorf("PlanVersion(3) error = %v, want one naming version 5", err)
+	}
+	if _, err := s.PlanTime(start); err == nil || !strings.Contains(err.Error(), "older than the kept history") {
+		t.Errorf("PlanTime before the history error = %v", err)
+	}
+
+	// version 5 is what the oldest snapshot holds, so it can still be had
+	plan, err := s.PlanVersion(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Restore(plan, "tester", "atmer restore", "Restored to version 5"); err != nil {
+		t.Fatal(err)
+	}
+	assertContent(t, path, "xxxxx")
+}
+
+func TestPlanWithFullHistory(t *testing.T) {
+	dir := t.TempDir()
+	s := Open(filepath.Join(dir, "snapshots"))
+	path := filepath.Join(dir, "services.json")
+	change(t, s, path, "one")
+
+	// nothing was pruned, so any earlier time means before the first change
+	plan, err := s.PlanTime(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 1 || plan[0].Snapshot != "" {
+		t.Errorf("plan = %+v, want the file removed", plan)
+	}
+}
+
+func TestUndoWaitsForWriter(t *testing.T) {
+	dir := t.TempDir()
+	s := Open(filepath.Join(dir, "snapshots"))
+	path := filepath.Join(dir, "services.json")
+	change(t, s, path, "one")
+	change(t, s, path, "two")
+
+	// a writer holding the file's lock keeps the undo from writing under it
+	unlock, err := storage.Lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := s.Undo(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	assertContent(t, path, "two")
+	os.WriteFile(path, []byte("written under the lock"), 0644)
+	unlock()
+
+	wg.Wait()
+	assertContent(t, path, "one")
+	assertNoLocks(t, dir)
+}
+
+func TestRollbackUnderLocks(t *testing.T) {
+	dir := t.TempDir()
+	s := Open(filepath.Join(dir, "snapshots"))
+	atms := filepath.Join(dir, "atms.xlsx")
+	services := filepath.Join(dir, "services.json")
+	os.WriteFile(atms, []byte("atms"), 0644)
+	os.WriteFile(services, []byte("services"), 0644)
+
+	// a change to both files whose second write fails is rolled back by
+	// its writer while it still holds the locks
+	unlock, err := storage.LockAll(services, atms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := s.Take("tester", "atmer bulk", "change both", atms, services)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(atms, []byte("half done"), 0644)
+
+	done := make(chan error, 1)
+	go func() { done <- s.Rollback(v) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Rollback waited for the locks its caller holds")
+	}
+	unlock()
+
+	assertContent(t, atms, "atms")
+	assertContent(t, services, "services")
+	if versions, _ := s.List(); len(versions) != 0 {
+		t.Errorf("%d version(s) kept after the rollback", len(versions))
+	}
+	assertNoLocks(t, dir)
+}
@@ -0,0 +1,15 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package storage
+
+import "os"
+
+// No advisory locking on this platform; the in-process mutex still applies.
+func lockFile(f *os.File, exclusive bool) error { return nil }
+
+func unlockFile(f *os.File) error { return nil }
+
+func releaseFile(f *os.File, path string) {
+	f.Close()
+	os.Remove(path)
+}
@@ -0,0 +1,35 @@
+//go:build windows
+
+package storage
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lock the whole file, whatever its size
+const allBytes = ^uint32(0)
+
+func lockFile(f *os.File, exclusive bool) error {
+	var flags uint32
+	if exclusive {
+		flags = windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+	ol := new(windows.Overlapped)
+	return windows.LockFileEx(windows.Handle(f.Fd()), flags, 0, allBytes, allBytes, ol)
+}
+
+func unlockFile(f *os.File) error {
+	ol := new(windows.Overlapped)
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, allBytes, allBytes, ol)
+}
+
+// releaseFile unlocks and closes the lock file at path, then removes it.
+// Windows refuses to remove a file another process has open, so the file
+// stays while anyone waits on it.
+func releaseFile(f *os.File, path string) {
+	unlockFile(f)
+	f.Close()
+	os.Remove(path)
+}
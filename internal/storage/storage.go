@@ -1,16 +1,70 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 )
 
-// Generic storage type that manages JSON file reads/writes
+// Generic storage type that manages JSON file reads/writes.
+//
+// Every operation holds an in-process mutex and an advisory lock on a
+// sidecar "<file>.lock", so both goroutines and separate atmer processes
+// see each read-modify-write cycle as a single step.
+//
+// Reads are served from an in-memory cache that is rebuilt whenever the
+// file's modification time or size changes, together with the primary key
+// and any secondary indexes registered through SetKey and AddIndex.
+//
+// A storage with a schema version set through SetVersion wraps its records
+// in a {"version": n, "records": [...]} header and refuses to read files
+// written in any other version; those must be converted with Migrate.
 type Storage[T any] struct {
 	filePath string
 	mu       sync.Mutex
+	version  int
+
+	key     func(T) string
+	indexes map[string]func(T) string
+	cache   *cache[T]
+}
+
+// cache holds the parsed file and its indexes as of one modification
+type cache[T any] struct {
+	modTime time.Time
+	size    int64
+	records []T
+	byKey   map[string][]int
+	byIndex map[string]map[string][]int
+}
+
+// envelope is the on-disk layout of versioned files
+type envelope[T any] struct {
+	Version int `json:"version"`
+	Records []T `json:"records"`
+}
+
+// LegacyVersion is the version reported for files that are a bare JSON
+// array without a version header
+const LegacyVersion = 1
+
+// VersionError reports a file written in a schema version other than the
+// one the storage expects
+type VersionError struct {
+	Path  string
+	Found int
+	Want  int
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("%s uses schema version %d, expected %d", e.Path, e.Found, e.Want)
 }
 
 // New creates a new storage bound to a file path
@@ -18,25 +72,141 @@ func New[T any](filePath string) *Storage[T] {
 	return &Storage[T]{filePath: filePath}
 }
 
+// SetVersion sets the schema version written to and required from the file
+func (s *Storage[T]) SetVersion(version int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.version = version
+	s.cache = nil
+}
+
+// SetKey sets the function that yields a record's primary key for Get
+func (s *Storage[T]) SetKey(fn func(T) string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.key = fn
+	s.cache = nil
+}
+
+// AddIndex registers a secondary index queried through Lookup
+func (s *Storage[T]) AddIndex(name string, fn func(T) string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.indexes == nil {
+		s.indexes = make(map[string]func(T) string)
+	}
+	s.indexes[name] = fn
+	s.cache = nil
+}
+
 // Load all records from file
 func (s *Storage[T]) Load() ([]T, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data, err := os.ReadFile(s.filePath)
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	c, err := s.cached()
 	if err != nil {
 		if os.IsNotExist(err) {
 			return []T{}, err // empty if file doesn’t exist yet
 		}
+		return nil, err
+	}
 
-		return nil, fmt.Errorf("failed to read file: %w", err)
+	return append([]T(nil), c.records...), nil
+}
+
+// Get returns the first record whose primary key equals key
+func (s *Storage[T]) Get(key string) (T, bool, error) {
+	var zero T
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.key == nil {
+		return zero, false, fmt.Errorf("no key function set")
 	}
 
-	var records []T
-	if err := json.Unmarshal(data, &records); err != nil {
-		return nil, fmt.Errorf("failed to parse json: %w", err)
+	unlock, err := s.lock(false)
+	if err != nil {
+		return zero, false, err
+	}
+	defer unlock()
+
+	c, err := s.cached()
+	if err != nil {
+		return zero, false, err
+	}
+
+	positions := c.byKey[normalize(key)]
+	if len(positions) == 0 {
+		return zero, false, nil
+	}
+	return c.records[positions[0]], true, nil
+}
+
+// Lookup returns the records whose indexed field equals value
+func (s *Storage[T]) Lookup(index, value string) ([]T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.indexes[index]; !ok {
+		return nil, fmt.Errorf("unknown index: %s", index)
+	}
+
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	c, err := s.cached()
+	if err != nil {
+		return nil, err
 	}
 
+	positions := c.byIndex[index][normalize(value)]
+	records := make([]T, 0, len(positions))
+	for _, i := range positions {
+		records = append(records, c.records[i])
+	}
+	return records, nil
+}
+
+// Find returns the records that satisfy every predicate
+func (s *Storage[T]) Find(preds ...func(T) bool) ([]T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := s.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	c, err := s.cached()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []T
+Records:
+	for _, r := range c.records {
+		for _, pred := range preds {
+			if !pred(r) {
+				continue Records
+			}
+		}
+		records = append(records, r)
+	}
 	return records, nil
 }
 
@@ -45,63 +215,373 @@ func (s *Storage[T]) Save(records []T) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data, err := json.MarshalIndent(records, "", "  ")
+	unlock, err := s.lock(true)
 	if err != nil {
-		return fmt.Errorf("failed to marshal json: %w", err)
+		return err
 	}
+	defer unlock()
 
-	if err := os.WriteFile(s.filePath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+	return s.write(records)
+}
+
+// Modify loads the records, passes them to fn and saves whatever fn returns,
+// all inside one critical section. A missing file is treated as empty.
+// If fn returns an error nothing is written.
+func (s *Storage[T]) Modify(fn func([]T) ([]T, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	return nil
+	return s.modify(fn)
+}
+
+// ModifyLocked is Modify for a caller already holding the file's lock
+// through Lock or LockAll, e.g. to change it together with other files
+func (s *Storage[T]) ModifyLocked(fn func([]T) ([]T, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.modify(fn)
 }
 
-// Add a new record
-func (s *Storage[T]) Add(record T) error {
-	records, err := s.Load()
+// modify is Modify's critical section; callers must hold both locks
+func (s *Storage[T]) modify(fn func([]T) ([]T, error)) error {
+	var records []T
+	c, err := s.cached()
+	switch {
+	case err == nil:
+		records = append([]T(nil), c.records...)
+	case os.IsNotExist(err):
+		records = []T{}
+	default:
+		return err
+	}
+
+	records, err = fn(records)
 	if err != nil {
 		return err
 	}
-	records = append(records, record)
-	return s.Save(records)
+
+	return s.write(records)
 }
 
-// Update record(s) by matcher function
-func (s *Storage[T]) Update(match func(T) bool, updater func(*T)) error {
-	records, err := s.Load()
+// Raw returns the file's contents as they are on disk, read under the
+// shared lock, e.g. to look at a file in an older schema without loading it
+func (s *Storage[T]) Raw() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := s.lock(false)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer unlock()
 
-	updated := false
-	for i := range records {
-		if match(records[i]) {
-			updater(&records[i])
-			updated = true
+	return os.ReadFile(s.filePath)
+}
+
+// Migrate converts the file to the storage's schema version. fn receives the
+// raw file contents and the version they were written in and returns the
+// records to save. It returns the version the file was in; files already at
+// the current version are left untouched.
+func (s *Storage[T]) Migrate(fn func(data []byte, version int) ([]T, error)) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.version == 0 {
+		return 0, fmt.Errorf("no schema version set")
+	}
+
+	unlock, err := s.lock(true)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	from, err := FileVersion(data)
+	if err != nil {
+		return 0, err
+	}
+	if from == s.version {
+		return from, nil
+	}
+
+	records, err := fn(data, from)
+	if err != nil {
+		return from, err
+	}
+
+	return from, s.write(records)
+}
+
+// FileVersion reports the schema version of raw file contents
+func FileVersion(data []byte) (int, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		return LegacyVersion, nil
+	}
+
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0, fmt.Errorf("failed to parse json: %w", err)
+	}
+	if header.Version == 0 {
+		return 0, fmt.Errorf("missing schema version")
+	}
+	return header.Version, nil
+}
+
+// lock takes the cross-process file lock and returns its release function
+func (s *Storage[T]) lock(exclusive bool) (func(), error) {
+	return lockPath(s.filePath, exclusive)
+}
+
+// Lock takes the exclusive cross-process lock a Storage for path uses, so
+// the file can be replaced outside a Storage without racing one, and
+// returns its release function. It must not be called while a Storage of
+// the same process is working on path.
+func Lock(path string) (func(), error) {
+	return lockPath(path, true)
+}
+
+// LockAll takes Lock for every path, in the order of their absolute paths
+// so that concurrent callers cannot deadlock, and returns the release
+// function of them all
+func LockAll(paths ...string) (func(), error) {
+	var abs []string
+	for _, p := range paths {
+		a, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		abs = append(abs, a)
+	}
+	slices.Sort(abs)
+	abs = slices.Compact(abs)
+
+	var unlocks []func()
+	release := func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+	for _, p := range abs {
+		unlock, err := Lock(p)
+		if err != nil {
+			release()
+			return nil, err
 		}
+		unlocks = append(unlocks, unlock)
 	}
+	return release, nil
+}
+
+// lockPath locks the sidecar "<path>.lock". The lock file is removed on
+// release when no other process holds it, so after locking it is checked
+// to still be the file at its path: a lock on a file its previous holder
+// removed excludes nobody.
+func lockPath(filePath string, exclusive bool) (func(), error) {
+	path := filePath + ".lock"
+	start := time.Now()
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open lock file: %w", err)
+		}
+
+		if err := lockFile(f, exclusive); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock file: %w", err)
+		}
 
-	if !updated {
-		return fmt.Errorf("no matching record found")
+		if sameFile(f, path) {
+			slog.Debug("storage locked", "path", filePath, "exclusive", exclusive, "waited", time.Since(start))
+			return func() { releaseFile(f, path) }, nil
+		}
+		unlockFile(f)
+		f.Close()
 	}
+}
 
-	return s.Save(records)
+// sameFile reports whether f is still the file at path
+func sameFile(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pi, err := os.Stat(path)
+	return err == nil && os.SameFile(fi, pi)
 }
 
-// Delete record(s) by matcher function
-func (s *Storage[T]) Delete(match func(T) bool) error {
-	records, err := s.Load()
+// cached returns the cache, re-reading the file if it changed since the
+// last read; callers must hold the lock
+func (s *Storage[T]) cached() (*cache[T], error) {
+	info, err := os.Stat(s.filePath)
 	if err != nil {
-		return err
+		s.cache = nil
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	if c := s.cache; c != nil && c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+		return c, nil
+	}
+
+	start := time.Now()
+	records, err := s.read()
+	if err != nil {
+		s.cache = nil
+		slog.Warn("storage read failed", "path", s.filePath, "err", err)
+		return nil, err
 	}
+	slog.Debug("storage read", "path", s.filePath, "records", len(records), "took", time.Since(start))
 
-	newRecords := make([]T, 0, len(records))
-	for _, r := range records {
-		if !match(r) {
-			newRecords = append(newRecords, r)
+	s.cache = s.build(slices.Clone(records), info)
+	return s.cache, nil
+}
+
+// build indexes records read from a file with the given stat
+func (s *Storage[T]) build(records []T, info os.FileInfo) *cache[T] {
+	c := &cache[T]{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		records: records,
+		byIndex: make(map[string]map[string][]int, len(s.indexes)),
+	}
+
+	if s.key != nil {
+		c.byKey = make(map[string][]int, len(records))
+		for i, r := range records {
+			k := normalize(s.key(r))
+			c.byKey[k] = append(c.byKey[k], i)
 		}
 	}
 
-	return s.Save(newRecords)
+	for name, fn := range s.indexes {
+		idx := make(map[string][]int)
+		for i, r := range records {
+			v := normalize(fn(r))
+			idx[v] = append(idx[v], i)
+		}
+		c.byIndex[name] = idx
+	}
+
+	return c
+}
+
+// read parses the file; callers must hold the lock
+func (s *Storage[T]) read() ([]T, error) {
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	if s.version == 0 {
+		var records []T
+		if err := json.Unmarshal(data, &records); err != nil {
+			return nil, fmt.Errorf("failed to parse json: %w", err)
+		}
+		return records, nil
+	}
+
+	found, err := FileVersion(data)
+	if err != nil {
+		return nil, err
+	}
+	if found != s.version {
+		return nil, &VersionError{Path: s.filePath, Found: found, Want: s.version}
+	}
+
+	var env envelope[T]
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("failed to parse json: %w", err)
+	}
+	return env.Records, nil
+}
+
+// write replaces the file atomically through a temp file and rename;
+// callers must hold the lock
+func (s *Storage[T]) write(records []T) (err error) {
+	start := time.Now()
+	defer func() {
+		if err != nil {
+			slog.Warn("storage write failed", "path", s.filePath, "err", err)
+		} else {
+			slog.Debug("storage written", "path", s.filePath, "records", len(records), "took", time.Since(start))
+		}
+	}()
+
+	var v any = records
+	if s.version > 0 {
+		if records == nil {
+			records = []T{}
+		}
+		v = envelope[T]{Version: s.version, Records: records}
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal json: %w", err)
+	}
+
+	dir, base := filepath.Split(s.filePath)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := os.CreateTemp(dir, base+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.filePath); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	// the caller keeps records and may change them; the cache must not
+	if info, err := os.Stat(s.filePath); err == nil {
+		s.cache = s.build(slices.Clone(records), info)
+	} else {
+		s.cache = nil
+	}
+
+	return nil
+}
+
+// normalize folds index keys so lookups ignore case and padding
+func normalize(v string) string {
+	return strings.ToLower(strings.TrimSpace(v))
 }
@@ -0,0 +1,320 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type record struct {
+	ID string `json:"id"`
+	N  int    `json:"n"`
+}
+
+// childEnv names the file a re-exec'd test binary writes to
+const childEnv = "ATMER_STORAGE_CHILD"
+
+// TestMain lets the test binary act as a second process: with childEnv set
+// it adds records to that file and exits
+func TestMain(m *testing.M) {
+	if path := os.Getenv(childEnv); path != "" {
+		if err := child(path, os.Getenv(childEnv+"_ID")); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+const perWorker = 25
+
+// add appends a record
+func add(s *Storage[record], r record) error {
+	return s.Modify(func(records []record) ([]record, error) {
+		return append(records, r), nil
+	})
+}
+
+// bump increments the counter record
+func bump(s *Storage[record]) error {
+	return s.Modify(func(records []record) ([]record, error) {
+		for i := range records {
+			if records[i].ID == "counter" {
+				records[i].N++
+			}
+		}
+		return records, nil
+	})
+}
+
+func child(path, id string) error {
+	s := New[record](path)
+	for i := range perWorker {
+		if err := add(s, record{ID: fmt.Sprintf("%s-%d", id, i)}); err != nil {
+			return err
+		}
+		if err := bump(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startChildren runs n copies of the test binary adding records to path
+func startChildren(t *testing.T, path string, n int) []*exec.Cmd {
+	t.Helper()
+	var cmds []*exec.Cmd
+	for i := range n {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Env = append(os.Environ(), childEnv+"="+path, childEnv+"_ID=proc"+strconv.Itoa(i))
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds
+}
+
+// assertClean fails if anything but the data file is left in dir
+func assertClean(t *testing.T, dir, data string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() != data {
+			t.Errorf("left behind: %s", e.Name())
+		}
+	}
+}
+
+// assertAll checks that every worker's records and counter increments made
+// it into the file
+func assertAll(t *testing.T, path string, workers []string) {
+	t.Helper()
+	records, err := New[record](path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]int{}
+	counter := -1
+	for _, r := range records {
+		if r.ID == "counter" {
+			counter = r.N
+			continue
+		}
+		seen[r.ID]++
+	}
+	for _, w := range workers {
+		for i := range perWorker {
+			id := fmt.Sprintf("%s-%d", w, i)
+			if seen[id] != 1 {
+				t.Errorf("record %s written %d times, want 1", id, seen[id])
+			}
+		}
+	}
+	if want := len(workers) * perWorker; counter != want {
+		t.Errorf("counter = %d, want %d: updates were lost", counter, want)
+	}
+	if want := len(workers)*perWorker + 1; len(records) != want {
+		t.Errorf("got %d records, want %d", len(records), want)
+	}
+}
+
+func TestConcurrentWriters(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "records.json")
+	if err := New[record](path).Save([]record{{ID: "counter"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	procs := startChildren(t, path, 3)
+
+	// goroutines share one storage, as commands in one process do, and
+	// also use storages of their own, each with its own cache
+	shared := New[record](path)
+	var workers []string
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := range 8 {
+		id := "g" + strconv.Itoa(g)
+		workers = append(workers, id)
+		s := shared
+		if g%2 == 1 {
+			s = New[record](path)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perWorker {
+				err := add(s, record{ID: fmt.Sprintf("%s-%d", id, i)})
+				if err == nil {
+					err = bump(s)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for i, cmd := range procs {
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("child %d: %v", i, err)
+		}
+		workers = append(workers, "proc"+strconv.Itoa(i))
+	}
+
+	assertAll(t, path, workers)
+	assertClean(t, dir, "records.json")
+}
+
+func TestReadersDuringWrites(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "records.json")
+	s := New[record](path)
+	if err := s.Save([]record{{ID: "counter"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	procs := startChildren(t, path, 2)
+	done := make(chan struct{})
+	go func() {
+		for _, cmd := range procs {
+			cmd.Wait()
+		}
+		close(done)
+	}()
+
+	// every read must see a whole file, never a half-written one
+	reader := New[record](path)
+	for {
+		if _, err := reader.Load(); err != nil {
+			t.Fatalf("read during writes: %v", err)
+		}
+		select {
+		case <-done:
+			assertAll(t, path, []string{"proc0", "proc1"})
+			assertClean(t, dir, "records.json")
+			return
+		default:
+		}
+	}
+}
+
+func TestStaleCacheReloaded(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "records.json")
+	s := New[record](path)
+	s.SetKey(func(r record) string { return r.ID })
+	if err := s.Save([]record{{ID: "a"}, {ID: "counter"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := s.Get("a"); !ok || err != nil {
+		t.Fatalf("Get(a) = %v, %v", ok, err)
+	}
+
+	// another process rewrites the file behind the cache
+	for _, cmd := range startChildren(t, path, 1) {
+		if err := cmd.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok, err := s.Get("proc0-0"); !ok || err != nil {
+		t.Errorf("Get(proc0-0) after an external write = %v, %v, want the new record", ok, err)
+	}
+
+	// a plain write by an editor, keeping the modification time
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`[{"id":"edited"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Now(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	records, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].ID != "edited" {
+		t.Errorf("Load after an edit = %+v, want the edited record", records)
+	}
+	assertClean(t, dir, "records.json")
+}
+
+func TestModifyErrorWritesNothing(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "records.json")
+	s := New[record](path)
+	if err := add(s, record{ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(path)
+
+	err := s.Modify(func(records []record) ([]record, error) {
+		return nil, fmt.Errorf("refused")
+	})
+	if err == nil {
+		t.Fatal("Modify returned no error")
+	}
+	after, _ := os.ReadFile(path)
+	if string(before) != string(after) {
+		t.Error("a failed Modify changed the file")
+	}
+	assertClean(t, dir, "records.json")
+}
+
+func TestCacheOwnsItsRecords(t *testing.T) {
+	dir := t.TempDir()
+	s := New[record](filepath.Join(dir, "records.json"))
+	s.SetKey(func(r record) string { return r.ID })
+	s.AddIndex("n", func(r record) string { return strconv.Itoa(r.N) })
+
+	// the slices given to Save and returned from Modify stay the caller's
+	saved := []record{{ID: "a", N: 1}, {ID: "b", N: 2}}
+	if err := s.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+	saved[0] = record{ID: "changed", N: 9}
+
+	var modified []record
+	if err := s.Modify(func(records []record) ([]record, error) {
+		modified = append(records, record{ID: "c", N: 3})
+		return modified, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	modified[1].N = 9
+
+	records, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(records) != "[{a 1} {b 2} {c 3}]" {
+		t.Errorf("Load = %v, want the records as written", records)
+	}
+	if r, ok, err := s.Get("a"); !ok || err != nil || r.N != 1 {
+		t.Errorf("Get(a) = %v, %v, %v", r, ok, err)
+	}
+	if found, err := s.Find(func(r record) bool { return r.N == 9 }); err != nil || len(found) != 0 {
+		t.Errorf("Find(N == 9) = %v, %v, want nothing", found, err)
+	}
+}
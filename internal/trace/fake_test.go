@@ -0,0 +1,29 @@
+package trace
+
+import (
+	"context"
+	"net/netip"
+	"time"
+)
+
+// Fake is a scripted Network. Paths lists, per target, the
+// routers a probe passes in order; an invalid address is a silent hop. A
+// path ending in the target reaches it, otherwise probes beyond the path
+// go unanswered.
+type Fake struct {
+	Paths map[netip.Addr][]netip.Addr
+	RTT   time.Duration // reported for every answer
+}
+
+func (f Fake) Probe(ctx context.Context, dst netip.Addr, ttl int, timeout time.Duration) (Reply, error) {
+	if err := ctx.Err(); err != nil {
+		return Reply{}, err
+	}
+
+	path := f.Paths[dst]
+	if ttl > len(path) || !path[ttl-1].IsValid() {
+		return Reply{}, nil
+	}
+	from := path[ttl-1]
+	return Reply{From: from, RTT: f.RTT, Reached: from == dst}, nil
+}
@@ -0,0 +1,186 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// ICMP is the real network: it sends ICMP echo requests with a limited TTL
+// and reads back the routers' Time Exceeded messages. By default it uses
+// the unprivileged datagram ("udp") ICMP sockets Linux and macOS offer,
+// falling back to raw sockets when those are disabled; Privileged goes
+// straight to raw sockets, which need root.
+type ICMP struct {
+	Privileged bool
+}
+
+var (
+	// errNoDatagram is returned by probeDatagram when it cannot be used
+	errNoDatagram = errors.New("datagram icmp socket unavailable")
+	// errNotSupported is joined to errNoDatagram where icmp.ListenPacket's
+	// datagram sockets already see the routers' answers
+	errNotSupported = errors.New("not needed on this platform")
+)
+
+// seq numbers probes so concurrent traces can tell their replies apart
+var seq atomic.Uint32
+
+// probeData is the payload of every echo request
+var probeData = []byte("atmer-trace")
+
+func (n ICMP) Probe(ctx context.Context, dst netip.Addr, ttl int, timeout time.Duration) (Reply, error) {
+	dst = dst.Unmap()
+	v6 := dst.Is6()
+
+	network, laddr, proto := "udp4", "0.0.0.0", 1
+	var echo icmp.Type = ipv4.ICMPTypeEcho
+	if v6 {
+		network, laddr, proto = "udp6", "::", 58
+		echo = ipv6.ICMPTypeEchoRequest
+	}
+	raw := map[bool]string{false: "ip4:icmp", true: "ip6:ipv6-icmp"}[v6]
+	privileged := n.Privileged
+	if !privileged {
+		reply, err := probeDatagram(ctx, dst, ttl, timeout)
+		if !errors.Is(err, errNoDatagram) {
+			return reply, err
+		}
+		if !errors.Is(err, errNotSupported) {
+			// as below, root can still use a raw socket
+			slog.Debug("datagram icmp unavailable, trying raw socket", "err", err)
+			privileged = true
+		}
+	}
+	if privileged {
+		network = raw
+	}
+
+	conn, err := icmp.ListenPacket(network, laddr)
+	if err != nil && !privileged {
+		// datagram ICMP may be disabled (ping_group_range); root can still
+		// use a raw socket
+		slog.Debug("datagram icmp unavailable, trying raw socket", "network", network, "err", err)
+		if rconn, rerr := icmp.ListenPacket(raw, laddr); rerr == nil {
+			conn, err, privileged, network = rconn, nil, true, raw
+		}
+	}
+	if err != nil {
+		slog.Warn("icmp socket failed", "network", network, "err", err)
+		return Reply{}, err
+	}
+	defer conn.Close()
+
+	if v6 {
+		err = conn.IPv6PacketConn().SetHopLimit(ttl)
+	} else {
+		err = conn.IPv4PacketConn().SetTTL(ttl)
+	}
+	if err != nil {
+		return Reply{}, err
+	}
+
+	id, sq := os.Getpid()&0xffff, int(seq.Add(1)&0xffff)
+	msg := icmp.Message{Type: echo, Body: &icmp.Echo{ID: id, Seq: sq, Data: probeData}}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return Reply{}, err
+	}
+
+	var to net.Addr = &net.UDPAddr{IP: dst.AsSlice()}
+	if privileged {
+		to = &net.IPAddr{IP: dst.AsSlice()}
+	}
+
+	start := time.Now()
+	deadline := start.Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return Reply{}, err
+	}
+	if _, err := conn.WriteTo(b, to); err != nil {
+		return Reply{}, err
+	}
+
+	answered := func(r Reply) (Reply, error) {
+		slog.Debug("hop answered", "dst", dst, "ttl", ttl, "socket", network, "from", r.From, "reached", r.Reached, "rtt", r.RTT)
+		return r, nil
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		nr, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				slog.Debug("hop timed out", "dst", dst, "ttl", ttl, "socket", network, "took", time.Since(start))
+				return Reply{}, nil
+			}
+			return Reply{}, err
+		}
+
+		rm, err := icmp.ParseMessage(proto, buf[:nr])
+		if err != nil {
+			continue
+		}
+		reply := Reply{From: addrOf(from), RTT: time.Since(start)}
+
+		switch body := rm.Body.(type) {
+		case *icmp.Echo:
+			// datagram sockets rewrite the ID, so there only the sequence is ours
+			if (rm.Type == ipv4.ICMPTypeEchoReply || rm.Type == ipv6.ICMPTypeEchoReply) &&
+				body.Seq == sq && (!privileged || body.ID == id) {
+				reply.Reached = true
+				return answered(reply)
+			}
+		case *icmp.TimeExceeded:
+			if quotedSeq(body.Data, v6) == sq {
+				return answered(reply)
+			}
+		case *icmp.DstUnreach:
+			if quotedSeq(body.Data, v6) == sq {
+				reply.Reached = reply.From == dst
+				return answered(reply)
+			}
+		}
+	}
+}
+
+// quotedSeq digs the echo sequence number out of the original packet an
+// ICMP error quotes, or returns -1
+func quotedSeq(data []byte, v6 bool) int {
+	hl := 40 // IPv6 header; extension headers are not expected on echo
+	if !v6 {
+		if len(data) < 1 {
+			return -1
+		}
+		hl = int(data[0]&0x0f) * 4
+	}
+	if len(data) < hl+8 {
+		return -1
+	}
+	return int(data[hl+6])<<8 | int(data[hl+7])
+}
+
+func addrOf(a net.Addr) netip.Addr {
+	var ip net.IP
+	switch a := a.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.IPAddr:
+		ip = a.IP
+	}
+	addr, _ := netip.AddrFromSlice(ip)
+	return addr.Unmap()
+}
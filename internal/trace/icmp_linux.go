@@ -0,0 +1,181 @@
+package trace
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"net/netip"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/sys/unix"
+)
+
+// ICMP error types as reported in the error queue
+const (
+	timeExceeded4 = 11
+	unreachable4  = 3
+	timeExceeded6 = 3
+	unreachable6  = 1
+)
+
+// probeDatagram sends one echo over an unprivileged datagram ICMP socket.
+// Linux delivers only echo replies to such a socket's reads; the routers'
+// Time Exceeded and Destination Unreachable messages go to its error
+// queue, so IP_RECVERR is turned on and the queue is read with
+// MSG_ERRQUEUE. It returns errNoDatagram when the socket cannot be opened,
+// e.g. because ping_group_range leaves the user out.
+func probeDatagram(ctx context.Context, dst netip.Addr, ttl int, timeout time.Duration) (Reply, error) {
+	v6 := dst.Is6()
+	family, proto, level, recverr, hops := unix.AF_INET, unix.IPPROTO_ICMP, unix.SOL_IP, unix.IP_RECVERR, unix.IP_TTL
+	origin, exceeded, unreachable := uint8(unix.SO_EE_ORIGIN_ICMP), uint8(timeExceeded4), uint8(unreachable4)
+	var echo icmp.Type = ipv4.ICMPTypeEcho
+	var to unix.Sockaddr = &unix.SockaddrInet4{Addr: dst.As4()}
+	if v6 {
+		family, proto, level, recverr, hops = unix.AF_INET6, unix.IPPROTO_ICMPV6, unix.SOL_IPV6, unix.IPV6_RECVERR, unix.IPV6_UNICAST_HOPS
+		origin, exceeded, unreachable = unix.SO_EE_ORIGIN_ICMP6, timeExceeded6, unreachable6
+		echo = ipv6.ICMPTypeEchoRequest
+		to = &unix.SockaddrInet6{Addr: dst.As16()}
+	}
+
+	fd, err := unix.Socket(family, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, proto)
+	if err != nil {
+		return Reply{}, errors.Join(errNoDatagram, err)
+	}
+	defer unix.Close(fd)
+
+	if err := unix.SetsockoptInt(fd, level, recverr, 1); err != nil {
+		return Reply{}, err
+	}
+	if err := unix.SetsockoptInt(fd, level, hops, ttl); err != nil {
+		return Reply{}, err
+	}
+
+	// the kernel fills in the echo ID, so only the sequence is ours
+	sq := int(seq.Add(1) & 0xffff)
+	msg := icmp.Message{Type: echo, Body: &icmp.Echo{Seq: sq, Data: probeData}}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return Reply{}, err
+	}
+
+	start := time.Now()
+	deadline := start.Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := unix.Sendto(fd, b, 0, to); err != nil {
+		return Reply{}, err
+	}
+
+	buf := make([]byte, 1500)
+	oob := make([]byte, 512)
+	for {
+		wait := time.Until(deadline)
+		if wait <= 0 || ctx.Err() != nil {
+			slog.Debug("hop timed out", "dst", dst, "ttl", ttl, "socket", "datagram+errqueue", "took", time.Since(start))
+			return Reply{}, nil
+		}
+		// wake up now and then to notice a cancelled ctx
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN | unix.POLLERR}}
+		if _, err := unix.Poll(fds, int(min(wait, 100*time.Millisecond)/time.Millisecond)+1); err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return Reply{}, err
+		}
+
+		if fds[0].Revents&unix.POLLERR != 0 {
+			n, oobn, _, _, err := unix.Recvmsg(fd, buf, oob, unix.MSG_ERRQUEUE|unix.MSG_DONTWAIT)
+			if err == nil {
+				if reply, ok := errqueueReply(buf[:n], oob[:oobn], sq, level, recverr, origin, exceeded, unreachable); ok {
+					reply.RTT = time.Since(start)
+					reply.Reached = reply.Reached && reply.From == dst
+					slog.Debug("hop answered", "dst", dst, "ttl", ttl, "socket", "datagram+errqueue", "from", reply.From, "reached", reply.Reached, "rtt", reply.RTT)
+					return reply, nil
+				}
+			}
+		}
+
+		if fds[0].Revents&unix.POLLIN != 0 {
+			n, from, err := unix.Recvfrom(fd, buf, unix.MSG_DONTWAIT)
+			if err != nil {
+				continue
+			}
+			rm, err := icmp.ParseMessage(proto, buf[:n])
+			if err != nil {
+				continue
+			}
+			body, ok := rm.Body.(*icmp.Echo)
+			if ok && (rm.Type == ipv4.ICMPTypeEchoReply || rm.Type == ipv6.ICMPTypeEchoReply) && body.Seq == sq {
+				reply := Reply{From: sockaddrAddr(from), RTT: time.Since(start), Reached: true}
+				slog.Debug("hop answered", "dst", dst, "ttl", ttl, "socket", "datagram", "from", reply.From, "reached", true, "rtt", reply.RTT)
+				return reply, nil
+			}
+		}
+	}
+}
+
+// errqueueReply reads a queued ICMP error: payload is the echo request it
+// is about, the control message a sock_extended_err followed by the
+// address of the router that sent it. Reached is set for Destination
+// Unreachable, which counts only if the target itself sent it.
+func errqueueReply(payload, oob []byte, sq, level, recverr int, origin, exceeded, unreachable uint8) (Reply, bool) {
+	// the echo header is type, code, checksum, ID and then the sequence
+	if len(payload) < 8 || int(payload[6])<<8|int(payload[7]) != sq {
+		return Reply{}, false
+	}
+
+	cmsgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return Reply{}, false
+	}
+	for _, c := range cmsgs {
+		if int(c.Header.Level) != level || int(c.Header.Type) != recverr {
+			continue
+		}
+		// struct sock_extended_err: errno (4), origin, type, code, pad,
+		// info (4), data (4), then the offender's sockaddr
+		const eeSize = 16
+		d := c.Data
+		if len(d) < eeSize || d[4] != origin {
+			continue
+		}
+		if d[5] != exceeded && d[5] != unreachable {
+			continue
+		}
+		from := offender(d[eeSize:])
+		if !from.IsValid() {
+			continue
+		}
+		return Reply{From: from, Reached: d[5] == unreachable}, true
+	}
+	return Reply{}, false
+}
+
+// offender reads the sockaddr_in or sockaddr_in6 after a sock_extended_err
+func offender(sa []byte) netip.Addr {
+	if len(sa) < 2 {
+		return netip.Addr{}
+	}
+	switch family := int(binary.NativeEndian.Uint16(sa)); {
+	case family == unix.AF_INET && len(sa) >= 8:
+		return netip.AddrFrom4([4]byte(sa[4:8]))
+	case family == unix.AF_INET6 && len(sa) >= 24:
+		return netip.AddrFrom16([16]byte(sa[8:24])).Unmap()
+	}
+	return netip.Addr{}
+}
+
+func sockaddrAddr(sa unix.Sockaddr) netip.Addr {
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		return netip.AddrFrom4(sa.Addr)
+	case *unix.SockaddrInet6:
+		return netip.AddrFrom16(sa.Addr).Unmap()
+	}
+	return netip.Addr{}
+}
@@ -0,0 +1,47 @@
+package trace
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// queuedError builds the control message Linux attaches to a queued ICMP
+// error from router
+func queuedError(icmpType uint8, router netip.Addr) []byte {
+	ee := make([]byte, 16+unix.SizeofSockaddrInet4)
+	ee[4] = unix.SO_EE_ORIGIN_ICMP
+	ee[5] = icmpType
+	binary.NativeEndian.PutUint16(ee[16:], unix.AF_INET)
+	a := router.As4()
+	copy(ee[20:], a[:])
+
+	oob := make([]byte, unix.CmsgSpace(len(ee)))
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+	h.Level, h.Type = unix.SOL_IP, unix.IP_RECVERR
+	h.SetLen(unix.CmsgLen(len(ee)))
+	copy(oob[unix.CmsgLen(0):], ee)
+	return oob
+}
+
+func TestErrqueueReply(t *testing.T) {
+	router := netip.MustParseAddr("10.0.0.1")
+	echo := []byte{8, 0, 0, 0, 0, 0, 0x01, 0x02} // sequence 0x0102
+
+	reply, ok := errqueueReply(echo, queuedError(timeExceeded4, router), 0x0102, unix.SOL_IP, unix.IP_RECVERR, unix.SO_EE_ORIGIN_ICMP, timeExceeded4, unreachable4)
+	if !ok || reply.From != router || reply.Reached {
+		t.Errorf("Time Exceeded: got %+v, %v, want an answer from %s", reply, ok, router)
+	}
+
+	reply, ok = errqueueReply(echo, queuedError(unreachable4, router), 0x0102, unix.SOL_IP, unix.IP_RECVERR, unix.SO_EE_ORIGIN_ICMP, timeExceeded4, unreachable4)
+	if !ok || !reply.Reached {
+		t.Errorf("Destination Unreachable: got %+v, %v, want reached", reply, ok)
+	}
+
+	if _, ok := errqueueReply(echo, queuedError(timeExceeded4, router), 0x0103, unix.SOL_IP, unix.IP_RECVERR, unix.SO_EE_ORIGIN_ICMP, timeExceeded4, unreachable4); ok {
+		t.Error("accepted the answer to another probe")
+	}
+}
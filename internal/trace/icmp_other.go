@@ -0,0 +1,16 @@
+//go:build !linux
+
+package trace
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"time"
+)
+
+// probeDatagram is only needed on Linux, whose datagram ICMP sockets hide
+// the routers' answers in the error queue
+func probeDatagram(ctx context.Context, dst netip.Addr, ttl int, timeout time.Duration) (Reply, error) {
+	return Reply{}, errors.Join(errNoDatagram, errNotSupported)
+}
@@ -0,0 +1,114 @@
+// Package trace finds where the path to an unreachable ATM breaks, the way
+// an engineer would with traceroute.
+package trace
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// Network sends one probe towards dst that expires after ttl hops
+type Network interface {
+	Probe(ctx context.Context, dst netip.Addr, ttl int, timeout time.Duration) (Reply, error)
+}
+
+// Reply is the answer to one probe. From is invalid when nothing answered
+// before the timeout; Reached is set when dst itself answered.
+type Reply struct {
+	From    netip.Addr
+	RTT     time.Duration
+	Reached bool
+}
+
+// Hop is one step of a path; Addr is invalid for a silent hop
+type Hop struct {
+	TTL  int
+	Addr netip.Addr
+	RTT  time.Duration
+}
+
+// Result is the path to one target
+type Result struct {
+	Target  netip.Addr
+	Hops    []Hop
+	Reached bool
+	Err     error
+}
+
+// LastHop returns the last hop that answered, if any
+func (r Result) LastHop() (Hop, bool) {
+	for i := len(r.Hops) - 1; i >= 0; i-- {
+		if r.Hops[i].Addr.IsValid() {
+			return r.Hops[i], true
+		}
+	}
+	return Hop{}, false
+}
+
+// Tracer runs traceroutes over a Network
+type Tracer struct {
+	Net         Network
+	MaxHops     int           // give up after this many hops
+	Timeout     time.Duration // wait per probe
+	Concurrency int           // targets traced at once by TraceAll
+	// GiveUpAfter stops a trace after this many silent hops in a row, as
+	// the path has usually broken for good by then; 0 never stops early
+	GiveUpAfter int
+}
+
+// New returns a tracer with the usual traceroute limits
+func New(net Network) *Tracer {
+	return &Tracer{Net: net, MaxHops: 30, Timeout: time.Second, Concurrency: 8, GiveUpAfter: 5}
+}
+
+// Trace probes dst with increasing TTLs until it answers or a limit is hit
+func (t *Tracer) Trace(ctx context.Context, dst netip.Addr) Result {
+	res := Result{Target: dst}
+	silent := 0
+	for ttl := 1; ttl <= t.MaxHops; ttl++ {
+		if err := ctx.Err(); err != nil {
+			res.Err = err
+			return res
+		}
+
+		reply, err := t.Net.Probe(ctx, dst, ttl, t.Timeout)
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		res.Hops = append(res.Hops, Hop{TTL: ttl, Addr: reply.From, RTT: reply.RTT})
+		if reply.Reached {
+			res.Reached = true
+			return res
+		}
+
+		if reply.From.IsValid() {
+			silent = 0
+		} else if silent++; t.GiveUpAfter > 0 && silent >= t.GiveUpAfter {
+			return res
+		}
+	}
+	return res
+}
+
+// TraceAll traces every target, Concurrency at a time; results are in the
+// order of targets
+func (t *Tracer) TraceAll(ctx context.Context, targets []netip.Addr) []Result {
+	results := make([]Result, len(targets))
+	sem := make(chan struct{}, max(t.Concurrency, 1))
+
+	var wg sync.WaitGroup
+	for i, dst := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = t.Trace(ctx, dst)
+		}()
+	}
+	wg.Wait()
+	return results
+}
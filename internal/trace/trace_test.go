@@ -0,0 +1,108 @@
+package trace
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+var (
+	gateway = netip.MustParseAddr("10.0.0.1")
+	core    = netip.MustParseAddr("10.1.0.1")
+	atm     = netip.MustParseAddr("10.20.1.10")
+	broken  = netip.MustParseAddr("10.20.2.10")
+	silent  = netip.Addr{}
+)
+
+func testTracer() *Tracer {
+	return &Tracer{
+		Net: Fake{Paths: map[netip.Addr][]netip.Addr{
+			atm:    {gateway, silent, core, atm},
+			broken: {gateway, core},
+		}, RTT: time.Millisecond},
+		MaxHops:     30,
+		Timeout:     time.Second,
+		Concurrency: 2,
+		GiveUpAfter: 3,
+	}
+}
+
+func TestTraceReaches(t *testing.T) {
+	res := testTracer().Trace(context.Background(), atm)
+	if !res.Reached || res.Err != nil {
+		t.Fatalf("Reached = %v, Err = %v, want reached", res.Reached, res.Err)
+	}
+	if len(res.Hops) != 4 {
+		t.Fatalf("got %d hops, want 4", len(res.Hops))
+	}
+	if res.Hops[1].Addr.IsValid() {
+		t.Errorf("hop 2 = %s, want silent", res.Hops[1].Addr)
+	}
+	for i, h := range res.Hops {
+		if h.TTL != i+1 {
+			t.Errorf("hop %d has TTL %d", i+1, h.TTL)
+		}
+	}
+}
+
+func TestTraceGivesUp(t *testing.T) {
+	res := testTracer().Trace(context.Background(), broken)
+	if res.Reached {
+		t.Fatal("Reached = true for a broken path")
+	}
+	// two answering hops, then GiveUpAfter silent ones
+	if len(res.Hops) != 5 {
+		t.Fatalf("got %d hops, want 5", len(res.Hops))
+	}
+	last, ok := res.LastHop()
+	if !ok || last.Addr != core || last.TTL != 2 {
+		t.Errorf("LastHop = %v, %v, want %s at TTL 2", last, ok, core)
+	}
+}
+
+func TestTraceMaxHops(t *testing.T) {
+	tr := testTracer()
+	tr.MaxHops, tr.GiveUpAfter = 2, 0
+	res := tr.Trace(context.Background(), atm)
+	if res.Reached || len(res.Hops) != 2 {
+		t.Errorf("Reached = %v with %d hops, want 2 hops and not reached", res.Reached, len(res.Hops))
+	}
+}
+
+func TestTraceCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res := testTracer().Trace(ctx, atm)
+	if res.Err == nil || len(res.Hops) != 0 {
+		t.Errorf("Err = %v with %d hops, want the context error", res.Err, len(res.Hops))
+	}
+}
+
+func TestLastHopNone(t *testing.T) {
+	res := Result{Hops: []Hop{{TTL: 1}, {TTL: 2}}}
+	if h, ok := res.LastHop(); ok {
+		t.Errorf("LastHop = %v, want none", h)
+	}
+}
+
+func TestTraceAllKeepsOrder(t *testing.T) {
+	unknown := netip.MustParseAddr("192.0.2.1")
+	targets := []netip.Addr{broken, atm, unknown, atm}
+	results := testTracer().TraceAll(context.Background(), targets)
+	if len(results) != len(targets) {
+		t.Fatalf("got %d results for %d targets", len(results), len(targets))
+	}
+	for i, res := range results {
+		if res.Target != targets[i] {
+			t.Errorf("result %d is for %s, want %s", i, res.Target, targets[i])
+		}
+	}
+	if results[0].Reached || !results[1].Reached || results[2].Reached || !results[3].Reached {
+		t.Errorf("reached = %v %v %v %v, want false true false true",
+			results[0].Reached, results[1].Reached, results[2].Reached, results[3].Reached)
+	}
+	if _, ok := results[2].LastHop(); ok {
+		t.Error("an unanswered target has a last hop")
+	}
+}
@@ -0,0 +1,674 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/fahmaliyi/atmer/internal/service"
+)
+
+// Options wires the manager to its data and side effects, so it can be
+// driven with scripted key messages and fakes
+type Options struct {
+	Machines []service.Machine
+	Records  []service.ServiceRecord
+
+	// Validate checks a new or edited machine against the others
+	Validate func(m service.Machine, others []service.Machine) error
+	// Save applies the changes to the list as stored, which may hold
+	// changes made elsewhere since it was loaded, and returns the list as
+	// saved; summary describes the changes
+	Save func(summary string, changes []service.MachineChange) ([]service.Machine, error)
+	// Probe pings an address and reports the round trip time
+	Probe func(ip string) (bool, time.Duration)
+}
+
+type mode int
+
+const (
+	modeBrowse mode = iota
+	modeFilter
+	modeEdit
+	modeConfirmDelete
+)
+
+type probeState struct {
+	running bool
+	ok      bool
+	rtt     time.Duration
+	at      time.Time
+}
+
+// probeMsg carries the result of a ping started with 'p'
+type probeMsg struct {
+	name string
+	ok   bool
+	rtt  time.Duration
+	at   time.Time
+}
+
+// form is the inline editor for the fields of one machine
+type form struct {
+	index  int // position in machines, -1 when adding
+	fields [4]string
+	focus  int
+}
+
+var formLabels = [4]string{"Name", "IP", "Region", "Links"}
+
+// Model is the bubbletea model of the ATM manager
+type Model struct {
+	opts     Options
+	machines []service.Machine
+	records  map[string]*service.ServiceRecord
+
+	visible  []int // indexes into machines that pass the filter
+	cursor   int   // position in visible
+	offset   int   // first row of visible on screen
+	selected map[string]bool
+	probes   map[string]probeState
+
+	filter  string
+	mode    mode
+	form    form
+	message string
+
+	width, height int
+}
+
+// New builds the manager model
+func New(opts Options) Model {
+	m := Model{
+		opts:     opts,
+		machines: append([]service.Machine(nil), opts.Machines...),
+		selected: map[string]bool{},
+		probes:   map[string]probeState{},
+		width:    100,
+		height:   24,
+	}
+	m.relink()
+	m.refilter()
+	return m
+}
+
+// Machines returns the current list, reflecting every saved change
+func (m Model) Machines() []service.Machine {
+	return m.machines
+}
+
+func (m Model) Init() tea.Cmd {
+	return nil
+}
+
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.scroll()
+		return m, nil
+
+	case probeMsg:
+		m.probes[key(msg.name)] = probeState{ok: msg.ok, rtt: msg.rtt, at: msg.at}
+		return m, nil
+
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			return m, tea.Quit
+		}
+
+		switch m.mode {
+		case modeFilter:
+			return m.updateFilter(msg)
+		case modeEdit:
+			return m.updateEdit(msg)
+		case modeConfirmDelete:
+			return m.updateConfirm(msg)
+		}
+		return m.updateBrowse(msg)
+	}
+
+	return m, nil
+}
+
+func (m Model) updateBrowse(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.message = ""
+
+	switch msg.String() {
+	case "esc":
+		if m.filter == "" {
+			return m, tea.Quit
+		}
+		m.filter = ""
+		m.refilter()
+	case "q":
+		return m, tea.Quit
+	case "up", "k":
+		m.move(-1)
+	case "down", "j":
+		m.move(1)
+	case "pgup":
+		m.move(-m.rows())
+	case "pgdown":
+		m.move(m.rows())
+	case "home", "g":
+		m.move(-len(m.visible))
+	case "end", "G":
+		m.move(len(m.visible))
+	case "/":
+		m.mode = modeFilter
+	case " ":
+		if cur, ok := m.current(); ok {
+			k := key(cur.Name)
+			m.selected[k] = !m.selected[k]
+			if !m.selected[k] {
+				delete(m.selected, k)
+			}
+			m.move(1)
+		}
+	case "a":
+		m.form = form{index: -1}
+		m.mode = modeEdit
+	case "e", "enter":
+		if i, ok := m.currentIndex(); ok {
+			mc := m.machines[i]
+			m.form = form{index: i, fields: [4]string{mc.Name, mc.IP, mc.Region, service.FormatLinks(mc.Links)}}
+			m.mode = modeEdit
+		}
+	case "d", "delete":
+		if len(m.targets()) > 0 {
+			m.mode = modeConfirmDelete
+		}
+	case "p":
+		if cur, ok := m.current(); ok {
+			return m, m.probe(cur)
+		}
+	case "P":
+		var cmds []tea.Cmd
+		for _, i := range m.targets() {
+			cmds = append(cmds, m.probe(m.machines[i]))
+		}
+		return m, tea.Batch(cmds...)
+	}
+
+	return m, nil
+}
+
+func (m Model) updateFilter(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.mode = modeBrowse
+	case tea.KeyEsc:
+		m.filter = ""
+		m.mode = modeBrowse
+	case tea.KeyBackspace:
+		if r := []rune(m.filter); len(r) > 0 {
+			m.filter = string(r[:len(r)-1])
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.filter += string(msg.Runes)
+	}
+
+	m.refilter()
+	return m, nil
+}
+
+func (m Model) updateEdit(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	f := &m.form
+
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.mode = modeBrowse
+		m.message = "Cancelled"
+	case tea.KeyTab, tea.KeyDown:
+		f.focus = (f.focus + 1) % len(f.fields)
+	case tea.KeyShiftTab, tea.KeyUp:
+		f.focus = (f.focus + len(f.fields) - 1) % len(f.fields)
+	case tea.KeyBackspace:
+		if r := []rune(f.fields[f.focus]); len(r) > 0 {
+			f.fields[f.focus] = string(r[:len(r)-1])
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		f.fields[f.focus] += string(msg.Runes)
+	case tea.KeyEnter:
+		m.submit()
+	}
+
+	return m, nil
+}
+
+func (m Model) updateConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.mode = modeBrowse
+	if s := msg.String(); s != "y" && s != "Y" {
+		m.message = "Cancelled"
+		return m, nil
+	}
+
+	targets := m.targets()
+	drop := make(map[int]bool, len(targets))
+	var changes []service.MachineChange
+	var names []string
+	for _, i := range targets {
+		drop[i] = true
+		before := m.machines[i]
+		changes = append(changes, service.MachineChange{Before: &before})
+		names = append(names, before.Name)
+	}
+
+	kept := make([]service.Machine, 0, len(m.machines)-len(drop))
+	for i, mc := range m.machines {
+		if !drop[i] {
+			kept = append(kept, mc)
+		}
+	}
+
+	summary := fmt.Sprintf("Deleted %d ATM(s): %s", len(names), strings.Join(names, ", "))
+	if !m.save(kept, summary, changes) {
+		return m, nil
+	}
+	for _, n := range names {
+		delete(m.selected, key(n))
+	}
+	m.message = summary
+	return m, nil
+}
+
+// submit validates and saves the form
+func (m *Model) submit() {
+	f := m.form
+	links, err := service.ParseLinks(f.fields[3])
+	if err != nil {
+		m.message = "Error: " + err.Error()
+		return
+	}
+	var edited service.Machine
+	if f.index >= 0 {
+		edited = m.machines[f.index] // keeps the fields the form does not show
+	}
+	edited.Name = strings.TrimSpace(f.fields[0])
+	edited.IP = strings.TrimSpace(f.fields[1])
+	edited.Region = strings.TrimSpace(f.fields[2])
+	edited.Links = links
+
+	others := make([]service.Machine, 0, len(m.machines))
+	for i, mc := range m.machines {
+		if i != f.index {
+			others = append(others, mc)
+		}
+	}
+	if m.opts.Validate != nil {
+		if err := m.opts.Validate(edited, others); err != nil {
+			m.message = "Error: " + err.Error()
+			return
+		}
+	}
+
+	next := append([]service.Machine(nil), m.machines...)
+	var change service.MachineChange
+	var summary string
+	if f.index < 0 {
+		next = append(next, edited)
+		change = service.MachineChange{After: &edited}
+		summary = fmt.Sprintf("Added ATM %s (%s)", edited.Name, edited.IP)
+	} else {
+		before := m.machines[f.index]
+		if before.Equal(edited) {
+			m.mode = modeBrowse
+			m.message = "No changes"
+			return
+		}
+		next[f.index] = edited
+		change = service.MachineChange{Before: &before, After: &edited}
+		summary = fmt.Sprintf("Edited ATM %s: %s", before.Name, describeEdit(before, edited))
+	}
+
+	if !m.save(next, summary, []service.MachineChange{change}) {
+		return
+	}
+	m.mode = modeBrowse
+	m.message = summary
+	m.focus(edited.Name)
+}
+
+// save persists the changes and adopts the list as saved, next when there
+// is nowhere to save to, or keeps the old list on failure
+func (m *Model) save(next []service.Machine, summary string, changes []service.MachineChange) bool {
+	if m.opts.Save != nil {
+		saved, err := m.opts.Save(summary, changes)
+		if err != nil {
+			m.message = "Error: " + err.Error()
+			return false
+		}
+		next = saved
+	}
+
+	m.machines = next
+	m.relink()
+	m.refilter()
+	return true
+}
+
+func (m *Model) probe(mc service.Machine) tea.Cmd {
+	if m.opts.Probe == nil {
+		return nil
+	}
+
+	k := key(mc.Name)
+	st := m.probes[k]
+	st.running = true
+	m.probes[k] = st
+
+	probe := m.opts.Probe
+	return func() tea.Msg {
+		ok, rtt := probe(mc.IP)
+		return probeMsg{name: mc.Name, ok: ok, rtt: rtt, at: time.Now()}
+	}
+}
+
+// targets are the selected machines the filter shows, or the one under
+// the cursor; selections the filter hides are left alone
+func (m Model) targets() []int {
+	var idx []int
+	for _, i := range m.visible {
+		if m.selected[key(m.machines[i].Name)] {
+			idx = append(idx, i)
+		}
+	}
+	if len(idx) == 0 {
+		if i, ok := m.currentIndex(); ok {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// hiddenSelected counts the selected machines the filter hides
+func (m Model) hiddenSelected() int {
+	shown := map[int]bool{}
+	for _, i := range m.visible {
+		shown[i] = true
+	}
+	n := 0
+	for i, mc := range m.machines {
+		if m.selected[key(mc.Name)] && !shown[i] {
+			n++
+		}
+	}
+	return n
+}
+
+func (m Model) currentIndex() (int, bool) {
+	if m.cursor < 0 || m.cursor >= len(m.visible) {
+		return 0, false
+	}
+	return m.visible[m.cursor], true
+}
+
+func (m Model) current() (service.Machine, bool) {
+	i, ok := m.currentIndex()
+	if !ok {
+		return service.Machine{}, false
+	}
+	return m.machines[i], true
+}
+
+func (m *Model) move(delta int) {
+	m.cursor = max(0, min(m.cursor+delta, len(m.visible)-1))
+	m.scroll()
+}
+
+// focus moves the cursor to the named machine if it is visible
+func (m *Model) focus(name string) {
+	for pos, i := range m.visible {
+		if strings.EqualFold(m.machines[i].Name, name) {
+			m.cursor = pos
+			m.scroll()
+			return
+		}
+	}
+}
+
+func (m *Model) scroll() {
+	rows := m.rows()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+rows {
+		m.offset = m.cursor - rows + 1
+	}
+	m.offset = max(0, m.offset)
+}
+
+// rows is how many table rows fit on screen
+func (m Model) rows() int {
+	return max(1, m.height-8)
+}
+
+func (m *Model) refilter() {
+	q := strings.ToLower(strings.TrimSpace(m.filter))
+	m.visible = m.visible[:0]
+	for i, mc := range m.machines {
+		if q == "" || strings.Contains(strings.ToLower(mc.Name), q) || strings.Contains(mc.IP, q) ||
+			strings.Contains(strings.ToLower(mc.Region), q) {
+			m.visible = append(m.visible, i)
+		}
+	}
+	m.move(0)
+}
+
+// relink pairs machines with their service records for the side panel
+func (m *Model) relink() {
+	m.records = map[string]*service.ServiceRecord{}
+	for _, site := range service.LinkSites(m.machines, m.opts.Records, nil) {
+		if site.Machine != nil && site.Record != nil {
+			m.records[key(site.Machine.Name)] = site.Record
+		}
+	}
+}
+
+func describeEdit(before, after service.Machine) string {
+	var parts []string
+	if before.Name != after.Name {
+		parts = append(parts, fmt.Sprintf("name %s → %s", before.Name, after.Name))
+	}
+	if before.IP != after.IP {
+		parts = append(parts, fmt.Sprintf("IP %s → %s", before.IP, after.IP))
+	}
+	if before.Region != after.Region {
+		parts = append(parts, fmt.Sprintf("region %s → %s", before.Region, after.Region))
+	}
+	if old, cur := service.FormatLinks(before.Links), service.FormatLinks(after.Links); old != cur {
+		parts = append(parts, fmt.Sprintf("links %s → %s", old, cur))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func key(name string) string {
+	return strings.ToLower(name)
+}
+
+var (
+	titleStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	headerStyle   = lipgloss.NewStyle().Bold(true).Underline(true)
+	cursorStyle   = lipgloss.NewStyle().Reverse(true)
+	onlineStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	offlineStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	pendingStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
+	dimStyle      = lipgloss.NewStyle().Faint(true)
+	panelStyle    = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1)
+	focusStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	panelMinWidth = 90
+)
+
+func (m Model) View() string {
+	var b strings.Builder
+
+	b.WriteString(titleStyle.Render("ATM Manager"))
+	b.WriteString(dimStyle.Render(fmt.Sprintf("  %d of %d ATMs, %d selected", len(m.visible), len(m.machines), len(m.selected))))
+	b.WriteString("\n")
+
+	switch m.mode {
+	case modeFilter:
+		b.WriteString("Filter: " + m.filter + "█\n")
+	default:
+		if m.filter != "" {
+			b.WriteString(dimStyle.Render("Filter: "+m.filter) + "\n")
+		} else {
+			b.WriteString("\n")
+		}
+	}
+
+	table := m.viewTable()
+	panel := m.viewPanel()
+	if m.width >= panelMinWidth {
+		b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, table, " ", panel))
+	} else {
+		b.WriteString(lipgloss.JoinVertical(lipgloss.Left, table, panel))
+	}
+	b.WriteString("\n")
+
+	switch m.mode {
+	case modeEdit:
+		b.WriteString(m.viewForm())
+	case modeConfirmDelete:
+		var names []string
+		for _, i := range m.targets() {
+			names = append(names, m.machines[i].Name)
+		}
+		prompt := fmt.Sprintf("Delete %s? (y/N)", strings.Join(names, ", "))
+		if n := m.hiddenSelected(); n > 0 {
+			prompt += fmt.Sprintf(" %d selected ATM(s) hidden by the filter are kept.", n)
+		}
+		b.WriteString(offlineStyle.Render(prompt) + "\n")
+	default:
+		if m.message != "" {
+			b.WriteString(m.message + "\n")
+		}
+		b.WriteString(dimStyle.Render("↑/↓ move • / filter • space select • a add • e edit • d delete • p ping • P ping selected • q quit") + "\n")
+	}
+
+	return b.String()
+}
+
+func (m Model) viewTable() string {
+	var b strings.Builder
+	b.WriteString(headerStyle.Render(fmt.Sprintf("  %-28s %-16s %-16s %-10s %-14s", "Name", "IP", "Modem", "Region", "Status")))
+	b.WriteString("\n")
+
+	end := min(len(m.visible), m.offset+m.rows())
+	for pos := m.offset; pos < end; pos++ {
+		mc := m.machines[m.visible[pos]]
+
+		mark := " "
+		if m.selected[key(mc.Name)] {
+			mark = "*"
+		}
+		row := fmt.Sprintf("%s %-28s %-16s %-16s %-10s ", mark, truncate(mc.Name, 28), truncate(mc.IP, 16),
+			truncate(mc.Modem(), 16), truncate(mc.Region, 10))
+		status := m.viewStatus(mc.Name)
+
+		if pos == m.cursor {
+			row = cursorStyle.Render(row)
+		}
+		b.WriteString(row + status + "\n")
+	}
+
+	if len(m.visible) == 0 {
+		b.WriteString(dimStyle.Render("  no ATMs match") + "\n")
+	}
+	return b.String()
+}
+
+func (m Model) viewStatus(name string) string {
+	st, ok := m.probes[key(name)]
+	switch {
+	case !ok:
+		return dimStyle.Render("-")
+	case st.running:
+		return pendingStyle.Render("pinging…")
+	case st.ok:
+		return onlineStyle.Render(fmt.Sprintf("up %s", st.rtt.Round(100*time.Microsecond)))
+	default:
+		return offlineStyle.Render("down")
+	}
+}
+
+func (m Model) viewPanel() string {
+	cur, ok := m.current()
+	if !ok {
+		return panelStyle.Render(dimStyle.Render("No ATM selected"))
+	}
+
+	lines := []string{
+		titleStyle.Render(cur.Name),
+		"IP:    " + cur.IP,
+		"Modem: " + cur.Modem(),
+	}
+	if cur.Region != "" {
+		lines = append(lines, "Region: "+cur.Region)
+	}
+	for _, l := range cur.Links {
+		if l.Role != service.RoleModem {
+			lines = append(lines, fmt.Sprintf("%s (%s): %s", l.Name, l.Role, l.Address))
+		}
+	}
+	if st, ok := m.probes[key(cur.Name)]; ok && !st.running {
+		lines = append(lines, "Ping:  "+m.viewStatus(cur.Name)+dimStyle.Render(" at "+st.at.Format("15:04:05")))
+	}
+	lines = append(lines, "")
+
+	r, ok := m.records[key(cur.Name)]
+	if !ok {
+		lines = append(lines, dimStyle.Render("No circuit on file"))
+		return panelStyle.Render(strings.Join(lines, "\n"))
+	}
+
+	fields := [][2]string{
+		{"Location", r.Location},
+		{"WAN", r.WANIP},
+		{"LAN", r.LANIP},
+		{"Conn", r.ConnectionType},
+		{"BW", r.Bandwidth.String()},
+		{"Line", r.LineType},
+		{"Service #", r.ServiceNumber},
+		{"Account #", r.AccountNumber},
+	}
+	for _, f := range fields {
+		lines = append(lines, fmt.Sprintf("%-10s %s", f[0]+":", f[1]))
+	}
+	return panelStyle.Render(strings.Join(lines, "\n"))
+}
+
+func (m Model) viewForm() string {
+	title := "Add ATM"
+	if m.form.index >= 0 {
+		title = "Edit " + m.machines[m.form.index].Name
+	}
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(title) + "\n")
+	for i, label := range formLabels {
+		line := fmt.Sprintf("%-7s %s", label+":", m.form.fields[i])
+		if i == m.form.focus {
+			line = focusStyle.Render("> "+line) + "█"
+		} else {
+			line = "  " + line
+		}
+		b.WriteString(line + "\n")
+	}
+	if m.message != "" {
+		b.WriteString(offlineStyle.Render(m.message) + "\n")
+	}
+	b.WriteString(dimStyle.Render("tab next field • enter save • esc cancel") + "\n")
+	return b.String()
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
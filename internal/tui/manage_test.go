@@ -0,0 +1,318 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/fahmaliyi/atmer/internal/service"
+)
+
+// saved stands in for the stored list: it records the calls a Model makes
+// to Options.Save and applies their changes to machines
+type saved struct {
+	machines []service.Machine
+	summary  string
+	changes  []service.MachineChange
+	calls    int
+	fail     error
+}
+
+func (s *saved) save(summary string, changes []service.MachineChange) ([]service.Machine, error) {
+	s.calls++
+	if s.fail != nil {
+		return nil, s.fail
+	}
+	s.summary, s.changes = summary, changes
+	for _, c := range changes {
+		i := slices.IndexFunc(s.machines, func(m service.Machine) bool { return c.Before != nil && m.Name == c.Before.Name })
+		switch {
+		case c.After == nil:
+			s.machines = slices.Delete(s.machines, i, i+1)
+		case i < 0:
+			s.machines = append(s.machines, *c.After)
+		default:
+			s.machines[i] = *c.After
+		}
+	}
+	return slices.Clone(s.machines), nil
+}
+
+func newModel(s *saved) Model {
+	machines := []service.Machine{
+		{Name: "Bole", IP: "10.20.1.10", Region: "Central"},
+		{Name: "Piassa", IP: "10.20.2.10", Region: "North"},
+		{Name: "Kality", IP: "10.20.3.10", Region: "South"},
+		{Name: "Shiro Meda", IP: "10.20.4.10", Region: "North"},
+	}
+	s.machines = slices.Clone(machines)
+	return New(Options{
+		Machines: machines,
+		Validate: func(m service.Machine, others []service.Machine) error {
+			for _, o := range others {
+				if strings.EqualFold(o.Name, m.Name) {
+					return fmt.Errorf("ATM %s already exists", m.Name)
+				}
+			}
+			return nil
+		},
+		Save: s.save,
+		Probe: func(ip string) (bool, time.Duration) {
+			return ip != "10.20.3.10", 2 * time.Millisecond
+		},
+	})
+}
+
+// press feeds keys to the model and runs the commands they return. Named
+// keys are spelled out; anything else is typed as runes.
+func press(m Model, keys ...string) Model {
+	for _, k := range keys {
+		var msg tea.KeyMsg
+		switch k {
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case "esc":
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		case "tab":
+			msg = tea.KeyMsg{Type: tea.KeyTab}
+		case "down":
+			msg = tea.KeyMsg{Type: tea.KeyDown}
+		case "backspace":
+			msg = tea.KeyMsg{Type: tea.KeyBackspace}
+		case "space":
+			msg = tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}}
+		default:
+			msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+		}
+		next, cmd := m.Update(msg)
+		m = run(next.(Model), cmd)
+	}
+	return m
+}
+
+// run executes a command and feeds its messages back, as the program would
+func run(m Model, cmd tea.Cmd) Model {
+	if cmd == nil {
+		return m
+	}
+	switch msg := cmd().(type) {
+	case tea.BatchMsg:
+		for _, c := range msg {
+			m = run(m, c)
+		}
+	case probeMsg:
+		next, cmd := m.Update(msg)
+		m = run(next.(Model), cmd)
+	}
+	return m
+}
+
+func names(machines []service.Machine) string {
+	var n []string
+	for _, mc := range machines {
+		n = append(n, mc.Name)
+	}
+	return strings.Join(n, ", ")
+}
+
+func visibleNames(m Model) string {
+	var n []string
+	for _, i := range m.visible {
+		n = append(n, m.machines[i].Name)
+	}
+	return strings.Join(n, ", ")
+}
+
+func TestFilter(t *testing.T) {
+	m := press(newModel(&saved{}), "/", "nor", "enter")
+	if got := visibleNames(m); got != "Piassa, Shiro Meda" {
+		t.Errorf("filter by region shows %q", got)
+	}
+	if !strings.Contains(m.View(), "2 of 4 ATMs") {
+		t.Error("header does not count the filtered ATMs")
+	}
+
+	m = press(m, "/", "backspace", "backspace", "backspace", "10.20.3", "enter")
+	if got := visibleNames(m); got != "Kality" {
+		t.Errorf("filter by IP shows %q", got)
+	}
+
+	m = press(m, "esc")
+	if got := visibleNames(m); got != "Bole, Piassa, Kality, Shiro Meda" {
+		t.Errorf("esc leaves %q", got)
+	}
+}
+
+func TestSelectAndDelete(t *testing.T) {
+	s := &saved{}
+	m := press(newModel(s), "space", "down", "space")
+	if len(m.selected) != 2 || !m.selected["bole"] || !m.selected["kality"] {
+		t.Fatalf("selected = %v, want Bole and Kality", m.selected)
+	}
+
+	m = press(m, "d")
+	if !strings.Contains(m.View(), "Delete Bole, Kality? (y/N)") {
+		t.Errorf("confirmation missing from view:\n%s", m.View())
+	}
+	m = press(m, "n")
+	if s.calls != 0 || m.message != "Cancelled" {
+		t.Fatalf("answering n saved %d time(s), message %q", s.calls, m.message)
+	}
+
+	m = press(m, "d", "y")
+	if got := names(s.machines); got != "Piassa, Shiro Meda" {
+		t.Errorf("saved %q after deleting", got)
+	}
+	if len(s.changes) != 2 || s.changes[0].Before.Name != "Bole" || s.changes[0].After != nil {
+		t.Errorf("changes = %+v, want two deletions", s.changes)
+	}
+	if s.summary != "Deleted 2 ATM(s): Bole, Kality" {
+		t.Errorf("summary = %q", s.summary)
+	}
+	if len(m.selected) != 0 {
+		t.Errorf("deleted ATMs still selected: %v", m.selected)
+	}
+}
+
+func TestDeleteKeepsHiddenSelection(t *testing.T) {
+	s := &saved{}
+	// select Bole, then filter it out and select Piassa
+	m := press(newModel(s), "space", "/", "north", "enter", "g", "space")
+
+	m = press(m, "d")
+	view := m.View()
+	if !strings.Contains(view, "Delete Piassa? (y/N)") || !strings.Contains(view, "1 selected ATM(s) hidden by the filter are kept") {
+		t.Errorf("confirmation does not show the hidden selection:\n%s", view)
+	}
+	m = press(m, "y")
+	if got := names(s.machines); got != "Bole, Kality, Shiro Meda" {
+		t.Errorf("saved %q, want only Piassa deleted", got)
+	}
+	if !m.selected["bole"] {
+		t.Error("hidden Bole lost its selection")
+	}
+}
+
+func TestDeleteUnderCursor(t *testing.T) {
+	s := &saved{}
+	press(newModel(s), "/", "kal", "enter", "d", "y")
+	if got := names(s.machines); got != "Bole, Piassa, Shiro Meda" {
+		t.Errorf("saved %q, want Kality deleted", got)
+	}
+}
+
+func TestAdd(t *testing.T) {
+	s := &saved{}
+	m := press(newModel(s), "a", "CMC", "tab", "10.20.5.10", "tab", "East", "enter")
+	if s.calls != 1 {
+		t.Fatalf("Save called %d times", s.calls)
+	}
+	if got := s.machines[len(s.machines)-1]; got.Name != "CMC" || got.IP != "10.20.5.10" || got.Region != "East" {
+		t.Errorf("added %+v", got)
+	}
+	if len(s.changes) != 1 || s.changes[0].Before != nil || s.changes[0].After.Name != "CMC" {
+		t.Errorf("changes = %+v, want one addition", s.changes)
+	}
+	if m.mode != modeBrowse {
+		t.Error("form still open after saving")
+	}
+	if cur, _ := m.current(); cur.Name != "CMC" {
+		t.Errorf("cursor on %q, want the new ATM", cur.Name)
+	}
+}
+
+func TestAddRejected(t *testing.T) {
+	s := &saved{}
+	m := press(newModel(s), "a", "bole", "tab", "10.20.5.10", "enter")
+	if s.calls != 0 {
+		t.Error("a duplicate ATM was saved")
+	}
+	if m.mode != modeEdit || !strings.Contains(m.message, "already exists") {
+		t.Errorf("mode %v, message %q, want the form open with the error", m.mode, m.message)
+	}
+
+	m = press(m, "esc")
+	if m.mode != modeBrowse || len(m.machines) != 4 {
+		t.Error("esc did not cancel the add")
+	}
+}
+
+func TestEdit(t *testing.T) {
+	s := &saved{}
+	m := press(newModel(s), "down", "e", "tab")
+	for range len("10.20.2.10") {
+		m = press(m, "backspace")
+	}
+	m = press(m, "10.20.2.20", "enter")
+
+	if s.calls != 1 || s.machines[1].IP != "10.20.2.20" || s.machines[1].Region != "North" {
+		t.Fatalf("saved %+v", s.machines)
+	}
+	if s.summary != "Edited ATM Piassa: IP 10.20.2.10 → 10.20.2.20" {
+		t.Errorf("summary = %q", s.summary)
+	}
+	if c := s.changes[0]; c.Before.IP != "10.20.2.10" || c.After.IP != "10.20.2.20" {
+		t.Errorf("change = %+v", c)
+	}
+
+	// saving the form unchanged writes nothing
+	m = press(m, "e", "enter")
+	if s.calls != 1 || m.message != "No changes" {
+		t.Errorf("unchanged edit: %d saves, message %q", s.calls, m.message)
+	}
+}
+
+func TestSaveFailureKeepsList(t *testing.T) {
+	s := &saved{fail: errors.New("disk full")}
+	m := press(newModel(s), "d", "y")
+	if len(m.Machines()) != 4 {
+		t.Error("the list changed although saving failed")
+	}
+	if m.message != "Error: disk full" {
+		t.Errorf("message = %q", m.message)
+	}
+}
+
+func TestSaveAdoptsChangesMadeElsewhere(t *testing.T) {
+	s := &saved{}
+	m := newModel(s)
+	// atmer atm add, run in another terminal while the manager is open
+	s.machines = append(s.machines, service.Machine{Name: "Ayat", IP: "10.20.6.10"})
+
+	m = press(m, "d", "y")
+	if got := names(s.machines); got != "Piassa, Kality, Shiro Meda, Ayat" {
+		t.Errorf("stored %q, want Ayat kept", got)
+	}
+	if got := names(m.Machines()); got != "Piassa, Kality, Shiro Meda, Ayat" {
+		t.Errorf("manager shows %q, want the list as saved", got)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	m := newModel(&saved{})
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("p")})
+	m = next.(Model)
+	if !m.probes["bole"].running {
+		t.Fatal("no ping running after p")
+	}
+	m = run(m, cmd)
+	if st := m.probes["bole"]; st.running || !st.ok || st.rtt != 2*time.Millisecond {
+		t.Errorf("Bole probe = %+v", st)
+	}
+
+	// P pings the selection
+	m = press(m, "down", "space", "space", "P")
+	if st := m.probes["kality"]; st.running || st.ok {
+		t.Errorf("Kality probe = %+v, want down", st)
+	}
+	if st := m.probes["piassa"]; st.running || !st.ok {
+		t.Errorf("Piassa probe = %+v, want up", st)
+	}
+	if _, ok := m.probes["shiro meda"]; ok {
+		t.Error("an unselected ATM was pinged")
+	}
+}
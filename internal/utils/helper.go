@@ -4,17 +4,31 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"html/template"
+	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/fahmaliyi/atmer/internal/i18n"
 	"github.com/fahmaliyi/atmer/internal/service"
 	xlsx "github.com/tealeg/xlsx/v3"
 	"github.com/xuri/excelize/v2"
 )
 
 func LoadMachines(path string) ([]service.Machine, error) {
+	return LoadSheet(path, "")
+}
+
+// LoadSheet reads the ATMs on the named sheet, or the first sheet when
+// sheet is empty
+func LoadSheet(path, sheet string) ([]service.Machine, error) {
 	path = filepath.Clean(path)
+	start := time.Now()
 
 	f, err := os.Open(path)
 	if err != nil {
@@ -26,41 +40,336 @@ func LoadMachines(path string) ([]service.Machine, error) {
 	if err != nil {
 		return nil, err
 	}
-	rows, err := file.GetRows(file.GetSheetName(0))
+	if sheet == "" {
+		sheet = file.GetSheetName(0)
+	} else if idx, err := file.GetSheetIndex(sheet); err != nil || idx < 0 {
+		return nil, fmt.Errorf("no sheet named %q (sheets: %s)", sheet, strings.Join(file.GetSheetList(), ", "))
+	}
+	rows, err := file.GetRows(sheet)
 	if err != nil {
 		return nil, err
 	}
 
+	cols := defaultColumns
+	if len(rows) > 0 {
+		if header, ok := parseHeader(rows[0]); ok {
+			cols = header
+			rows = rows[1:]
+		}
+	}
+
 	var machines []service.Machine
 	for _, row := range rows {
-		if len(row) >= 2 {
-			name := strings.TrimSpace(row[0])
-			ip := strings.TrimSpace(row[1])
-			if name != "" && ip != "" {
-				machines = append(machines, service.Machine{Name: name, IP: ip})
+		name := cols.get(row, "name")
+		ip := cols.get(row, "ip")
+		if name == "" || ip == "" {
+			continue
+		}
+
+		links, err := service.ParseLinks(cols.get(row, "links"))
+		if err != nil {
+			return nil, fmt.Errorf("row for %s: %w", name, err)
+		}
+		maintenance := cols.get(row, "maintenance")
+		if maintenance != "" {
+			if _, err := service.ParseMaintenance(maintenance); err != nil {
+				return nil, fmt.Errorf("row for %s: %w", name, err)
 			}
 		}
+		machines = append(machines, service.Machine{
+			Name:   name,
+			IP:     ip,
+			Region: cols.get(row, "region"),
+			Links:  links,
+
+			Maintenance: maintenance,
+		})
 	}
+	slog.Debug("inventory loaded", "path", path, "sheet", sheet, "atms", len(machines), "took", time.Since(start))
 	return machines, nil
 }
 
+// columns maps a column's meaning to its position in the sheet
+type columns map[string]int
+
+// defaultColumns is the layout of sheets without a header row
+var defaultColumns = columns{"name": 0, "ip": 1, "region": 2, "links": 3, "maintenance": 4}
+
+// headerNames maps accepted header texts to column meanings
+var headerNames = map[string]string{
+	"name":       "name",
+	"atm":        "name",
+	"ip":         "ip",
+	"ip address": "ip",
+	"region":     "region",
+	"links":      "links",
+
+	"maintenance": "maintenance",
+}
+
+// parseHeader recognises a header row by its Name and IP columns
+func parseHeader(row []string) (columns, bool) {
+	cols := columns{}
+	for i, cell := range row {
+		if meaning, ok := headerNames[strings.ToLower(strings.TrimSpace(cell))]; ok {
+			if _, seen := cols[meaning]; !seen {
+				cols[meaning] = i
+			}
+		}
+	}
+
+	_, hasName := cols["name"]
+	_, hasIP := cols["ip"]
+	return cols, hasName && hasIP
+}
+
+// get returns the trimmed cell for a column, or "" when absent
+func (c columns) get(row []string, meaning string) string {
+	i, ok := c[meaning]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+// SaveMachines writes the ATMs to the first sheet of the Excel file at path
 func SaveMachines(machines []service.Machine, path string) error {
+	return SaveSheet(machines, path, "")
+}
+
+// SaveSheet writes the ATMs to the named sheet of the Excel file at path,
+// or the first sheet when sheet is empty. An existing workbook is updated
+// in place: rows are matched to ATMs by name, then by IP, and only the
+// cells of the columns LoadSheet reads are rewritten, so other sheets,
+// other columns and the header stay as they were. New ATMs go below the
+// last row and the rows of removed ones are deleted.
+func SaveSheet(machines []service.Machine, path, sheet string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) && sheet == "" {
+		return newWorkbook(machines, path)
+	}
+
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if sheet == "" {
+		sheet = f.GetSheetName(0)
+	} else if idx, err := f.GetSheetIndex(sheet); err != nil || idx < 0 {
+		return fmt.Errorf("no sheet named %q (sheets: %s)", sheet, strings.Join(f.GetSheetList(), ", "))
+	}
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		return err
+	}
+
+	cols, first, header := defaultColumns, 0, false
+	if len(rows) > 0 {
+		if h, ok := parseHeader(rows[0]); ok {
+			cols, first, header = h, 1, true
+		}
+	}
+
+	// a column the sheet lacks is added after its last one, when needed
+	width := 0
+	for _, r := range rows {
+		width = max(width, len(r))
+	}
+	values := func(m service.Machine) map[string]string {
+		return map[string]string{
+			"name":        m.Name,
+			"ip":          m.IP,
+			"region":      m.Region,
+			"links":       service.FormatLinks(m.Links),
+			"maintenance": m.Maintenance,
+		}
+	}
+	for _, meaning := range columnOrder {
+		if _, ok := cols[meaning]; ok {
+			continue
+		}
+		if !slices.ContainsFunc(machines, func(m service.Machine) bool { return values(m)[meaning] != "" }) {
+			continue
+		}
+		cols = maps.Clone(cols)
+		cols[meaning] = width
+		if header {
+			cell, _ := excelize.CoordinatesToCellName(width+1, 1)
+			f.SetCellValue(sheet, cell, columnTitles[meaning])
+		}
+		width++
+	}
+
+	// the data rows, as LoadSheet sees them
+	var existing []int
+	for i := first; i < len(rows); i++ {
+		if cols.get(rows[i], "name") != "" && cols.get(rows[i], "ip") != "" {
+			existing = append(existing, i)
+		}
+	}
+	target := make([]int, len(machines))
+	used := make([]bool, len(existing))
+	for i := range target {
+		target[i] = -1
+	}
+	for _, meaning := range []string{"name", "ip"} {
+		for i, m := range machines {
+			if target[i] >= 0 {
+				continue
+			}
+			for k, r := range existing {
+				if !used[k] && strings.EqualFold(cols.get(rows[r], meaning), values(m)[meaning]) {
+					target[i], used[k] = r, true
+					break
+				}
+			}
+		}
+	}
+
+	next := len(rows)
+	for i, m := range machines {
+		row := target[i]
+		if row < 0 {
+			row, next = next, next+1
+		}
+		for meaning, v := range values(m) {
+			col, ok := cols[meaning]
+			if !ok {
+				continue
+			}
+			cell, _ := excelize.CoordinatesToCellName(col+1, row+1)
+			if err := f.SetCellValue(sheet, cell, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	// bottom up, so the rows still to delete keep their numbers
+	for k := len(existing) - 1; k >= 0; k-- {
+		if !used[k] {
+			if err := f.RemoveRow(sheet, existing[k]+1); err != nil {
+				return err
+			}
+		}
+	}
+	return f.Save()
+}
+
+// columnOrder is the order of the columns in a new sheet
+var columnOrder = []string{"name", "ip", "region", "links", "maintenance"}
+
+// columnTitles are the header texts of a new sheet's columns
+var columnTitles = map[string]string{
+	"name":        "Name",
+	"ip":          "IP",
+	"region":      "Region",
+	"links":       "Links",
+	"maintenance": "Maintenance",
+}
+
+// newWorkbook writes the ATMs to a new single-sheet workbook
+func newWorkbook(machines []service.Machine, path string) error {
 	f := excelize.NewFile()
 	sheet := f.GetSheetName(0)
 
-	f.SetCellValue(sheet, "A1", "Name")
-	f.SetCellValue(sheet, "B1", "IP")
+	for i, meaning := range columnOrder {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
+		f.SetCellValue(sheet, cell, columnTitles[meaning])
+	}
 
 	for i, m := range machines {
 		row := i + 2
 		f.SetCellValue(sheet, fmt.Sprintf("A%d", row), m.Name)
 		f.SetCellValue(sheet, fmt.Sprintf("B%d", row), m.IP)
+		if m.Region != "" {
+			f.SetCellValue(sheet, fmt.Sprintf("C%d", row), m.Region)
+		}
+		if len(m.Links) > 0 {
+			f.SetCellValue(sheet, fmt.Sprintf("D%d", row), service.FormatLinks(m.Links))
+		}
+		if m.Maintenance != "" {
+			f.SetCellValue(sheet, fmt.Sprintf("E%d", row), m.Maintenance)
+		}
 	}
 
 	return f.SaveAs(path)
 }
 
-func WriteResults(results []service.PingResult, output, format string, excludeOffline bool) error {
+// Report is what a report run hands the writers
+type Report struct {
+	Generated time.Time
+	Results   []service.PingResult // the ATMs to list, already filtered
+	Counts    []StatusCount        // every ATM swept
+
+	// Selection describes the ATMs a partial sweep covered; empty when the
+	// whole inventory was swept
+	Selection string
+	Swept     int
+	Inventory int
+}
+
+// Partial reports whether only some of the inventory was swept
+func (r Report) Partial() bool {
+	return r.Selection != ""
+}
+
+// Heading is the partial sweep note the writers put on top, or ""
+func (r Report) Heading() string {
+	if !r.Partial() {
+		return ""
+	}
+	return i18n.Sprintf("Partial sweep: %d of %d ATMs (%s)", r.Swept, r.Inventory, r.Selection)
+}
+
+// StatusCount is the number of ATMs with a status
+type StatusCount struct {
+	Status string `json:"status"`
+	Count  int    `json:"count"`
+}
+
+// jsonReport is the JSON output
+type jsonReport struct {
+	Generated time.Time            `json:"generated"`
+	Partial   bool                 `json:"partial"`
+	Selection string               `json:"selection,omitempty"`
+	Swept     int                  `json:"swept"`
+	Inventory int                  `json:"inventory"`
+	Counts    []StatusCount        `json:"counts"`
+	Results   []service.PingResult `json:"results"`
+}
+
+// LoadResults reads the results of a JSON report, including the plain
+// result lists older versions wrote
+func LoadResults(path string) ([]service.PingResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []service.PingResult
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		err = json.Unmarshal(data, &results)
+		return results, err
+	}
+
+	var report jsonReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return report.Results, nil
+}
+
+func WriteResults(report Report, output, format string) (err error) {
+	start := time.Now()
+	defer func() {
+		if err != nil {
+			slog.Warn("report write failed", "path", output, "format", format, "err", err)
+		} else {
+			slog.Debug("report written", "path", output, "format", format, "results", len(report.Results), "took", time.Since(start))
+		}
+	}()
+
 	// Delete existing file if it exists
 	if _, err := os.Stat(output); err == nil {
 		err = os.Remove(output)
@@ -72,83 +381,177 @@ func WriteResults(results []service.PingResult, output, format string, excludeOf
 	// Proceed to write new file
 	switch format {
 	case "json":
-		return writeJSON(results, output, excludeOffline)
+		return writeJSON(report, output)
 	case "csv":
-		return writeCSV(results, output, excludeOffline)
+		return writeCSV(report, output)
 	case "xlsx":
-		return writeXLSX(results, output, excludeOffline)
+		return writeXLSX(report, output)
+	case "html":
+		return writeHTML(report, output)
 	default:
-		return writeTXT(results, output, excludeOffline)
+		return writeTXT(report, output)
 	}
 }
 
-func writeJSON(results []service.PingResult, output string, excludeOffline bool) error {
-	filtered := filterResults(results, excludeOffline)
-	data, err := json.MarshalIndent(filtered, "", "  ")
+func writeJSON(report Report, output string) error {
+	results := report.Results
+	if results == nil {
+		results = []service.PingResult{}
+	}
+	data, err := json.MarshalIndent(jsonReport{
+		Generated: report.Generated,
+		Partial:   report.Partial(),
+		Selection: report.Selection,
+		Swept:     report.Swept,
+		Inventory: report.Inventory,
+		Counts:    report.Counts,
+		Results:   results,
+	}, "", "  ")
 	if err != nil {
 		return err
 	}
 	return os.WriteFile(output, data, 0644)
 }
 
-func writeXLSX(results []service.PingResult, output string, excludeOffline bool) error {
-	filtered := filterResults(results, excludeOffline)
+func writeXLSX(report Report, output string) error {
+	results := report.Results
 	file := xlsx.NewFile()
 	sheet, err := file.AddSheet("Results")
 	if err != nil {
 		return err
 	}
 
+	if report.Partial() {
+		sheet.AddRow().AddCell().Value = report.Heading()
+	}
+
 	row := sheet.AddRow()
-	row.AddCell().Value = "Name"
-	row.AddCell().Value = "IP"
-	row.AddCell().Value = "Status"
+	for _, h := range resultHeader() {
+		row.AddCell().Value = h
+	}
 
-	for _, r := range filtered {
+	for _, r := range results {
 		row := sheet.AddRow()
 		row.AddCell().Value = r.Name
 		row.AddCell().Value = r.IP
 		row.AddCell().Value = r.Status
+		row.AddCell().Value = r.Cause
+		row.AddCell().Value = r.LastHop
+		row.AddCell().Value = r.Maintenance
+		row.AddCell().SetInt(r.Attempts)
 	}
 
 	return file.Save(output)
 }
 
-func writeCSV(results []service.PingResult, output string, excludeOffline bool) error {
-	filtered := filterResults(results, excludeOffline)
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{"T": i18n.T}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{T "ATM connectivity report"}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #eee; }
+.Online { color: #080; }
+.OnlyADSL { color: #b80; }
+.Offline, .Unresolved { color: #c00; }
+.Maintenance { color: #888; }
+</style>
+</head>
+<body>
+<h1>{{T "ATM connectivity report"}}</h1>
+{{with .Heading}}<p><strong>{{.}}</strong></p>
+{{end}}<p>{{range $i, $c := .Counts}}{{if $i}} · {{end}}{{T $c.Status}}: {{$c.Count}}{{end}}</p>
+<table>
+<tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr>
+{{range .Results}}<tr><td>{{.Name}}</td><td>{{.IP}}</td><td class="{{.Status}}">{{T .Status}}</td><td>{{.Cause}}</td><td>{{.LastHop}}</td><td>{{.Maintenance}}</td><td>{{.Attempts}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func writeHTML(report Report, output string) error {
 	f, err := os.Create(output)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	w := csv.NewWriter(f)
-	defer w.Flush()
+	return htmlReport.Execute(f, struct {
+		Report
+		Header []string
+	}{report, resultHeader()})
+}
 
-	w.Write([]string{"Name", "IP", "Status"})
-	for _, r := range filtered {
-		w.Write([]string{r.Name, r.IP, r.Status})
+// resultHeader is the header row of the tabular outputs
+func resultHeader() []string {
+	header := []string{"Name", "IP", "Status", "Suspected Cause", "Last Hop", "Maintenance", "Attempts"}
+	for i, h := range header {
+		header[i] = i18n.T(h)
 	}
-
-	return nil
+	return header
 }
 
-func writeTXT(results []service.PingResult, output string, excludeOffline bool) error {
-	grouped := map[string][]string{
-		"OnlyADSL": {},
+func writeCSV(report Report, output string) error {
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if report.Partial() {
+		w.Write([]string{report.Heading()})
 	}
-	// Include Offline only if excludeOffline is false
-	if !excludeOffline {
-		grouped["Offline"] = []string{}
+	w.Write(resultHeader())
+	for _, r := range report.Results {
+		w.Write([]string{r.Name, r.IP, r.Status, r.Cause, r.LastHop, r.Maintenance, strconv.Itoa(r.Attempts)})
 	}
 
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeTXT(report Report, output string) error {
+	results := report.Results
+
+	// Offline and OnlyADSL first, then any other status (such as
+	// Unresolved or those from the status table) in order of appearance,
+	// and Online last.
+	// ATMs with a suspected cause are listed under it instead, and those
+	// under maintenance in a section of their own.
+	order := []string{"Offline", "OnlyADSL"}
+	grouped := map[string][]string{}
+	var causes []string
+	byCause := map[string][]string{}
+	var maintenance []string
 	for _, r := range results {
-		if r.Status == "OnlyADSL" {
-			grouped["OnlyADSL"] = append(grouped["OnlyADSL"], r.Name)
-		} else if r.Status == "Offline" && !excludeOffline {
-			grouped["Offline"] = append(grouped["Offline"], r.Name)
+		if r.Maintenance != "" {
+			if r.Status == service.StatusMaintenance {
+				maintenance = append(maintenance, fmt.Sprintf("%s: %s", r.Name, r.Maintenance))
+			} else {
+				maintenance = append(maintenance, fmt.Sprintf("%s (%s): %s", r.Name, i18n.T(r.Status), r.Maintenance))
+			}
+			continue
+		}
+		if r.Cause != "" {
+			if _, seen := byCause[r.Cause]; !seen {
+				causes = append(causes, r.Cause)
+			}
+			byCause[r.Cause] = append(byCause[r.Cause], r.Name)
+			continue
+		}
+		if _, seen := grouped[r.Status]; !seen && r.Status != "Offline" && r.Status != "OnlyADSL" && r.Status != "Online" {
+			order = append(order, r.Status)
 		}
+		grouped[r.Status] = append(grouped[r.Status], r.Name)
 	}
+	order = append(order, "Online")
 
 	f, err := os.Create(output)
 	if err != nil {
@@ -156,37 +559,52 @@ func writeTXT(results []service.PingResult, output string, excludeOffline bool)
 	}
 	defer f.Close()
 
+	if report.Partial() {
+		f.WriteString(report.Heading() + "\n\n")
+	}
+
+	if len(causes) > 0 {
+		f.WriteString(i18n.T("Suspected causes:") + "\n")
+		for _, cause := range causes {
+			f.WriteString(fmt.Sprintf("%s: %s\n", cause, strings.Join(byCause[cause], ", ")))
+		}
+		f.WriteString("\n")
+	}
+
 	// Iterate statuses depending on presence in grouped
-	for _, status := range []string{"Offline", "OnlyADSL"} {
+	for _, status := range order {
 		names, exists := grouped[status]
 		if !exists || len(names) == 0 {
 			continue
 		}
 
 		// Comma-separated
-		f.WriteString(fmt.Sprintf("%s:\n", status))
+		f.WriteString(fmt.Sprintf("%s:\n", i18n.T(status)))
 		f.WriteString(strings.Join(names, ", ") + "\n\n")
 
 		// Newline-separated
-		f.WriteString(fmt.Sprintf("%s:\n", status))
+		f.WriteString(fmt.Sprintf("%s:\n", i18n.T(status)))
 		for _, name := range names {
 			f.WriteString(name + "\n")
 		}
 		f.WriteString("\n")
 	}
 
-	return nil
-}
-
-func filterResults(results []service.PingResult, excludeOffline bool) []service.PingResult {
-	if !excludeOffline {
-		return results
+	if len(maintenance) > 0 {
+		f.WriteString(i18n.T("Under maintenance:") + "\n")
+		f.WriteString(strings.Join(maintenance, "\n") + "\n\n")
 	}
-	filtered := make([]service.PingResult, 0, len(results))
+
+	var traced []string
 	for _, r := range results {
-		if r.Status != "Offline" {
-			filtered = append(filtered, r)
+		if r.LastHop != "" {
+			traced = append(traced, fmt.Sprintf("%s: %s", r.Name, r.LastHop))
 		}
 	}
-	return filtered
+	if len(traced) > 0 {
+		f.WriteString(i18n.T("Last responding hop:") + "\n")
+		f.WriteString(strings.Join(traced, "\n") + "\n")
+	}
+
+	return nil
 }
@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/xuri/excelize/v2"
+)
+
+// writeSheet creates a workbook whose first sheet holds rows
+func writeSheet(t *testing.T, path string, rows [][]any) {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	sheet := f.GetSheetName(0)
+	f.SetSheetName(sheet, "ATMs")
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := f.SetSheetRow("ATMs", cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.NewSheet("Contacts")
+	f.SetCellValue("Contacts", "A1", "NOC")
+	f.SetCellValue("Contacts", "B1", "+251 11 000 0000")
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readRows(t *testing.T, path, sheet string) [][]string {
+	t.Helper()
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestSaveMachinesKeepsWorkbook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "atms.xlsx")
+	writeSheet(t, path, [][]any{
+		{"Notes", "IP Address", "ATM", "Region"},
+		{"lobby", "10.20.1.10", "Bole", "Central"},
+		{"kiosk", "10.20.2.10", "Piassa", "North"},
+		{"closed on sundays", "10.20.3.10", "Kality", "South"},
+		{"spare row, no ATM"},
+		{"mall", "10.20.4.10", "CMC", "East"},
+	})
+
+	machines, err := LoadMachines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(machines) != 4 {
+		t.Fatalf("loaded %d ATMs, want 4", len(machines))
+	}
+
+	// edit Bole, rename Piassa, drop Kality, add one under maintenance
+	machines[0].Region = "West"
+	machines[1].Name = "Piassa Main"
+	machines = slices.Delete(machines, 2, 3)
+	machines = append(machines, service.Machine{Name: "Megenagna", IP: "10.20.5.10", Maintenance: "branch refit"})
+	if err := SaveMachines(machines, path); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"Notes", "IP Address", "ATM", "Region", "Maintenance"},
+		{"lobby", "10.20.1.10", "Bole", "West"},
+		{"kiosk", "10.20.2.10", "Piassa Main", "North"},
+		{"spare row, no ATM"},
+		{"mall", "10.20.4.10", "CMC", "East"},
+		{"", "10.20.5.10", "Megenagna", "", "branch refit"},
+	}
+	got := readRows(t, path, "ATMs")
+	if len(got) != len(want) {
+		t.Fatalf("sheet has %d rows, want %d: %q", len(got), len(want), got)
+	}
+	for i := range want {
+		if !slices.Equal(got[i], want[i]) {
+			t.Errorf("row %d = %q, want %q", i+1, got[i], want[i])
+		}
+	}
+
+	contacts := readRows(t, path, "Contacts")
+	if len(contacts) != 1 || !slices.Equal(contacts[0], []string{"NOC", "+251 11 000 0000"}) {
+		t.Errorf("Contacts sheet = %q, want it unchanged", contacts)
+	}
+
+	reloaded, err := LoadMachines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded) != len(machines) {
+		t.Fatalf("reloaded %d ATMs, want %d", len(reloaded), len(machines))
+	}
+	for i := range machines {
+		if !reloaded[i].Equal(machines[i]) {
+			t.Errorf("ATM %d reloaded as %+v, want %+v", i, reloaded[i], machines[i])
+		}
+	}
+}
+
+func TestSaveMachinesHeaderless(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "atms.xlsx")
+	writeSheet(t, path, [][]any{
+		{"Bole", "10.20.1.10", "Central"},
+		{"Piassa", "10.20.2.10", "North"},
+	})
+
+	machines, err := LoadMachines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machines[1].IP = "10.20.2.20"
+	if err := SaveMachines(machines, path); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readRows(t, path, "ATMs")
+	want := [][]string{{"Bole", "10.20.1.10", "Central"}, {"Piassa", "10.20.2.20", "North"}}
+	if len(got) != len(want) || !slices.Equal(got[0], want[0]) || !slices.Equal(got[1], want[1]) {
+		t.Errorf("sheet = %q, want %q without a header added", got, want)
+	}
+}
+
+func TestSaveMachinesNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "atms.xlsx")
+	machines := []service.Machine{{Name: "Bole", IP: "10.20.1.10", Region: "Central"}}
+	if err := SaveMachines(machines, path); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadMachines(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !got[0].Equal(machines[0]) {
+		t.Errorf("reloaded %+v, want %+v", got, machines)
+	}
+}
+
+func TestWriteCSVMarksPartialSweep(t *testing.T) {
+	dir := t.TempDir()
+	results := []service.PingResult{{Name: "Bole", IP: "10.20.1.10", Status: "Offline", Attempts: 2}}
+
+	full := filepath.Join(dir, "full.csv")
+	if err := WriteResults(Report{Results: results, Swept: 4, Inventory: 4}, full, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	partial := filepath.Join(dir, "partial.csv")
+	if err := WriteResults(Report{Results: results, Selection: "region=North", Swept: 1, Inventory: 4}, partial, "csv"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		path  string
+		first string
+	}{
+		{full, "Name,IP,Status,Suspected Cause,Last Hop,Maintenance,Attempts"},
+		{partial, "Partial sweep: 1 of 4 ATMs (region=North)"},
+	} {
+		data, err := os.ReadFile(c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if lines[0] != c.first {
+			t.Errorf("%s starts with %q, want %q", filepath.Base(c.path), lines[0], c.first)
+		}
+		if last := lines[len(lines)-1]; last != "Bole,10.20.1.10,Offline,,,,2" {
+			t.Errorf("%s ends with %q", filepath.Base(c.path), last)
+		}
+	}
+}
+
+func TestSaveMachinesMatchesRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "atms.xlsx")
+	writeSheet(t, path, [][]any{
+		{"ATM", "IP Address", "Notes"},
+		{"Bole", "10.20.1.10", "lobby"},
+		{"Piassa", "10.20.2.10", "kiosk"},
+		{"Kality", "10.20.3.10", "closed on sundays"},
+		{"CMC", "10.20.4.10", "mall"},
+		{"Ayat", "10.20.5.10", "drive-through"},
+	})
+
+	machines := []service.Machine{
+		// Bole and Piassa swap addresses: matched by name, not by IP
+		{Name: "bole", IP: "10.20.2.10"},
+		{Name: "Piassa", IP: "10.20.1.10"},
+		// renamed: matched by IP, keeping its notes
+		{Name: "CMC Mall", IP: "10.20.4.10"},
+		// renamed and readdressed: no row matches, so a new one is added
+		{Name: "Megenagna", IP: "10.20.6.10"},
+	}
+	if err := SaveMachines(machines, path); err != nil {
+		t.Fatal(err)
+	}
+
+	// the unmatched Kality and Ayat rows are deleted
+	want := [][]string{
+		{"ATM", "IP Address", "Notes"},
+		{"bole", "10.20.2.10", "lobby"},
+		{"Piassa", "10.20.1.10", "kiosk"},
+		{"CMC Mall", "10.20.4.10", "mall"},
+		{"Megenagna", "10.20.6.10"},
+	}
+	got := readRows(t, path, "ATMs")
+	if len(got) != len(want) {
+		t.Fatalf("sheet has %d rows, want %d: %q", len(got), len(want), got)
+	}
+	for i := range want {
+		if !slices.Equal(got[i], want[i]) {
+			t.Errorf("row %d = %q, want %q", i+1, got[i], want[i])
+		}
+	}
+}
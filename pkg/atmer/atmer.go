@@ -0,0 +1,189 @@
+// Package atmer lets other Go programs sweep ATMs the way the atmer CLI
+// does: load the inventory from Excel, probe every ATM and its links, and
+// write the results as txt, csv, json, xlsx or html reports.
+//
+//	machines, err := atmer.LoadInventory("atms.xlsx")
+//	...
+//	var results []atmer.PingResult
+//	for r := range atmer.Sweep(ctx, machines, atmer.Options{Workers: 8}) {
+//		results = append(results, r.PingResult)
+//	}
+//	err = atmer.WriteReport(atmer.Report{Generated: time.Now(), Results: results}, "report.html")
+//
+// RunReport does what 'atmer report' does: sweep, group failures into
+// outages, trace the failing ATMs, keep the status history, write the
+// outputs and mail them. Probes, lookups and file access are logged
+// through log/slog's default logger.
+package atmer
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/fahmaliyi/atmer/internal/utils"
+)
+
+// Role is what a link is for; the status rules decide on roles
+type Role string
+
+const (
+	RolePrimary Role = "primary"
+	RoleBackup  Role = "backup"
+	RoleModem   Role = "modem"
+)
+
+// Link is one of an ATM's addresses besides its primary IP, e.g. a 4G
+// backup router
+type Link struct {
+	Name    string `json:"name"`
+	Role    Role   `json:"role"`
+	Address string `json:"address"`
+}
+
+// Machine is an ATM of the inventory
+type Machine struct {
+	IP     string `json:"ip"` // IPv4 or IPv6 address, or hostname
+	Name   string `json:"name"`
+	Region string `json:"region,omitempty"`
+	Links  []Link `json:"links,omitempty"`
+
+	// Maintenance puts the ATM under maintenance: a reason, an end date
+	// or both, e.g. "branch refit until 2026-11-01"
+	Maintenance string `json:"maintenance,omitempty"`
+}
+
+// PingResult is the outcome of probing one ATM
+type PingResult struct {
+	IP      string
+	Name    string
+	Status  string
+	Cause   string `json:",omitempty"` // suspected shared cause, see GroupOptions
+	LastHop string `json:",omitempty"` // last router answering a traceroute
+
+	// Attempts is how many times the ATM was probed, more than one when a
+	// failure was re-checked; 0 if it was not probed
+	Attempts int `json:",omitempty"`
+
+	// Maintenance describes the window the ATM is in; such ATMs are not
+	// counted or grouped into outages
+	Maintenance string `json:",omitempty"`
+}
+
+// StatusRule is one row of the status decision table. It holds when every
+// role in Up has a link that answers and no link of a role in Down does;
+// a rule with neither is a catch-all.
+type StatusRule struct {
+	Status string `json:"status"`
+	Up     []Role `json:"up,omitempty"`
+	Down   []Role `json:"down,omitempty"`
+}
+
+// Window is a maintenance period for one ATM or a whole region
+type Window struct {
+	ATM    string    // name or address
+	Region string    // the whole region, when ATM is empty
+	From   time.Time // zero: already started
+	Until  time.Time // zero: open-ended
+	Reason string
+	Probe  bool // probe anyway and report the status separately
+}
+
+// Active reports whether the window is open at now
+func (w Window) Active(now time.Time) bool {
+	return service.Window(w).Active(now)
+}
+
+// String describes the window the way reports show it
+func (w Window) String() string {
+	return service.Window(w).String()
+}
+
+// Report is what WriteReport writes
+type Report struct {
+	Generated time.Time
+	Results   []PingResult  // the ATMs to list
+	Counts    []StatusCount // every ATM swept
+
+	// Selection describes the ATMs a partial sweep covered, Swept of the
+	// Inventory; empty when the whole inventory was swept
+	Selection string
+	Swept     int
+	Inventory int
+}
+
+// Heading is the partial sweep note the reports put on top, or ""
+func (r Report) Heading() string {
+	return r.internal().Heading()
+}
+
+// StatusCount is the number of ATMs with a status, for Report.Counts
+type StatusCount struct {
+	Status string `json:"status"`
+	Count  int    `json:"count"`
+}
+
+// The statuses of the default decision table, and those a sweep sets
+// without one
+const (
+	StatusOnline      = "Online"
+	StatusOnBackup    = "OnBackup"
+	StatusOnlyADSL    = "OnlyADSL"
+	StatusOffline     = "Offline"
+	StatusUnresolved  = service.StatusUnresolved
+	StatusMaintenance = service.StatusMaintenance
+)
+
+// DefaultStatusRules is the decision table used when Options.Rules is nil
+var DefaultStatusRules = fromRules(service.DefaultStatusRules)
+
+// LoadInventory reads the ATMs on the first sheet of an Excel file
+func LoadInventory(path string) ([]Machine, error) {
+	return LoadSheet(path, "")
+}
+
+// LoadSheet reads the ATMs on the named sheet of an Excel file
+func LoadSheet(path, sheet string) ([]Machine, error) {
+	machines, err := utils.LoadSheet(path, sheet)
+	return fromMachines(machines), err
+}
+
+// SaveInventory writes the ATMs to an Excel file the CLI can read
+func SaveInventory(machines []Machine, path string) error {
+	return utils.SaveMachines(toMachines(machines), path)
+}
+
+// LoadResults reads the results of a JSON report
+func LoadResults(path string) ([]PingResult, error) {
+	results, err := utils.LoadResults(path)
+	return fromResults(results), err
+}
+
+// WriteReport writes the report to path, in the format its extension
+// names; see Format
+func WriteReport(report Report, path string) error {
+	return utils.WriteResults(report.internal(), path, Format(path))
+}
+
+// Format picks the report format for a file by its extension: json, csv,
+// xlsx, html, or txt for anything else
+func Format(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".csv":
+		return "csv"
+	case ".xlsx", ".xls":
+		return "xlsx"
+	case ".html", ".htm":
+		return "html"
+	default:
+		return "txt"
+	}
+}
+
+// ModemIP derives the ADSL modem's address from an ATM's primary IP
+func ModemIP(ip string) string {
+	return service.GetModemIP(ip)
+}
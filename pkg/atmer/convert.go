@@ -0,0 +1,121 @@
+package atmer
+
+import (
+	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/fahmaliyi/atmer/internal/utils"
+)
+
+// The public types mirror the CLI's own; these copy between the two so
+// the CLI's types can change without changing this package's API.
+
+func (m Machine) internal() service.Machine {
+	im := service.Machine{IP: m.IP, Name: m.Name, Region: m.Region, Maintenance: m.Maintenance}
+	for _, l := range m.Links {
+		im.Links = append(im.Links, service.Link{Name: l.Name, Role: service.Role(l.Role), Address: l.Address})
+	}
+	return im
+}
+
+func fromMachine(im service.Machine) Machine {
+	m := Machine{IP: im.IP, Name: im.Name, Region: im.Region, Maintenance: im.Maintenance}
+	for _, l := range im.Links {
+		m.Links = append(m.Links, Link{Name: l.Name, Role: Role(l.Role), Address: l.Address})
+	}
+	return m
+}
+
+func toMachines(machines []Machine) []service.Machine {
+	out := make([]service.Machine, len(machines))
+	for i, m := range machines {
+		out[i] = m.internal()
+	}
+	return out
+}
+
+func fromMachines(machines []service.Machine) []Machine {
+	if machines == nil {
+		return nil
+	}
+	out := make([]Machine, len(machines))
+	for i, m := range machines {
+		out[i] = fromMachine(m)
+	}
+	return out
+}
+
+func toResults(results []PingResult) []service.PingResult {
+	out := make([]service.PingResult, len(results))
+	for i, r := range results {
+		out[i] = service.PingResult(r)
+	}
+	return out
+}
+
+func fromResults(results []service.PingResult) []PingResult {
+	if results == nil {
+		return nil
+	}
+	out := make([]PingResult, len(results))
+	for i, r := range results {
+		out[i] = PingResult(r)
+	}
+	return out
+}
+
+func toRoles(roles []Role) []service.Role {
+	if roles == nil {
+		return nil
+	}
+	out := make([]service.Role, len(roles))
+	for i, r := range roles {
+		out[i] = service.Role(r)
+	}
+	return out
+}
+
+func toRules(rules []StatusRule) []service.StatusRule {
+	if rules == nil {
+		return nil
+	}
+	out := make([]service.StatusRule, len(rules))
+	for i, r := range rules {
+		out[i] = service.StatusRule{Status: r.Status, Up: toRoles(r.Up), Down: toRoles(r.Down)}
+	}
+	return out
+}
+
+func fromRules(rules []service.StatusRule) []StatusRule {
+	out := make([]StatusRule, len(rules))
+	for i, r := range rules {
+		out[i] = StatusRule{Status: r.Status}
+		for _, role := range r.Up {
+			out[i].Up = append(out[i].Up, Role(role))
+		}
+		for _, role := range r.Down {
+			out[i].Down = append(out[i].Down, Role(role))
+		}
+	}
+	return out
+}
+
+func toWindows(windows []Window) []service.Window {
+	out := make([]service.Window, len(windows))
+	for i, w := range windows {
+		out[i] = service.Window(w)
+	}
+	return out
+}
+
+func (r Report) internal() utils.Report {
+	ir := utils.Report{
+		Generated: r.Generated,
+		Results:   toResults(r.Results),
+		Selection: r.Selection,
+		Swept:     r.Swept,
+		Inventory: r.Inventory,
+	}
+	for _, c := range r.Counts {
+		ir.Counts = append(ir.Counts, utils.StatusCount(c))
+	}
+	return ir
+}
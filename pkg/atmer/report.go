@@ -0,0 +1,85 @@
+package atmer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Summary counts a sweep's results by status
+type Summary struct {
+	Counts      map[string]int // ATMs under maintenance are not counted here
+	Statuses    []string       // statuses in Counts besides the usual three, in order seen
+	Maintenance int            // ATMs under maintenance, whatever their status
+}
+
+// Summarize counts the results of a sweep
+func Summarize(results []PingResult) Summary {
+	s := Summary{Counts: map[string]int{}}
+	for _, r := range results {
+		switch {
+		case r.Maintenance != "":
+			// reported separately, whatever the status
+			s.Maintenance++
+		case r.Status == StatusOnline, r.Status == StatusOnlyADSL, r.Status == StatusOffline:
+			s.Counts[r.Status]++
+		default:
+			// Unresolved and statuses from a custom decision table
+			if s.Counts[r.Status] == 0 {
+				s.Statuses = append(s.Statuses, r.Status)
+			}
+			s.Counts[r.Status]++
+		}
+	}
+	return s
+}
+
+// StatusCounts lists the counts in report order, Maintenance last if any,
+// for Report.Counts
+func (s Summary) StatusCounts() []StatusCount {
+	counts := []StatusCount{
+		{Status: StatusOnline, Count: s.Counts[StatusOnline]},
+		{Status: StatusOnlyADSL, Count: s.Counts[StatusOnlyADSL]},
+		{Status: StatusOffline, Count: s.Counts[StatusOffline]},
+	}
+	for _, status := range s.Statuses {
+		counts = append(counts, StatusCount{Status: status, Count: s.Counts[status]})
+	}
+	if s.Maintenance > 0 {
+		counts = append(counts, StatusCount{Status: StatusMaintenance, Count: s.Maintenance})
+	}
+	return counts
+}
+
+// String sums up the counts on one line, e.g. for a log
+func (s Summary) String() string {
+	var parts []string
+	for _, c := range s.StatusCounts() {
+		parts = append(parts, fmt.Sprintf("%s %d", c.Status, c.Count))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ExpandOutput fills {date} and {time} into an output name, so scheduled
+// runs can keep one file per run
+func ExpandOutput(path string, now time.Time) string {
+	return strings.NewReplacer("{date}", now.Format("2006-01-02"), "{time}", now.Format("1504")).Replace(path)
+}
+
+// WriteReports writes the report to each output after ExpandOutput with
+// report.Generated, and returns the files written. A failed output does not
+// stop the others; the error joins every failure.
+func WriteReports(report Report, outputs []string) ([]string, error) {
+	var written []string
+	var errs []error
+	for _, output := range outputs {
+		output = ExpandOutput(output, report.Generated)
+		if err := WriteReport(report, output); err != nil {
+			errs = append(errs, fmt.Errorf("failed to write %s: %w", output, err))
+			continue
+		}
+		written = append(written, output)
+	}
+	return written, errors.Join(errs...)
+}
@@ -0,0 +1,55 @@
+package atmer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	s := Summarize([]PingResult{
+		{Name: "Bole", Status: StatusOnline},
+		{Name: "Piassa", Status: StatusOffline},
+		{Name: "Kality", Status: StatusUnresolved},
+		{Name: "CMC", Status: StatusOnBackup},
+		{Name: "Ayat", Status: StatusOffline, Maintenance: "new switch"},
+		{Name: "Megenagna", Status: StatusOnBackup},
+	})
+
+	// the usual three always, other statuses in order seen, Maintenance last
+	want := "Online 1, OnlyADSL 0, Offline 1, Unresolved 1, OnBackup 2, Maintenance 1"
+	if got := s.String(); got != want {
+		t.Errorf("summary = %q, want %q", got, want)
+	}
+	if got := Summarize(nil).String(); got != "Online 0, OnlyADSL 0, Offline 0" {
+		t.Errorf("empty summary = %q", got)
+	}
+}
+
+func TestWriteReports(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 19, 7, 5, 0, 0, time.UTC)
+	report := Report{Generated: now, Results: []PingResult{{Name: "Bole", IP: "10.20.1.10", Status: StatusOnline}}}
+
+	written, err := WriteReports(report, []string{
+		filepath.Join(dir, "report-{date}-{time}.csv"),
+		filepath.Join(dir, "missing", "report.json"),
+		filepath.Join(dir, "report.txt"),
+	})
+
+	// the failed output is reported and the others still written
+	if err == nil || !strings.Contains(err.Error(), "failed to write "+filepath.Join(dir, "missing", "report.json")) {
+		t.Errorf("err = %v, want the missing directory reported", err)
+	}
+	want := []string{filepath.Join(dir, "report-2026-10-19-0705.csv"), filepath.Join(dir, "report.txt")}
+	if strings.Join(written, ",") != strings.Join(want, ",") {
+		t.Errorf("written = %q, want %q", written, want)
+	}
+	for _, path := range want {
+		if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), "Bole") {
+			t.Errorf("%s: %v, %q", path, err, data)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package atmer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fahmaliyi/atmer/internal/i18n"
+	"github.com/fahmaliyi/atmer/internal/mail"
+	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/fahmaliyi/atmer/internal/storage"
+	"github.com/fahmaliyi/atmer/internal/trace"
+)
+
+// ReportOptions is one report run: the sweep, what to make of its
+// failures and where the report goes. The zero value sweeps and counts
+// without writing anything.
+type ReportOptions struct {
+	Options
+
+	// Filter picks the ATMs the report lists; nil lists every one. The
+	// counts always cover every ATM swept.
+	Filter func(m Machine, r PingResult) bool
+
+	Group    GroupOptions
+	Diagnose *TraceOptions // traceroute the Offline and OnlyADSL ATMs, when set
+
+	History string       // status history file to update, if any
+	Outputs []string     // files to write, see WriteReports
+	Mail    *MailOptions // where to send the summary and outputs, if anywhere
+
+	// Inventory and Selection describe a partial sweep for the report:
+	// the size of the whole inventory and which of its ATMs were picked
+	Inventory int
+	Selection string
+
+	// OnResult is called, if set, with each result as the sweep makes it
+	// final, before outages are grouped and failures traced
+	OnResult func(Result)
+	// OnDiagnose is called, if set, with the number of ATMs about to be
+	// traced, and OnTrace with each of their traces
+	OnDiagnose func(atms int)
+	OnTrace    func(r Result, t Trace)
+}
+
+// GroupOptions picks how failures are grouped into outages. Each failed
+// ATM is blamed on the first cause found: an unreachable upstream router,
+// then a region, then a subnet in which every ATM failed. Whether a status
+// is a failure follows the status rules: it is unless its rule needs the
+// primary link up.
+type GroupOptions struct {
+	ByUpstream bool
+	ByRegion   bool
+	BySubnet   bool
+	SubnetBits int // size of an IPv4 subnet, 0 meaning 24; IPv6 uses /64
+	MinSize    int // smallest group reported as one outage
+
+	// Upstreams maps a region to the address of its aggregation router,
+	// probed with Options.Probe
+	Upstreams map[string]string
+}
+
+func (g GroupOptions) enabled() bool {
+	return g.ByUpstream || g.ByRegion || g.BySubnet
+}
+
+// Outage is a group of failed ATMs blamed on one shared cause
+type Outage struct {
+	Kind    string // "upstream", "region" or "subnet"
+	Key     string // region name or subnet
+	Cause   string // e.g. "Region South uplink down (80 ATMs, 10.20.0.1 unreachable)"
+	Members []int  // indexes into the machines swept
+}
+
+// TraceOptions tune the traceroutes of failing ATMs; zero fields take the
+// usual traceroute limits
+type TraceOptions struct {
+	MaxHops     int           // give up after this many hops; 0 means 30
+	HopTimeout  time.Duration // wait for each hop's answer; 0 means 1s
+	Concurrency int           // ATMs traced at once; 0 means 8
+	Privileged  bool          // use raw ICMP sockets, which needs root
+
+	network trace.Network // for tests; nil means ICMP
+}
+
+// Trace is where the path to a failing ATM ends
+type Trace struct {
+	Target  netip.Addr
+	Reached bool       // the ATM itself answered
+	LastHop netip.Addr // last router that answered; invalid if none did
+	LastTTL int        // the hop number of LastHop
+	Err     error      // the trace could not be run
+}
+
+// MailOptions is who gets the report and through which server
+type MailOptions struct {
+	To   []string
+	SMTP SMTP
+}
+
+// SMTP is the mail server reports are sent through
+type SMTP struct {
+	Host string `json:"host"`
+	Port int    `json:"port,omitempty"` // default 587
+	From string `json:"from"`
+
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// PasswordEnv names an environment variable holding the password
+	PasswordEnv string `json:"password_env,omitempty"`
+
+	// StartTLS makes upgrading the connection required; servers that
+	// offer it are always upgraded
+	StartTLS           bool `json:"starttls,omitempty"`
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+}
+
+// ReportRun is what a report run found and did
+type ReportRun struct {
+	Summary
+	Results []Result // every ATM swept, in the order given, Cause and LastHop set
+	Outages []Outage
+	Report  Report   // the report as written
+	Written []string // the outputs written
+
+	// the steps after the sweep that failed; each leaves the others be
+	HistoryErr error
+	WriteErr   error
+	MailErr    error
+}
+
+// RunReport sweeps the machines and makes the report: it groups failures
+// into outages, traces the failing ATMs, updates the status history,
+// writes the outputs and mails them, as opts asks. The error joins those
+// of writing and mailing; a history that could not be updated is only
+// recorded in HistoryErr. If ctx is cancelled during the sweep or the
+// traces the run stops there with ctx's error.
+func RunReport(ctx context.Context, machines []Machine, opts ReportOptions) (ReportRun, error) {
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	if opts.Rules == nil {
+		opts.Rules = DefaultStatusRules
+	}
+	now := opts.Now
+	run := ReportRun{Results: make([]Result, len(machines))}
+
+	slog.Info("sweep started", "atms", len(machines), "inventory", opts.Inventory, "selection", opts.Selection)
+	for r := range Sweep(ctx, machines, opts.Options) {
+		run.Results[r.Index] = r
+		if opts.OnResult != nil {
+			opts.OnResult(r)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return run, fmt.Errorf("sweep interrupted: %w", err)
+	}
+
+	swept := make([]service.PingResult, len(run.Results))
+	for i, r := range run.Results {
+		swept[i] = service.PingResult(r.PingResult)
+	}
+	resolve, probe := resolver(ctx, opts.Options), prober(opts.Options)
+
+	if opts.Group.enabled() {
+		correlate := service.CorrelateOptions{
+			ByUpstream: opts.Group.ByUpstream,
+			ByRegion:   opts.Group.ByRegion,
+			BySubnet:   opts.Group.BySubnet,
+			SubnetBits: opts.Group.SubnetBits,
+			MinSize:    opts.Group.MinSize,
+			Upstreams:  opts.Group.Upstreams,
+			Rules:      toRules(opts.Rules),
+			Probe: func(address string) bool {
+				addr, err := resolve(address)
+				return err == nil && probe(ctx, addr.String())
+			},
+		}
+		for _, o := range service.Correlate(toMachines(machines), swept, correlate) {
+			run.Outages = append(run.Outages, Outage(o))
+		}
+	}
+
+	if opts.Diagnose != nil {
+		diagnose(ctx, *opts.Diagnose, resolve, machines, swept, opts)
+		if err := ctx.Err(); err != nil {
+			return run, fmt.Errorf("diagnosis interrupted: %w", err)
+		}
+	}
+
+	var listed []PingResult
+	for i := range run.Results {
+		run.Results[i].PingResult = PingResult(swept[i])
+		if r := run.Results[i]; opts.Filter == nil || opts.Filter(r.Machine, r.PingResult) {
+			listed = append(listed, r.PingResult)
+		}
+	}
+	run.Summary = Summarize(fromResults(swept))
+	slog.Info("sweep done", "atms", len(swept), "listed", len(listed), "outages", len(run.Outages), "maintenance", run.Maintenance, "took", time.Since(now))
+
+	if opts.History != "" {
+		if run.HistoryErr = recordHistory(opts.History, swept, now); run.HistoryErr != nil {
+			slog.Warn("history update failed", "path", opts.History, "err", run.HistoryErr)
+		}
+	}
+
+	run.Report = Report{
+		Generated: now,
+		Results:   listed,
+		Counts:    run.StatusCounts(),
+		Swept:     len(machines),
+		Inventory: max(opts.Inventory, len(machines)),
+		Selection: opts.Selection,
+	}
+	if run.Written, run.WriteErr = WriteReports(run.Report, opts.Outputs); run.WriteErr != nil {
+		slog.Error("output failed", "err", run.WriteErr)
+	}
+
+	if opts.Mail != nil && len(opts.Mail.To) > 0 {
+		if run.MailErr = mailReport(*opts.Mail, run); run.MailErr != nil {
+			slog.Error("mail failed", "to", opts.Mail.To, "err", run.MailErr)
+		} else {
+			slog.Info("mail sent", "to", opts.Mail.To)
+		}
+	}
+	return run, errors.Join(run.WriteErr, run.MailErr)
+}
+
+// traced are the statuses whose ATMs a diagnosis traces
+var traced = []string{StatusOffline, StatusOnlyADSL}
+
+// diagnose traces the failing results and records their last responding
+// hop. machines[i] is the ATM of results[i]. Cancelling ctx stops the
+// traces still running.
+func diagnose(ctx context.Context, opts TraceOptions, resolve func(string) (netip.Addr, error), machines []Machine, results []service.PingResult, run ReportOptions) {
+	var idx []int
+	var targets []netip.Addr
+	for i, r := range results {
+		if !slices.Contains(traced, r.Status) || r.Maintenance != "" {
+			continue
+		}
+		addr, err := resolve(machines[i].IP)
+		if err != nil {
+			continue
+		}
+		idx = append(idx, i)
+		targets = append(targets, addr)
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	network := opts.network
+	if network == nil {
+		network = trace.ICMP{Privileged: opts.Privileged}
+	}
+	tracer := trace.New(network)
+	if opts.MaxHops > 0 {
+		tracer.MaxHops = opts.MaxHops
+	}
+	if opts.HopTimeout > 0 {
+		tracer.Timeout = opts.HopTimeout
+	}
+	if opts.Concurrency > 0 {
+		tracer.Concurrency = opts.Concurrency
+	}
+
+	if run.OnDiagnose != nil {
+		run.OnDiagnose(len(targets))
+	}
+	for n, res := range tracer.TraceAll(ctx, targets) {
+		i := idx[n]
+		t := Trace{Target: res.Target, Reached: res.Reached, Err: res.Err}
+		if hop, ok := res.LastHop(); ok {
+			t.LastHop, t.LastTTL = hop.Addr, hop.TTL
+		}
+		switch {
+		case t.Err != nil:
+		case t.Reached:
+			results[i].LastHop = t.Target.String()
+		case t.LastHop.IsValid():
+			results[i].LastHop = t.LastHop.String()
+		}
+		if run.OnTrace != nil {
+			run.OnTrace(Result{PingResult: PingResult(results[i]), Machine: machines[i], Index: i}, t)
+		}
+	}
+}
+
+// recordHistory stores each result as its ATM's last known status
+func recordHistory(path string, results []service.PingResult, now time.Time) error {
+	store := storage.New[service.StatusRecord](path)
+	return store.Modify(func(records []service.StatusRecord) ([]service.StatusRecord, error) {
+		byName := make(map[string]int, len(records))
+		for i, r := range records {
+			byName[strings.ToLower(r.Name)] = i
+		}
+
+		for _, res := range results {
+			i, ok := byName[strings.ToLower(res.Name)]
+			if !ok {
+				records = append(records, service.StatusRecord{Name: res.Name, Since: now})
+				i = len(records) - 1
+				byName[strings.ToLower(res.Name)] = i
+			}
+
+			r := &records[i]
+			if r.Status != res.Status {
+				r.Since = now
+			}
+			r.IP = res.IP
+			r.Status = res.Status
+			r.Checked = now
+		}
+
+		return records, nil
+	})
+}
+
+// mailReport sends the summary in the body and the written outputs as
+// attachments
+func mailReport(opts MailOptions, run ReportRun) error {
+	now := run.Report.Generated
+	var body strings.Builder
+	body.WriteString(i18n.Sprintf("ATM connectivity report, %s\n\n", now.Format("2006-01-02 15:04")))
+	if heading := run.Report.Heading(); heading != "" {
+		body.WriteString(heading + "\n\n")
+	}
+	for _, c := range run.StatusCounts() {
+		if c.Status == StatusMaintenance {
+			body.WriteString(i18n.Sprintf("Under maintenance (not counted): %d\n", c.Count))
+		} else {
+			fmt.Fprintf(&body, "%s: %d\n", i18n.T(c.Status), c.Count)
+		}
+	}
+	if len(run.Outages) > 0 {
+		body.WriteString("\n" + i18n.T("Suspected causes:") + "\n")
+		for _, o := range run.Outages {
+			fmt.Fprintf(&body, "- %s\n", o.Cause)
+		}
+	}
+
+	msg := mail.Message{
+		To:      opts.To,
+		Subject: i18n.Sprintf("ATM report %s: %d Offline, %d OnlyADSL", now.Format("2006-01-02 15:04"), run.Counts[StatusOffline], run.Counts[StatusOnlyADSL]),
+		Body:    body.String(),
+	}
+	for _, path := range run.Written {
+		a, err := mail.AttachFile(path)
+		if err != nil {
+			return err
+		}
+		msg.Attachments = append(msg.Attachments, a)
+	}
+	return mail.Send(mail.Config(opts.SMTP), msg)
+}
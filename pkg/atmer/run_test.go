@@ -0,0 +1,222 @@
+package atmer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fahmaliyi/atmer/internal/service"
+	"github.com/fahmaliyi/atmer/internal/trace"
+)
+
+// fakeDNS resolves the names it knows and parses everything else
+type fakeDNS map[string]string
+
+func (d fakeDNS) resolve(ctx context.Context, address string) (netip.Addr, error) {
+	if ip, ok := d[address]; ok {
+		return netip.MustParseAddr(ip), nil
+	}
+	if addr, err := netip.ParseAddr(address); err == nil {
+		return addr, nil
+	}
+	return netip.Addr{}, fmt.Errorf("no such host %s", address)
+}
+
+// south has a region whose three ATMs are all down behind a dead router
+var south = []Machine{
+	{Name: "Bole", IP: "10.20.1.10", Region: "North"},
+	{Name: "Kality", IP: "10.40.1.10", Region: "South"},
+	{Name: "Akaki", IP: "10.40.2.10", Region: "South"},
+	{Name: "Tulu Dimtu", IP: "10.40.3.10", Region: "South"},
+}
+
+func TestRunReport(t *testing.T) {
+	dir := t.TempDir()
+	p := newFakeProbe(map[string][]bool{"10.20.1.10": {true}, "10.20.0.1": {true}})
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+
+	var seen int
+	run, err := RunReport(context.Background(), south, ReportOptions{
+		Options: Options{Probe: p.probe, Resolve: fakeDNS{"core-south": "10.40.0.1"}.resolve, Workers: 2, Now: now},
+		Filter:  func(m Machine, r PingResult) bool { return r.Status != StatusOnline },
+		Group: GroupOptions{
+			ByUpstream: true,
+			MinSize:    2,
+			Upstreams:  map[string]string{"South": "core-south", "North": "10.20.0.1"},
+		},
+		History:  filepath.Join(dir, "history.json"),
+		Outputs:  []string{filepath.Join(dir, "report-{date}.json")},
+		OnResult: func(Result) { seen++ },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if seen != len(south) {
+		t.Errorf("OnResult called %d times for %d ATMs", seen, len(south))
+	}
+	if run.Counts[StatusOnline] != 1 || run.Counts[StatusOffline] != 3 {
+		t.Errorf("counts = %v, want 1 Online and 3 Offline", run.Counts)
+	}
+	if n := p.count("10.40.0.1"); n != 1 {
+		t.Errorf("the South router, resolved through Resolve, was probed %d times", n)
+	}
+
+	if len(run.Outages) != 1 || run.Outages[0].Kind != "upstream" || fmt.Sprint(run.Outages[0].Members) != "[1 2 3]" {
+		t.Fatalf("outages = %+v, want the South upstream over its three ATMs", run.Outages)
+	}
+	for _, r := range run.Results[1:] {
+		if r.Cause != run.Outages[0].Cause {
+			t.Errorf("%s has cause %q, want %q", r.Name, r.Cause, run.Outages[0].Cause)
+		}
+	}
+	if run.Results[0].Cause != "" {
+		t.Errorf("online Bole blamed on %q", run.Results[0].Cause)
+	}
+
+	// the filter picks what is listed, not what is counted
+	if len(run.Report.Results) != 3 || run.Report.Swept != 4 || run.Report.Inventory != 4 {
+		t.Errorf("report lists %d of %d swept (inventory %d), want 3 of 4", len(run.Report.Results), run.Report.Swept, run.Report.Inventory)
+	}
+
+	want := filepath.Join(dir, "report-2026-03-02.json")
+	if len(run.Written) != 1 || run.Written[0] != want {
+		t.Errorf("written = %v, want %s", run.Written, want)
+	}
+	if _, err := os.Stat(want); err != nil {
+		t.Error(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "history.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var history []service.StatusRecord
+	if err := json.Unmarshal(data, &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 4 || history[1].Status != StatusOffline || !history[1].Since.Equal(now) {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+func TestRunReportResolve(t *testing.T) {
+	atms := []Machine{{Name: "Bole", IP: "atm-bole.branch"}}
+	p := newFakeProbe(map[string][]bool{"10.20.1.10": {true}})
+
+	run, err := RunReport(context.Background(), atms, ReportOptions{
+		Options: Options{Probe: p.probe, Resolve: fakeDNS{"atm-bole.branch": "10.20.1.10"}.resolve},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := run.Results[0]; r.Status != StatusOnline {
+		t.Errorf("Bole = %s, want Online through the given resolver", r.Status)
+	}
+	if len(run.Written) != 0 || run.HistoryErr != nil {
+		t.Errorf("the zero options wrote %v", run.Written)
+	}
+}
+
+func TestRunReportDiagnose(t *testing.T) {
+	router := netip.MustParseAddr("10.40.0.1")
+	network := paths{
+		netip.MustParseAddr("10.40.1.10"): {netip.MustParseAddr("10.0.0.1"), router},
+		netip.MustParseAddr("10.40.2.10"): {netip.MustParseAddr("10.0.0.1"), router, netip.MustParseAddr("10.40.2.10")},
+	}
+	p := newFakeProbe(map[string][]bool{"10.20.1.10": {true}})
+
+	var atms int
+	traces := map[string]Trace{}
+	run, err := RunReport(context.Background(), south[:3], ReportOptions{
+		Options:    Options{Probe: p.probe},
+		Diagnose:   &TraceOptions{MaxHops: 4, HopTimeout: time.Millisecond, network: network},
+		OnDiagnose: func(n int) { atms = n },
+		OnTrace:    func(r Result, tr Trace) { traces[r.Name] = tr },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if atms != 2 || len(traces) != 2 {
+		t.Fatalf("traced %d ATMs (%d traces), want the 2 offline", atms, len(traces))
+	}
+	if tr := traces["Kality"]; tr.Reached || tr.LastHop != router || tr.LastTTL != 2 {
+		t.Errorf("Kality trace = %+v, want it to end at %s on hop 2", tr, router)
+	}
+	if !traces["Akaki"].Reached {
+		t.Errorf("Akaki trace = %+v, want it reached", traces["Akaki"])
+	}
+	for name, want := range map[string]string{"Bole": "", "Kality": "10.40.0.1", "Akaki": "10.40.2.10"} {
+		for _, r := range run.Results {
+			if r.Name == name && r.LastHop != want {
+				t.Errorf("%s last hop = %q, want %q", name, r.LastHop, want)
+			}
+		}
+	}
+}
+
+// paths is a network where the hops to each target answer in turn
+type paths map[netip.Addr][]netip.Addr
+
+func (p paths) Probe(ctx context.Context, dst netip.Addr, ttl int, timeout time.Duration) (trace.Reply, error) {
+	if ttl > len(p[dst]) {
+		return trace.Reply{}, nil
+	}
+	from := p[dst][ttl-1]
+	return trace.Reply{From: from, Reached: from == dst}, nil
+}
+
+// stalled is a network whose probes answer only when ctx is done
+type stalled struct{}
+
+func (stalled) Probe(ctx context.Context, dst netip.Addr, ttl int, timeout time.Duration) (trace.Reply, error) {
+	<-ctx.Done()
+	return trace.Reply{}, ctx.Err()
+}
+
+func TestRunReportDiagnoseStopsWithContext(t *testing.T) {
+	dir := t.TempDir()
+	p := newFakeProbe(nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	type outcome struct {
+		run ReportRun
+		err error
+	}
+	done := make(chan outcome)
+	go func() {
+		run, err := RunReport(ctx, machines[:2], ReportOptions{
+			Options:  Options{Probe: p.probe},
+			Diagnose: &TraceOptions{network: stalled{}},
+			Outputs:  []string{filepath.Join(dir, "report.json")},
+		})
+		done <- outcome{run, err}
+	}()
+
+	var got outcome
+	select {
+	case got = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunReport kept tracing after its context ended")
+	}
+	if !errors.Is(got.err, context.DeadlineExceeded) || !strings.Contains(got.err.Error(), "diagnosis interrupted") {
+		t.Errorf("err = %v, want the diagnosis interrupted", got.err)
+	}
+	for _, r := range got.run.Results {
+		if r.LastHop != "" {
+			t.Errorf("%s got last hop %s from a cancelled trace", r.Name, r.LastHop)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "report.json")); err == nil {
+		t.Error("an interrupted run wrote its report")
+	}
+}
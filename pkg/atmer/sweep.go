@@ -0,0 +1,222 @@
+package atmer
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fahmaliyi/atmer/internal/service"
+)
+
+// Options tune a sweep. The zero value probes every ATM once, one at a
+// time, with the default decision table.
+type Options struct {
+	Rules   []StatusRule // decision table; nil means DefaultStatusRules
+	Windows []Window     // maintenance windows besides each ATM's Maintenance column
+	Now     time.Time    // when the windows are checked; zero means when Sweep is called
+
+	// Probe reports whether an IP address answers; nil pings it once with
+	// the system's ping command
+	Probe func(ctx context.Context, addr string) bool
+	// Resolve turns an ATM's or link's address, which may be a hostname,
+	// into the IP given to Probe; nil looks hostnames up through the
+	// system resolver, caching them for five minutes
+	Resolve func(ctx context.Context, address string) (netip.Addr, error)
+
+	Workers int // ATMs probed at once; 0 means 1
+
+	Recheck      int           // times Offline and OnlyADSL ATMs are probed again
+	RecheckDelay time.Duration // wait before each re-check
+
+	// OnRecheck is called, if set, before each re-check round with the
+	// number of ATMs about to be probed again and the attempt number
+	OnRecheck func(atms, attempt int)
+}
+
+// Result is the final outcome for one ATM of a sweep
+type Result struct {
+	PingResult
+	Machine Machine
+	Index   int // position of Machine in the slice given to Sweep
+}
+
+// rechecked are the statuses probed again by a re-check
+var rechecked = []string{StatusOffline, StatusOnlyADSL}
+
+// Sweep probes the machines and sends each one's result once it is final.
+// ATMs under maintenance are not probed unless their window says so.
+//
+// Failures are re-checked up to opts.Recheck times, waiting
+// opts.RecheckDelay before each round, to weed out transient packet loss.
+// An ATM keeps the best status of its attempts, best being earliest in the
+// decision table, and its result is held back until no round is left that
+// could improve it; with Workers above 1 results also arrive out of order,
+// so use Result.Index to line them up.
+//
+// The channel is closed when every ATM is done or ctx is cancelled; after
+// cancellation the ATMs not yet done are left out.
+func Sweep(ctx context.Context, machines []Machine, opts Options) <-chan Result {
+	ch := make(chan Result)
+	go func() {
+		defer close(ch)
+		sweep(ctx, machines, opts, ch)
+	}()
+	return ch
+}
+
+func sweep(ctx context.Context, machines []Machine, opts Options, ch chan<- Result) {
+	if opts.Rules == nil {
+		opts.Rules = DefaultStatusRules
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	probe := prober(opts)
+	resolve := resolver(ctx, opts)
+	rules, windows := toRules(opts.Rules), toWindows(opts.Windows)
+	classify := func(m Machine) string {
+		return service.Classify(m.internal(), rules, resolve, func(addr string) bool { return probe(ctx, addr) })
+	}
+	rank := func(status string) int {
+		i := slices.IndexFunc(opts.Rules, func(r StatusRule) bool { return r.Status == status })
+		if i < 0 {
+			return len(opts.Rules)
+		}
+		return i
+	}
+	retry := func(r Result) bool {
+		return opts.Recheck > 0 && r.Attempts > 0 && slices.Contains(rechecked, r.Status)
+	}
+	send := func(r Result) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		select {
+		case ch <- r:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	all := make([]int, len(machines))
+	for i := range all {
+		all[i] = i
+	}
+
+	results := make([]Result, len(machines))
+	each(ctx, all, opts.Workers, func(i int) {
+		m := machines[i]
+		r := Result{PingResult: PingResult{Name: m.Name, IP: m.IP}, Machine: m, Index: i}
+		w, inMaintenance := service.FindWindow(windows, m.internal(), opts.Now)
+		if inMaintenance {
+			r.Maintenance = w.String()
+		}
+		if inMaintenance && !w.Probe {
+			r.Status = StatusMaintenance
+		} else {
+			r.Status = classify(m)
+			r.Attempts = 1
+		}
+
+		results[i] = r
+		if !retry(r) {
+			send(r)
+		}
+	})
+
+	var pending []int
+	for i, r := range results {
+		if retry(r) {
+			pending = append(pending, i)
+		}
+	}
+
+	for round := 1; round <= opts.Recheck && len(pending) > 0; round++ {
+		if opts.OnRecheck != nil {
+			opts.OnRecheck(len(pending), round+1)
+		}
+		slog.Info("re-check", "atms", len(pending), "attempt", round+1, "delay", opts.RecheckDelay)
+
+		timer := time.NewTimer(opts.RecheckDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		each(ctx, pending, opts.Workers, func(i int) {
+			results[i].Attempts++
+			if status := classify(machines[i]); rank(status) < rank(results[i].Status) {
+				slog.Info("re-check changed status", "atm", machines[i].Name, "from", results[i].Status, "to", status, "attempt", results[i].Attempts)
+				results[i].Status = status
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		var still []int
+		for _, i := range pending {
+			if retry(results[i]) {
+				still = append(still, i)
+			} else if !send(results[i]) {
+				return
+			}
+		}
+		pending = still
+	}
+
+	for _, i := range pending {
+		if !send(results[i]) {
+			return
+		}
+	}
+}
+
+// prober returns opts.Probe, or a ping
+func prober(opts Options) func(ctx context.Context, addr string) bool {
+	if opts.Probe != nil {
+		return opts.Probe
+	}
+	return func(ctx context.Context, addr string) bool {
+		ok, _ := service.ProbeContext(ctx, addr)
+		return ok
+	}
+}
+
+// resolver returns opts.Resolve bound to ctx, or DefaultResolver's
+func resolver(ctx context.Context, opts Options) func(string) (netip.Addr, error) {
+	if opts.Resolve == nil {
+		return service.DefaultResolver.Resolve
+	}
+	return func(address string) (netip.Addr, error) { return opts.Resolve(ctx, address) }
+}
+
+// each runs fn for every index, workers at a time, and returns when all
+// have finished; once ctx is cancelled no more are started
+func each(ctx context.Context, idx []int, workers int, fn func(i int)) {
+	sem := make(chan struct{}, max(workers, 1))
+
+	var wg sync.WaitGroup
+	for _, i := range idx {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+}
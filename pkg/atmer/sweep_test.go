@@ -0,0 +1,203 @@
+package atmer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeProbe answers each address from a script, one answer per probe; the
+// last answer repeats. Addresses without a script never answer.
+type fakeProbe struct {
+	mu      sync.Mutex
+	answers map[string][]bool
+	calls   map[string]int
+}
+
+func newFakeProbe(answers map[string][]bool) *fakeProbe {
+	return &fakeProbe{answers: answers, calls: map[string]int{}}
+}
+
+func (f *fakeProbe) probe(ctx context.Context, addr string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := f.calls[addr]
+	f.calls[addr]++
+	script := f.answers[addr]
+	if len(script) == 0 {
+		return false
+	}
+	return script[min(n, len(script)-1)]
+}
+
+func (f *fakeProbe) count(addr string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[addr]
+}
+
+// collect drains a sweep into results by ATM name
+func collect(t *testing.T, ch <-chan Result) map[string]Result {
+	t.Helper()
+	got := map[string]Result{}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case r, ok := <-ch:
+			if !ok {
+				return got
+			}
+			if _, dup := got[r.Name]; dup {
+				t.Errorf("%s sent twice", r.Name)
+			}
+			got[r.Name] = r
+		case <-timeout:
+			t.Fatal("sweep did not finish")
+		}
+	}
+}
+
+// each ATM's modem is its IP with the last octet one lower
+var machines = []Machine{
+	{Name: "Bole", IP: "10.20.1.10"},
+	{Name: "Piassa", IP: "10.20.2.10"},
+	{Name: "Kality", IP: "10.20.3.10"},
+	{Name: "CMC", IP: "10.20.4.10"},
+	{Name: "Megenagna", IP: "10.20.5.10"},
+	{Name: "Ayat", IP: "10.20.6.10"},
+}
+
+func TestSweepWithoutRecheck(t *testing.T) {
+	p := newFakeProbe(map[string][]bool{
+		"10.20.1.10": {true},
+		"10.20.2.9":  {true},
+	})
+	var rounds int
+	got := collect(t, Sweep(context.Background(), machines[:3], Options{
+		Probe:     p.probe,
+		OnRecheck: func(int, int) { rounds++ },
+	}))
+
+	for name, want := range map[string]string{"Bole": StatusOnline, "Piassa": StatusOnlyADSL, "Kality": StatusOffline} {
+		if r := got[name]; r.Status != want || r.Attempts != 1 {
+			t.Errorf("%s = %s after %d attempt(s), want %s after 1", name, r.Status, r.Attempts, want)
+		}
+	}
+	if rounds != 0 || p.count("10.20.3.10") != 1 {
+		t.Errorf("re-checked without Recheck: %d round(s), Kality probed %d times", rounds, p.count("10.20.3.10"))
+	}
+}
+
+func TestSweepRecheck(t *testing.T) {
+	p := newFakeProbe(map[string][]bool{
+		"10.20.1.10": {true},               // Bole online from the start
+		"10.20.2.10": {false, true},        // Piassa recovers on the second attempt
+		"10.20.4.9":  {true},               // CMC's modem only: OnlyADSL throughout
+		"10.20.5.10": {false, false, true}, // Megenagna recovers on the last attempt
+		"10.20.6.9":  {true, false},        // Ayat's modem answers only at first
+	})
+	var rounds [][2]int
+	got := collect(t, Sweep(context.Background(), machines, Options{
+		Probe:        p.probe,
+		Workers:      3,
+		Recheck:      2,
+		RecheckDelay: time.Millisecond,
+		OnRecheck:    func(atms, attempt int) { rounds = append(rounds, [2]int{atms, attempt}) },
+	}))
+
+	for _, c := range []struct {
+		name     string
+		status   string
+		attempts int
+	}{
+		{"Bole", StatusOnline, 1},
+		{"Piassa", StatusOnline, 2},
+		{"Kality", StatusOffline, 3},
+		{"CMC", StatusOnlyADSL, 3},
+		{"Megenagna", StatusOnline, 3},
+		// the best status of the attempts is kept
+		{"Ayat", StatusOnlyADSL, 3},
+	} {
+		if r := got[c.name]; r.Status != c.status || r.Attempts != c.attempts {
+			t.Errorf("%s = %s after %d attempt(s), want %s after %d", c.name, r.Status, r.Attempts, c.status, c.attempts)
+		}
+	}
+
+	// round 2 probes the five failures, round 3 the four still failing
+	if fmt.Sprint(rounds) != "[[5 2] [4 3]]" {
+		t.Errorf("re-check rounds = %v", rounds)
+	}
+	if n := p.count("10.20.1.10"); n != 1 {
+		t.Errorf("online Bole probed %d times", n)
+	}
+
+	for name, r := range got {
+		if machines[r.Index].Name != name {
+			t.Errorf("%s has Index %d, which is %s", name, r.Index, machines[r.Index].Name)
+		}
+	}
+}
+
+func TestSweepMaintenanceNotProbed(t *testing.T) {
+	p := newFakeProbe(nil)
+	atms := []Machine{{Name: "Bole", IP: "10.20.1.10", Maintenance: "decommissioned"}}
+	got := collect(t, Sweep(context.Background(), atms, Options{Probe: p.probe, Recheck: 3, RecheckDelay: time.Millisecond}))
+
+	if r := got["Bole"]; r.Status != StatusMaintenance || r.Attempts != 0 || r.Maintenance == "" {
+		t.Errorf("Bole = %+v, want Maintenance without attempts", r.PingResult)
+	}
+	if n := p.count("10.20.1.10"); n != 0 {
+		t.Errorf("an ATM under maintenance was probed %d times", n)
+	}
+}
+
+func TestSweepWorkers(t *testing.T) {
+	var running, peak atomic.Int32
+	probe := func(ctx context.Context, addr string) bool {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return true
+	}
+
+	var atms []Machine
+	for i := range 12 {
+		atms = append(atms, Machine{Name: fmt.Sprintf("ATM%d", i), IP: fmt.Sprintf("10.30.%d.10", i)})
+	}
+	got := collect(t, Sweep(context.Background(), atms, Options{Probe: probe, Workers: 4}))
+
+	if len(got) != 12 {
+		t.Errorf("got %d results, want 12", len(got))
+	}
+	if p := peak.Load(); p > 4 || p < 2 {
+		t.Errorf("%d probes ran at once with 4 workers", p)
+	}
+}
+
+func TestSweepCancelledDuringRecheck(t *testing.T) {
+	p := newFakeProbe(map[string][]bool{"10.20.1.10": {true}})
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := Sweep(ctx, machines[:2], Options{
+		Probe:        p.probe,
+		Recheck:      1,
+		RecheckDelay: time.Hour,
+		OnRecheck:    func(int, int) { cancel() },
+	})
+
+	got := collect(t, ch)
+	if _, ok := got["Bole"]; !ok {
+		t.Error("Bole, final before the re-check, was not sent")
+	}
+	if _, ok := got["Piassa"]; ok {
+		t.Error("Piassa was sent although its re-check was cancelled")
+	}
+}